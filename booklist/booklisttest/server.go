@@ -0,0 +1,505 @@
+/*
+Package booklisttest provides a fake CARL.X catalog for testing code that
+searches a library's catalog using the booklist package.
+
+The Server implements the 'search/count' and 'search' endpoints used by
+booklist.CatalogInfo, answering them from a configurable inventory of
+publications.  It honors the search term, the 'Year' and 'Format' facet
+filters and paging, and records each request it receives so a test can
+make assertions about the request bodies and headers.
+
+Faults can be injected to simulate an unhealthy catalog:  HTTP errors,
+slow responses, responses with 'success: false' and malformed JSON.
+
+A typical test:
+
+	server := booklisttest.NewServer(
+	    booklisttest.Publication{
+	        Author: "Grafton, Sue",
+	        Title:  "X",
+	        Format: "Book",
+	        Year:   "2015",
+	    },
+	)
+	defer server.Close()
+
+	c := booklist.CatalogInfo{
+	    URL:    server.URL,
+	    Author: "Grafton, Sue",
+	    Media:  "Book",
+	    Year:   "2015",
+	}
+	pubs, err := c.PublicationSearch()
+
+The search needs no logger; set CatalogInfo.Log to see its messages.
+*/
+package booklisttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Endpoint names, relative to the catalog URL.
+const (
+	CountEndpoint  = "search/count"
+	SearchEndpoint = "search"
+)
+
+// DefaultSupersets lists the formats that include other formats in a
+// search, e.g., a search for 'Book' also matches 'Large Print'.
+var DefaultSupersets = map[string][]string{
+	"Book":                {"Large Print"},
+	"Electronic Resource": {"eBook", "eAudioBook"},
+}
+
+// Publication is an entry in the fake catalog's inventory.
+//
+// Fields adds to or replaces the resource fields derived from the other
+// values; a field with a nil value is removed from the resource.  This can
+// be used to simulate resources with missing or unexpected fields.
+type Publication struct {
+	ID     int
+	Author string
+	Title  string
+	Format string
+	Year   string
+	Fields map[string]interface{}
+}
+
+// FacetFilter is a facet filter found in a search request.
+type FacetFilter struct {
+	FacetName    string `json:"facetName"`
+	FacetValue   string `json:"facetValue"`
+	FacetDisplay string `json:"facetDisplay"`
+}
+
+// SearchRequest is the JSON body of a search request.
+type SearchRequest struct {
+	AddToHistory   bool          `json:"addToHistory"`
+	DbCodes        []string      `json:"dbCodes"`
+	HitsPerPage    int           `json:"hitsPerPage"`
+	SortCriteria   string        `json:"sortCriteria"`
+	StartIndex     int           `json:"startIndex"`
+	TargetAudience string        `json:"targetAudience"`
+	FacetFilters   []FacetFilter `json:"facetFilters"`
+	SearchTerm     string        `json:"searchTerm"`
+}
+
+// Facet returns the value of the named facet filter, or an empty string
+// if the request doesn't contain that filter.
+func (r SearchRequest) Facet(name string) string {
+	for _, filter := range r.FacetFilters {
+		if filter.FacetName == name {
+			return filter.FacetValue
+		}
+	}
+	return ""
+}
+
+// Request is a request received by the fake catalog.
+type Request struct {
+	Endpoint string
+	Method   string
+	URL      string
+	Header   http.Header
+	Body     []byte
+	Search   SearchRequest
+}
+
+// Fault describes a failure to inject into the fake catalog's responses.
+//
+// Endpoint limits the fault to one endpoint; if empty, the fault applies
+// to both.  Request limits the fault to the nth request (counting from 1)
+// to the endpoint; if zero, the fault applies to every request.
+type Fault struct {
+	Endpoint string
+	Request  int
+
+	// Status, if non-zero, is the HTTP status returned instead of a
+	// search response.
+	Status int
+
+	// Delay is the time to wait before responding.
+	Delay time.Duration
+
+	// Reject replies with 'success: false'.
+	Reject bool
+
+	// Malformed replies with a body that isn't valid JSON.
+	Malformed bool
+}
+
+// Server is a fake CARL.X catalog.
+//
+// The exported fields may be changed before or between searches, but not
+// while a search is in progress.
+type Server struct {
+	*httptest.Server
+
+	// URL is the catalog URL to use in booklist.CatalogInfo; unlike the
+	// embedded server's URL, it ends with a slash.
+	URL string
+
+	// Inventory is the list of publications searched.
+	Inventory []Publication
+
+	// PageSize limits the number of resources in a search response;
+	// if zero, the hitsPerPage of the request is the limit.
+	PageSize int
+
+	// IgnoreStartIndex always returns the first page of results, as a
+	// misconfigured catalog might.
+	IgnoreStartIndex bool
+
+	// Formats, if not empty, is the list of formats the catalog supports;
+	// a search for any other format is rejected with 'success: false'.
+	Formats []string
+
+	// Supersets lists the formats that include other formats.
+	Supersets map[string][]string
+
+	mu       sync.Mutex
+	faults   []Fault
+	requests []Request
+	counts   map[string]int
+}
+
+// NewServer starts and returns a fake catalog with the given inventory.
+// The caller should call Close when finished, to shut it down.
+func NewServer(inventory ...Publication) *Server {
+	s := &Server{
+		Inventory: inventory,
+		Supersets: DefaultSupersets,
+		counts:    make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+CountEndpoint, s.handle(CountEndpoint))
+	mux.HandleFunc("/"+SearchEndpoint, s.handle(SearchEndpoint))
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL + "/"
+	return s
+}
+
+// Inject adds a fault to the fake catalog's responses.
+func (s *Server) Inject(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, fault)
+}
+
+// ClearFaults removes the injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far, in the order received.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received so far for the given endpoint.
+func (s *Server) RequestsTo(endpoint string) []Request {
+	var requests []Request
+	for _, req := range s.Requests() {
+		if req.Endpoint == endpoint {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// Reset forgets the requests received so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.counts = make(map[string]int)
+}
+
+// AssertHeader reports an error if any request received so far doesn't
+// have the given value for the named header.
+func (s *Server) AssertHeader(t testing.TB, name, value string) {
+	t.Helper()
+	for i, req := range s.Requests() {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("Request %d to %s: expected header %s to be %q; "+
+				"got %q.", i+1, req.Endpoint, name, value, got)
+		}
+	}
+}
+
+// AssertSearch reports an error if any request received so far doesn't
+// satisfy the given check.
+func (s *Server) AssertSearch(t testing.TB, check func(SearchRequest) error) {
+	t.Helper()
+	for i, req := range s.Requests() {
+		if err := check(req.Search); err != nil {
+			t.Errorf("Request %d to %s: %s.", i+1, req.Endpoint, err)
+		}
+	}
+}
+
+// handle returns the handler for the given endpoint.
+func (s *Server) handle(endpoint string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := Request{
+			Endpoint: endpoint,
+			Method:   r.Method,
+			URL:      r.URL.String(),
+			Header:   r.Header.Clone(),
+			Body:     body,
+		}
+		decodeErr := json.Unmarshal(body, &req.Search)
+		fault := s.record(req)
+
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case fault.Status != 0:
+			http.Error(w, http.StatusText(fault.Status), fault.Status)
+			return
+		case r.Method != http.MethodPost:
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		case decodeErr != nil:
+			http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		if fault.Malformed {
+			fmt.Fprint(w, `{"success": true, "totalHits": `)
+			return
+		}
+
+		var response interface{}
+		if fault.Reject || !s.supportsFormat(req.Search.Facet("Format")) {
+			response = map[string]interface{}{
+				"success":   false,
+				"totalHits": 0,
+			}
+		} else if endpoint == CountEndpoint {
+			response = s.countResponse(req.Search)
+		} else {
+			response = s.searchResponse(req.Search)
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// record saves the request and returns the faults that apply to it
+// combined into one.
+func (s *Server) record(req Request) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	s.counts[req.Endpoint]++
+	n := s.counts[req.Endpoint]
+
+	var combined Fault
+	for _, fault := range s.faults {
+		if fault.Endpoint != "" && fault.Endpoint != req.Endpoint {
+			continue
+		}
+		if fault.Request != 0 && fault.Request != n {
+			continue
+		}
+		if fault.Status != 0 {
+			combined.Status = fault.Status
+		}
+		combined.Delay += fault.Delay
+		combined.Reject = combined.Reject || fault.Reject
+		combined.Malformed = combined.Malformed || fault.Malformed
+	}
+	return combined
+}
+
+// supportsFormat returns whether a search for the given format is allowed.
+func (s *Server) supportsFormat(format string) bool {
+	if len(s.Formats) == 0 || format == "" {
+		return true
+	}
+	for _, supported := range s.Formats {
+		if strings.EqualFold(format, supported) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the publications matching the search.
+func (s *Server) matches(search SearchRequest) []Publication {
+	term := strings.ToLower(search.SearchTerm)
+	year := search.Facet("Year")
+	format := search.Facet("Format")
+
+	var matched []Publication
+	for _, pub := range s.Inventory {
+		if term != "" && !strings.Contains(strings.ToLower(pub.Author), term) &&
+			!strings.Contains(strings.ToLower(pub.Title), term) {
+			continue
+		}
+		if year != "" && !yearMatches(pub.Year, year) {
+			continue
+		}
+		if format != "" && !s.formatMatches(pub.Format, format) {
+			continue
+		}
+		matched = append(matched, pub)
+	}
+	return matched
+}
+
+// yearMatches returns whether the publication year satisfies the filter;
+// a filter of 'unknown' matches publications without a year.
+func yearMatches(pubYear, filter string) bool {
+	if strings.EqualFold(filter, "unknown") {
+		return pubYear == "" || strings.EqualFold(pubYear, "unknown")
+	}
+	return pubYear == filter
+}
+
+// formatMatches returns whether the publication format satisfies the filter.
+func (s *Server) formatMatches(pubFormat, filter string) bool {
+	if strings.EqualFold(pubFormat, filter) {
+		return true
+	}
+	for _, included := range s.Supersets[filter] {
+		if strings.EqualFold(pubFormat, included) {
+			return true
+		}
+	}
+	return false
+}
+
+// countResponse returns the response to a 'search/count' request.
+func (s *Server) countResponse(search SearchRequest) interface{} {
+	return map[string]interface{}{
+		"success":   true,
+		"totalHits": len(s.matches(search)),
+	}
+}
+
+// searchResponse returns the response to a 'search' request; it contains
+// a page of resources and the facet counts for all matching publications.
+func (s *Server) searchResponse(search SearchRequest) interface{} {
+	matched := s.matches(search)
+
+	start := search.StartIndex
+	if s.IgnoreStartIndex || start < 0 {
+		start = 0
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	pageSize := search.HitsPerPage
+	if s.PageSize > 0 && (pageSize <= 0 || s.PageSize < pageSize) {
+		pageSize = s.PageSize
+	}
+	end := len(matched)
+	if pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+	}
+
+	resources := make([]map[string]interface{}, 0, end-start)
+	for i, pub := range matched[start:end] {
+		resources = append(resources, pub.resource(start+i+1))
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"totalHits":  len(matched),
+		"startIndex": start,
+		"resources":  resources,
+		"facets": []interface{}{
+			facetCounts("Format", matched, func(p Publication) string {
+				return p.Format
+			}),
+			facetCounts("Year", matched, func(p Publication) string {
+				if p.Year == "" {
+					return "unknown"
+				}
+				return p.Year
+			}),
+		},
+	}
+}
+
+// facetCounts returns the number of publications for each facet value.
+func facetCounts(name string, pubs []Publication, value func(Publication) string) interface{} {
+	var order []string
+	counts := make(map[string]int)
+	for _, pub := range pubs {
+		v := value(pub)
+		if _, ok := counts[v]; !ok {
+			order = append(order, v)
+		}
+		counts[v]++
+	}
+
+	values := make([]interface{}, 0, len(order))
+	for _, v := range order {
+		values = append(values, map[string]interface{}{
+			"value": v,
+			"count": counts[v],
+		})
+	}
+	return map[string]interface{}{
+		"name":   name,
+		"values": values,
+	}
+}
+
+// resource returns the publication as a resource in a search response;
+// id is used if the publication doesn't have an ID.
+func (p Publication) resource(id int) map[string]interface{} {
+	if p.ID != 0 {
+		id = p.ID
+	}
+	resource := map[string]interface{}{
+		"id":         id,
+		"shortTitle": p.Title,
+		"format":     p.Format,
+	}
+	if p.Author != "" {
+		resource["shortAuthor"] = p.Author
+	}
+	if p.Year != "" {
+		resource["publicationDate"] = p.Year
+	}
+	for name, value := range p.Fields {
+		if value == nil {
+			delete(resource, name)
+		} else {
+			resource[name] = value
+		}
+	}
+	return resource
+}
@@ -0,0 +1,246 @@
+// Unit tests related to the fake catalog. //
+package booklisttest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+var testLog booklist.Logger
+
+func init() {
+	var err error
+	testLog, err = booklist.NewWriterLogger(ioutil.Discard,
+		booklist.LevelTrace, booklist.LogText)
+	if err != nil {
+		panic(err)
+	}
+}
+
+var inventory = []booklisttest.Publication{
+	{Author: "Grafton, Sue", Title: "X", Format: "Book", Year: "2015"},
+	{Author: "Grafton, Sue", Title: "X", Format: "Large Print", Year: "2015"},
+	{Author: "Grafton, Sue", Title: "W is for wasted", Format: "Book", Year: "2013"},
+	{Author: "Grafton, Sue", Title: "X", Format: "eBook", Year: "2015"},
+	{Author: "King, Stephen", Title: "Finders keepers", Format: "Book", Year: "2015"},
+}
+
+func catalog(server *booklisttest.Server) booklist.CatalogInfo {
+	return booklist.CatalogInfo{
+		URL:    server.URL,
+		Author: "Grafton, Sue",
+		Media:  "Book",
+		Year:   "2015",
+		Log:    testLog,
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Log("search filters on author, year and format.")
+	server := booklisttest.NewServer(inventory...)
+	defer server.Close()
+
+	pubs, err := catalog(server).PublicationSearch()
+	if err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+
+	expected := []booklist.PublicationInfo{
+		{Media: "Book", Publication: "X", RecordID: "1", Date: "2015"},
+		{Media: "Large Print", Publication: "X", RecordID: "2", Date: "2015"},
+	}
+	if fmt.Sprint(pubs) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v; got %v.", expected, pubs)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	t.Log("results are retrieved a page at a time.")
+	var many []booklisttest.Publication
+	for i := 0; i < 7; i++ {
+		many = append(many, booklisttest.Publication{
+			Author: "Grafton, Sue",
+			Title:  fmt.Sprintf("Title %d", i),
+			Format: "Book",
+			Year:   "2015",
+		})
+	}
+	server := booklisttest.NewServer(many...)
+	server.PageSize = 3
+	defer server.Close()
+
+	pubs, err := catalog(server).PublicationSearch()
+	if err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+	if len(pubs) != len(many) {
+		t.Errorf("Expected %d publications; got %d.", len(many), len(pubs))
+	}
+
+	searches := server.RequestsTo(booklisttest.SearchEndpoint)
+	if len(searches) != 3 {
+		t.Fatalf("Expected 3 search requests; got %d.", len(searches))
+	}
+	for i, req := range searches {
+		if req.Search.StartIndex != i*3 {
+			t.Errorf("Expected request %d to start at %d; got %d.",
+				i+1, i*3, req.Search.StartIndex)
+		}
+	}
+}
+
+func TestIgnoredStartIndex(t *testing.T) {
+	t.Log("catalog that ignores the start index repeats the first page.")
+	server := booklisttest.NewServer(inventory...)
+	server.PageSize = 1
+	server.IgnoreStartIndex = true
+	defer server.Close()
+
+	pubs, err := catalog(server).PublicationSearch()
+	if err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+	if n := len(server.RequestsTo(booklisttest.SearchEndpoint)); n != 2 {
+		t.Errorf("Expected 2 search requests; got %d.", n)
+	}
+	if len(pubs) != 2 || pubs[0] != pubs[1] {
+		t.Errorf("Expected the first page twice; got %v.", pubs)
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	t.Log("search for an unsupported format is rejected.")
+	server := booklisttest.NewServer(inventory...)
+	server.Formats = []string{"eBook"}
+	defer server.Close()
+
+	_, err := catalog(server).PublicationSearch()
+	if !errors.Is(err, booklist.ErrSearchRejected) {
+		t.Errorf("Expected ErrSearchRejected; got %v.", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	t.Log("injected faults produce the matching errors.")
+	testCases := []struct {
+		description string
+		fault       booklisttest.Fault
+		check       func(error) bool
+	}{
+		{
+			"server error",
+			booklisttest.Fault{Status: http.StatusInternalServerError},
+			func(err error) bool {
+				var httpErr *booklist.HTTPError
+				return errors.As(err, &httpErr) &&
+					httpErr.StatusCode == http.StatusInternalServerError
+			},
+		},
+		{
+			"rejected count",
+			booklisttest.Fault{
+				Endpoint: booklisttest.CountEndpoint,
+				Reject:   true,
+			},
+			func(err error) bool {
+				return errors.Is(err, booklist.ErrSearchRejected)
+			},
+		},
+		{
+			"malformed search",
+			booklisttest.Fault{
+				Endpoint:  booklisttest.SearchEndpoint,
+				Malformed: true,
+			},
+			func(err error) bool {
+				var decodeErr *booklist.DecodeError
+				return errors.As(err, &decodeErr)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			server := booklisttest.NewServer(inventory...)
+			defer server.Close()
+			server.Inject(tc.fault)
+
+			_, err := catalog(server).PublicationSearch()
+			if !tc.check(err) {
+				t.Errorf("Unexpected error for %s: %v.", tc.description, err)
+			}
+		})
+	}
+}
+
+func TestSlowResponse(t *testing.T) {
+	t.Log("slow response exceeds the client timeout.")
+	server := booklisttest.NewServer(inventory...)
+	defer server.Close()
+	server.Inject(booklisttest.Fault{Request: 1, Delay: time.Second})
+
+	c := catalog(server)
+	c.Client = &http.Client{Timeout: 50 * time.Millisecond}
+	_, err := c.PublicationSearch()
+
+	var reqErr *booklist.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("Expected a RequestError; got %v.", err)
+	}
+
+	server.ClearFaults()
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Errorf("Expected search to succeed once fault cleared; got %s.",
+			err)
+	}
+}
+
+func TestRequestAssertions(t *testing.T) {
+	t.Log("requests contain the expected headers and filters.")
+	server := booklisttest.NewServer(inventory...)
+	defer server.Close()
+
+	if _, err := catalog(server).PublicationSearch(); err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+
+	server.AssertHeader(t, "X-Requested-With", "XMLHttpRequest")
+	server.AssertHeader(t, "Content-Type", "application/json; charset=utf-8")
+	server.AssertSearch(t, func(search booklisttest.SearchRequest) error {
+		if search.SearchTerm != "Grafton, Sue" {
+			return fmt.Errorf("unexpected search term %q", search.SearchTerm)
+		}
+		if search.Facet("Year") != "2015" || search.Facet("Format") != "Book" {
+			return fmt.Errorf("unexpected filters %v", search.FacetFilters)
+		}
+		return nil
+	})
+}
+
+func TestMissingFields(t *testing.T) {
+	t.Log("resources can be served without expected fields.")
+	server := booklisttest.NewServer(booklisttest.Publication{
+		Author: "Grafton, Sue",
+		Title:  "X",
+		Format: "Book",
+		Year:   "2015",
+		Fields: map[string]interface{}{"shortTitle": nil},
+	})
+	defer server.Close()
+
+	pubs, err := catalog(server).PublicationSearch()
+	if err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+	if len(pubs) != 1 || pubs[0].Publication != "Unknown" {
+		t.Errorf("Expected a publication with an unknown title; got %v.",
+			pubs)
+	}
+}
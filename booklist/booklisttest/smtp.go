@@ -0,0 +1,279 @@
+/*
+Package booklisttest provides a fake CARL.X catalog for testing code that
+searches a library's catalog using the booklist package.
+
+This file contains a fake SMTP server for testing the email notifier.  It
+accepts the messages sent to it, without delivering them, and records them
+so a test can make assertions about the envelope and contents.  If
+credentials are set with SetCredentials, clients must log in with AUTH
+PLAIN before sending.
+STARTTLS isn't supported.
+
+A typical test:
+
+	server := booklisttest.NewSMTPServer()
+	defer server.Close()
+
+	notifier, err := booklist.NewEmailNotifier(booklist.EmailConfig{
+	    Server: server.Host,
+	    Port:   server.Port,
+	    From:   "booklist@example.com",
+	    To:     []string{"me@example.com"},
+	})
+	...
+	messages := server.Messages()
+*/
+package booklisttest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is a message received by the fake SMTP server.
+type Message struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// SMTPServer is a fake SMTP server listening on the loopback interface.
+type SMTPServer struct {
+	// Addr is the server's address; Host and Port are its parts.
+	Addr string
+	Host string
+	Port int
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	messages []Message
+
+	// username and password, if username isn't empty, are the
+	// credentials required to send a message.
+	username string
+	password string
+}
+
+// NewSMTPServer starts and returns a fake SMTP server.  The caller should
+// call Close when finished, to shut it down.
+func NewSMTPServer() *SMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("booklisttest: failed to listen on a port: " + err.Error())
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &SMTPServer{
+		Addr:     listener.Addr().String(),
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = true
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	return s
+}
+
+// Close shuts down the server, closing any open connections.
+func (s *SMTPServer) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Messages returns the messages received so far, in the order received.
+func (s *SMTPServer) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the messages received so far.
+func (s *SMTPServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+// SetCredentials sets the username and password clients must log in with
+// before sending; an empty username lets them send without logging in.
+// The credentials apply to the connections made after they're set.
+func (s *SMTPServer) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// serve handles the SMTP commands of a connection.
+func (s *SMTPServer) serve(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	s.mu.Lock()
+	username, password := s.username, s.password
+	s.mu.Unlock()
+	authenticated := username == ""
+	var message *Message
+	reply := func(code int, line string) bool {
+		return text.PrintfLine("%d %s", code, line) == nil
+	}
+
+	if !reply(220, "booklisttest ESMTP") {
+		return
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			verb, arg = line[:i], line[i+1:]
+		}
+
+		ok := true
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			extensions := []string{"booklisttest", "8BITMIME"}
+			if username != "" {
+				extensions = append(extensions, "AUTH PLAIN")
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				if text.PrintfLine("250%s%s", separator, extension) != nil {
+					return
+				}
+			}
+		case "HELO", "NOOP":
+			ok = reply(250, "OK")
+		case "AUTH":
+			authenticated = authenticate(text, arg, username, password)
+			if authenticated {
+				ok = reply(235, "Authentication succeeded")
+			} else {
+				ok = reply(535, "Authentication failed")
+			}
+		case "MAIL":
+			if !authenticated {
+				ok = reply(530, "Authentication required")
+				break
+			}
+			message = &Message{From: address(arg)}
+			ok = reply(250, "OK")
+		case "RCPT":
+			if message == nil {
+				ok = reply(503, "MAIL first")
+				break
+			}
+			message.To = append(message.To, address(arg))
+			ok = reply(250, "OK")
+		case "DATA":
+			if message == nil || len(message.To) == 0 {
+				ok = reply(503, "RCPT first")
+				break
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, *message)
+			s.mu.Unlock()
+			message = nil
+			ok = reply(250, "OK")
+		case "RSET":
+			message = nil
+			ok = reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			ok = reply(502, "Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// authenticate checks the credentials given with AUTH PLAIN against the
+// username and password.
+func authenticate(text *textproto.Conn, arg, username, password string) bool {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != "PLAIN" {
+		return false
+	}
+	response := ""
+	if len(fields) > 1 {
+		response = fields[1]
+	} else {
+		if text.PrintfLine("334 ") != nil {
+			return false
+		}
+		line, err := text.ReadLine()
+		if err != nil {
+			return false
+		}
+		response = line
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return false
+	}
+	parts := bytes.Split(decoded, []byte{0})
+	return len(parts) == 3 && string(parts[1]) == username &&
+		string(parts[2]) == password
+}
+
+// address returns the address in a MAIL FROM or RCPT TO argument, e.g.,
+// 'me@example.com' for 'FROM:<me@example.com>'.
+func address(arg string) string {
+	if i := strings.IndexByte(arg, '<'); i != -1 {
+		if j := strings.IndexByte(arg[i:], '>'); j != -1 {
+			return arg[i+1 : i+j]
+		}
+	}
+	if i := strings.IndexByte(arg, ':'); i != -1 {
+		return strings.TrimSpace(arg[i+1:])
+	}
+	return arg
+}
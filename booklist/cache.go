@@ -0,0 +1,145 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains an HTTP transport that caches the catalog's responses in
+the cache directory; see CacheDir.  A search repeated while its responses
+are still fresh, e.g., while trying out a config file or a notifier, is
+answered from the cache rather than by the library's website.
+
+Each successful response is kept in its own file, named by a hash of the
+request; requests are matched as by a Replayer, ignoring the 'cache
+buster'.  The files can be deleted at any time.
+*/
+package booklist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// responsesDir is the name of the directory, in the cache directory,
+// holding the cached responses.
+const responsesDir = "responses"
+
+// ResponseCacheDir returns the directory holding the cached responses.
+func ResponseCacheDir() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, responsesDir), nil
+}
+
+// ResponseCache is an http.RoundTripper that answers a request from the
+// response cached for it, if that's no older than MaxAge, or else passes it
+// on to the underlying transport and caches the response.  A response that
+// can't be cached doesn't fail the request; the error is returned by Err
+// instead.
+type ResponseCache struct {
+	// Transport issues the requests; http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	// Dir is the directory the responses are cached in; it's created
+	// when the first response is cached.
+	Dir string
+
+	// MaxAge is how long a cached response is used for.
+	MaxAge time.Duration
+
+	mu sync.Mutex
+
+	// writeErr is the first error caching a response.
+	writeErr error
+}
+
+// NewResponseCache returns a ResponseCache that issues requests using the
+// given transport and caches the responses in dir for maxAge.
+func NewResponseCache(transport http.RoundTripper, dir string, maxAge time.Duration) *ResponseCache {
+	return &ResponseCache{Transport: transport, Dir: dir, MaxAge: maxAge}
+}
+
+// RoundTrip returns the cached response to the request, or issues it and
+// caches a successful response.
+func (c *ResponseCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(requestKey(req.Method, recordedURL(req.URL),
+		reqBody)))
+	fileName := filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+	if cached, ok := c.load(fileName); ok {
+		return cached.response(req), nil
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	cached := RecordedResponse{StatusCode: resp.StatusCode, Header: header}
+	cached.Body, cached.Text = splitBody(respBody)
+	c.save(fileName, cached)
+	return resp, nil
+}
+
+// Err returns the first error caching a response, or nil if every
+// response was cached.
+func (c *ResponseCache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeErr
+}
+
+// load returns the response cached in the file, if it's fresh.  A file
+// that can't be read is treated as if nothing was cached.
+func (c *ResponseCache) load(fileName string) (RecordedResponse, bool) {
+	var cached RecordedResponse
+	info, err := os.Stat(fileName)
+	if err != nil || time.Since(info.ModTime()) > c.MaxAge {
+		return cached, false
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil || json.Unmarshal(content, &cached) != nil {
+		return cached, false
+	}
+	return cached, true
+}
+
+// save caches the response in the file.  A failure to write it is kept
+// for Err.
+func (c *ResponseCache) save(fileName string, cached RecordedResponse) {
+	content, err := json.Marshal(cached)
+	if err == nil {
+		err = os.MkdirAll(c.Dir, 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(fileName, append(content, '\n'), 0644)
+	}
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.writeErr == nil {
+			c.writeErr = fmt.Errorf("unable to cache the response in "+
+				"%s:  %s", fileName, err)
+		}
+	}
+}
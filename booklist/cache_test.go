@@ -0,0 +1,98 @@
+// Unit tests related to caching the catalog's responses. //
+package booklist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Log("a repeated search is answered from the cache.")
+	requests := 0
+	ts := newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"success": true, "totalHits": 1}`)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"resources": [{"shortAuthor": "Grafton, Sue",
+		    "shortTitle": "X", "format": "Book"}]}`)
+	})
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "responses")
+	cache := NewResponseCache(nil, dir, time.Hour)
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: cache}
+	first, err := c.PublicationSearch()
+	if err != nil || requests != 2 {
+		t.Fatalf("Expected the search to make 2 requests; got %d, %v.",
+			requests, err)
+	}
+	cached, err := c.PublicationSearch()
+	if err != nil || len(cached) != 1 || cached[0] != first[0] {
+		t.Errorf("Expected the cached results %v; got %v, %v.", first,
+			cached, err)
+	}
+	if requests != 2 || cache.Err() != nil {
+		t.Errorf("Expected no more requests; got %d, %v.", requests,
+			cache.Err())
+	}
+
+	t.Log("stale responses are requested again.")
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 cached responses; got %d.", len(files))
+	}
+	stale := time.Now().Add(-2 * time.Hour)
+	for _, file := range files {
+		os.Chtimes(filepath.Join(dir, file.Name()), stale, stale)
+	}
+	if _, err := c.PublicationSearch(); err != nil || requests != 4 {
+		t.Errorf("Expected 2 more requests; got %d, %v.", requests-2, err)
+	}
+}
+
+func TestResponseCacheErrors(t *testing.T) {
+	t.Log("failed responses aren't cached.")
+	requests := 0
+	ts := newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}, replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "responses")
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: NewResponseCache(nil, dir, time.Hour)}
+	for i := 0; i < 2; i++ {
+		if _, err := c.PublicationSearch(); err == nil {
+			t.Errorf("Expected the search to fail.")
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected each search to make a request; got %d.", requests)
+	}
+
+	t.Log("a response that can't be cached doesn't fail the search.")
+	ts = newErrorServer(replyWith(`{"success": true, "totalHits": 0}`),
+		replyWith(`{"resources": []}`))
+	defer ts.Close()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewResponseCache(nil, filepath.Join(file, "responses"), time.Hour)
+	c = testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: cache}
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Errorf("Expected the search to succeed; got %s.", err)
+	}
+	if cache.Err() == nil {
+		t.Errorf("Expected an error caching the response.")
+	}
+}
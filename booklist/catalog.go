@@ -15,9 +15,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
-
-	"github.com/op/go-logging"
 )
 
 const (
@@ -33,23 +33,55 @@ var (
 	// microsecond precision an increment is used.
 	timestampIncrement int64 = 1
 
-	// CurrentYear is current year as a string; used in filtering.
-	CurrentYear = time.Now().UTC().Format("2006")
+	// CurrentYear is the year booklist started in, as a string; it's the
+	// default year of a search.  Use ThisYear for the year at the time
+	// of a search made by a long running program.
+	CurrentYear = ThisYear()
 )
 
+// ThisYear returns the current year as a string.
+func ThisYear() string {
+	return time.Now().UTC().Format("2006")
+}
+
 // PublicationInfo provides the name and media type for a given publication.
+// RecordID identifies the publication's record in the catalog, if known;
+// see RecordURL.  Date is the publication date given by the catalog, if
+// any, as is; it's usually a year, but may be the expected date of a
+// future release; see ParseReleaseDate.
 type PublicationInfo struct {
 	Media       string
 	Publication string
+	RecordID    string `json:",omitempty"`
+	Date        string `json:",omitempty"`
+}
+
+// RecordURL returns the URL of a publication's record in the catalog with
+// the given url, or the catalog's url if the record isn't known.
+func RecordURL(catalogURL, recordID string) string {
+	if recordID == "" {
+		return catalogURL
+	}
+	return catalogURL + "?section=resource&resourceid=" +
+		url.QueryEscape(recordID)
 }
 
 // CatalogInfo provides the info needed to search for a given author and media.
+//
+// Client is used to issue the requests; if nil, a client with a default
+// timeout is used.  Drift, if not nil, counts the resources returned that
+// are missing expected fields.  Metrics, if not nil, records the requests.
+// The search is logged to Log, with the author, media type and year; if
+// Log is nil, nothing is logged.
 type CatalogInfo struct {
-	URL    string
-	Author string
-	Media  string
-	Year   string
-	Log    *logging.Logger
+	URL     string
+	Author  string
+	Media   string
+	Year    string
+	Log     Logger
+	Client  *http.Client
+	Drift   *DriftStats
+	Metrics *Metrics
 }
 
 // facetFilter represents a map of filters used as POST JSON data.
@@ -91,10 +123,13 @@ func (c CatalogInfo) PublicationSearch() ([]PublicationInfo, error) {
 			c.URL, c.Author, c.Media, c.Year)
 	}
 
+	start := time.Now()
+	c.log(LevelInfo, "Searching the catalog", nil)
+
 	// If the search year is the current year, the search should
 	// include a publication date of "unknown" as well.
 	var years = []string{c.Year}
-	if c.Year == CurrentYear {
+	if c.Year == ThisYear() {
 		years = append(years, "unknown")
 	}
 
@@ -128,16 +163,24 @@ func (c CatalogInfo) PublicationSearch() ([]PublicationInfo, error) {
 		}
 
 		// Loop issuing requests until all the publications have been
-		// retrieved
+		// retrieved; each request starts where the prior page ended.
+		// An empty page means the catalog has nothing more to give even
+		// if it promised more, so stop rather than ask again.
 		currentCount := 0
 		for currentCount < totalCount {
-			pubs, err := c.publications(filters)
+			pubs, err := c.publications(filters, currentCount)
 			if err != nil {
 				return nil, err
 			}
+			if len(pubs) == 0 {
+				break
+			}
 
 			currentCount += len(pubs)
-			c.Log.Debug("currentCount: %d", currentCount)
+			c.log(LevelDebug, "Retrieved publications", Fields{
+				"year":  year,
+				"count": currentCount,
+			})
 
 			// Apply additional filters that can't be handled in
 			// POST request.
@@ -146,12 +189,15 @@ func (c CatalogInfo) PublicationSearch() ([]PublicationInfo, error) {
 
 		// Retrieved more publications than expected?
 		if currentCount > totalCount {
-			return nil, fmt.Errorf("Received more publications "+
-				"than expected; expected %d currently have %d",
-				totalCount, currentCount)
+			return nil, fmt.Errorf("%w; expected %d currently have %d",
+				ErrCountMismatch, totalCount, currentCount)
 		}
 	}
 
+	c.log(LevelInfo, "Search finished", Fields{
+		"count":    len(filteredPubs),
+		"duration": time.Since(start),
+	})
 	return filteredPubs, nil
 }
 
@@ -163,22 +209,25 @@ func (c CatalogInfo) publicationsCount(filters []facetFilter) (int, error) {
 	}
 	results := new(hitResults)
 
-	err := c.issueRequest("search/count", filters, &results)
+	err := c.issueRequest("search/count", filters, 0, &results)
 	if err != nil {
 		return 0, err
 	}
 
 	if !results.Success {
-		return 0, fmt.Errorf("failed to retrieve total number " +
-			"of matches on author, media and year")
+		return 0, fmt.Errorf("failed to retrieve total number "+
+			"of matches on author, media and year: %w", ErrSearchRejected)
 	}
 
-	c.Log.Debugf("Expected number of matches:  %d", results.Count)
+	c.log(LevelDebug, "Expected number of matches", Fields{
+		"count": results.Count,
+	})
 	return results.Count, nil
 }
 
-// publications requests a page of publications for the given author.
-func (c CatalogInfo) publications(filters []facetFilter) ([]resourceInfo, error) {
+// publications requests a page of publications for the given author
+// beginning with the publication at startIndex.
+func (c CatalogInfo) publications(filters []facetFilter, startIndex int) ([]resourceInfo, error) {
 	type searchResults struct {
 		totalHits    int
 		facetFilters []facetFilter
@@ -186,11 +235,13 @@ func (c CatalogInfo) publications(filters []facetFilter) ([]resourceInfo, error)
 	}
 	results := new(searchResults)
 
-	err := c.issueRequest("search", filters, &results)
+	err := c.issueRequest("search", filters, startIndex, &results)
 	if err != nil {
 		return nil, err
 	}
-	c.Log.Debugf("Number of resources found: %d", len(results.Resources))
+	c.log(LevelDebug, "Resources found", Fields{
+		"count": len(results.Resources),
+	})
 	return results.Resources, nil
 }
 
@@ -202,10 +253,19 @@ func (c CatalogInfo) publications(filters []facetFilter) ([]resourceInfo, error)
 // an exact match shouldn't be performed on the name.
 //
 // Additionally, check for missing dictionary values for title and
-// media type and use 'Unknown' as a replacement.
+// media type and use 'Unknown' as a replacement.  Missing values are
+// counted in the drift statistics.
 //
 func (c CatalogInfo) applyLocalFilters(pubs []resourceInfo, filteredResults *[]PublicationInfo) {
 	for _, publication := range pubs {
+		var missingFields []string
+		for _, field := range ExpectedFields {
+			if _, ok := publication[field].(string); !ok {
+				missingFields = append(missingFields, field)
+			}
+		}
+		c.Drift.add(missingFields)
+
 		// Some books don't have authors - don't know why,
 		// but 'The Mystery Writers of America cookbook' is one
 		// of them; it shows up in a search for Sue Grafton.
@@ -226,17 +286,34 @@ func (c CatalogInfo) applyLocalFilters(pubs []resourceInfo, filteredResults *[]P
 		}
 
 		if c.Author == author {
-			c.Log.Debugf("media:  %s, title:  %s", format, title)
+			c.log(LevelDebug, "Publication found", Fields{
+				"format": format,
+				"title":  title,
+			})
 			*filteredResults = append(*filteredResults, PublicationInfo{
 				Media:       format,
 				Publication: title,
+				RecordID:    recordID(publication["id"]),
+				Date:        releaseDate(publication),
 			})
 		}
 	}
 }
 
+// recordID returns the ID of a resource, which may be a number or a
+// string, or an empty string if it has none.
+func recordID(id interface{}) string {
+	switch id := id.(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return ""
+}
+
 // issueRequest issues a post request and checks for an error in the response.
-func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, target interface{}) error {
+func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, startIndex int, target interface{}) error {
 
 	// Create the url that includes the given endpoint and add the
 	// 'cache buster' timestamp parameter.
@@ -255,6 +332,7 @@ func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, target in
 		AddToHistory: true,
 		HitsPerPage:  maxHitsPerPage,
 		SortCriteria: "NewlyAdded",
+		StartIndex:   startIndex,
 		FacetFilters: filters,
 		SearchTerm:   c.Author,
 	}
@@ -269,6 +347,9 @@ func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, target in
 	// value.  The POST request will contain the search filter in json
 	// format.
 	req, err := http.NewRequest("POST", u.String(), b)
+	if err != nil {
+		return err
+	}
 
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
@@ -278,31 +359,58 @@ func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, target in
 	req.Header.Set("Ls2pac-config-name", "default - Go Live load")
 	req.Header.Set("Referer", c.URL)
 
-	var client = &http.Client{
-		Timeout: time.Second * 10,
+	var client = c.Client
+	if client == nil {
+		client = &http.Client{
+			Timeout: time.Second * 10,
+		}
 	}
+	c.log(LevelTrace, "Catalog request", Fields{
+		"endpoint": endpt,
+		"url":      u.String(),
+		"body":     string(bytes.TrimSpace(b.Bytes())),
+	})
+	start := time.Now()
 	resp, err := client.Do(req)
-	if err != nil || resp == nil || resp.StatusCode != http.StatusOK {
-		var newErr error
-		if err != nil {
-			newErr = fmt.Errorf("POST request '%s' failed; %s", u, err)
-		} else {
-			newErr = fmt.Errorf("POST request '%s' failed; "+
-				"HTTP error: %s",
-				u, http.StatusText(resp.StatusCode))
-		}
-		return newErr
+	duration := time.Since(start)
+	if err != nil {
+		c.Metrics.ObserveRequest(endpt, 0, duration)
+		c.log(LevelDebug, "Catalog request failed", Fields{
+			"endpoint": endpt,
+			"duration": duration,
+			"error":    err,
+		})
+		return &RequestError{URL: u.String(), Err: err}
 	}
 	defer resp.Body.Close()
+	c.Metrics.ObserveRequest(endpt, resp.StatusCode, duration)
+	c.log(LevelDebug, "Catalog response", Fields{
+		"endpoint": endpt,
+		"status":   resp.StatusCode,
+		"duration": duration,
+	})
+
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{URL: u.String(), StatusCode: resp.StatusCode}
+	}
 
 	err = json.NewDecoder(resp.Body).Decode(target)
 	if err != nil {
-		return fmt.Errorf("unable to decode response to '%s': "+
-			"response %#v, error: %s", c.URL, resp, err)
+		return &DecodeError{URL: u.String(), Err: err}
 	}
 	return nil
 }
 
+// log logs a message about the search, with the author, media type and
+// year searched for as well as the given fields.
+func (c CatalogInfo) log(level Level, message string, fields Fields) {
+	all := Fields{"author": c.Author, "media": c.Media, "year": c.Year}
+	for name, value := range fields {
+		all[name] = value
+	}
+	orNop(c.Log).Log(level, message, all)
+}
+
 // Return a 13-digit timestamp; used as a 'cache buster' in requests.
 //
 // With the CARL.X system, the parameter '_' in a request appears to
@@ -315,8 +423,8 @@ func (c CatalogInfo) issueRequest(endpt string, filters []facetFilter, target in
 // end of the number, so we add an increment to the end to keep successive
 // requests unique.
 func makeTimestamp() string {
-	timestampIncrement++
+	increment := atomic.AddInt64(&timestampIncrement, 1)
 	utcTime := time.Now().UTC().UnixNano()
 	timestamp := utcTime / (int64(time.Millisecond) / int64(time.Nanosecond))
-	return fmt.Sprintf("%d", timestamp+timestampIncrement)
+	return fmt.Sprintf("%d", timestamp+increment)
 }
@@ -2,41 +2,72 @@
 package booklist
 
 import (
+	"flag"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
+)
 
-	"github.com/op/go-logging"
+var (
+	liveFlag = flag.Bool("live", false,
+		"search the library's website rather than replaying fixtures")
+	recordFlag = flag.Bool("record", false,
+		"with -live, save the exchanges to the fixtures in testdata")
 )
 
-var testLog *logging.Logger
+var testLog Logger
 
 func init() {
-	testLog = logging.MustGetLogger("catalog_test")
+	var err error
+	testLog, err = NewWriterLogger(ioutil.Discard, LevelTrace, LogText)
+	if err != nil {
+		panic(err)
+	}
+}
 
-	testBackendLog := logging.NewLogBackend(ioutil.Discard, "", 0)
-	logLevel := logging.AddModuleLevel(testBackendLog)
-	logLevel.SetLevel(0, "")
+// fixtureClient returns a client that replays the given fixture file, or
+// with -live, a client that connects to the library's website.  With
+// -record as well, the exchanges are saved to the fixture file when the
+// test completes.
+func fixtureClient(t *testing.T, fileName string) *http.Client {
+	if *liveFlag {
+		if !*recordFlag {
+			return nil
+		}
+		recorder := NewRecorder(nil)
+		t.Cleanup(func() {
+			if err := recorder.Save(fileName); err != nil {
+				t.Errorf("Unable to save fixture %s: %s", fileName, err)
+			}
+		})
+		return &http.Client{Transport: recorder}
+	}
 
-	testLog.SetBackend(logLevel)
+	fixture, err := LoadFixture(fileName)
+	if err != nil {
+		t.Fatalf("Unable to load fixture: %s", err)
+	}
+	return &http.Client{Transport: NewReplayer(fixture)}
 }
 
 func TestLiveGoodSearch(t *testing.T) {
-	t.Log("test search using good configuration file and real connection.")
-	// Note:  Because this is a live search, it could fail if sometime
-	// in the future the library removes the expected books from their
+	t.Log("test search using good configuration file and recorded connection.")
+	// Note:  When run with -live, this could fail if sometime in the
+	// future the library removes the expected books from their
 	// inventory.  The probability of that happening is reduced by
 	// specifying a year that's not too far in the past and using a
 	// popular author.
 	expected := []PublicationInfo{
-		{"Large Print", "J is for judgment"},
-		{"Large Print", "K is for killer : a Kinsey Millhone mystery"},
-		{"Large Print", "L is for lawless"},
-		{"Large Print", "M is for malice : a Kinsey Millhone mystery"},
-		{"Large Print", "N is for noose a Kinsey Millhone mystery"},
-		{"Large Print", "O is for outlaw"},
-		{"Book", "X"},
-		{"Large Print", "X"},
+		{Media: "Large Print", Publication: "J is for judgment"},
+		{Media: "Large Print", Publication: "K is for killer : a Kinsey Millhone mystery"},
+		{Media: "Large Print", Publication: "L is for lawless"},
+		{Media: "Large Print", Publication: "M is for malice : a Kinsey Millhone mystery"},
+		{Media: "Large Print", Publication: "N is for noose a Kinsey Millhone mystery"},
+		{Media: "Large Print", Publication: "O is for outlaw"},
+		{Media: "Book", Publication: "X"},
+		{Media: "Large Print", Publication: "X"},
 	}
 
 	liveURL := "https://catalog.library.loudoun.gov/"
@@ -46,11 +77,16 @@ func TestLiveGoodSearch(t *testing.T) {
 		Media:  "Book",
 		Year:   "2015",
 		Log:    testLog,
+		Client: fixtureClient(t, "testdata/grafton_2015.json"),
 	}
 	pubInfo, err := c.PublicationSearch()
 	if err != nil {
 		t.Errorf("Test of live search at '%s' failed: %s.", liveURL, err)
 	}
+	if len(pubInfo) != len(expected) {
+		t.Fatalf("Expected %d publications, got %d.", len(expected),
+			len(pubInfo))
+	}
 
 	for i, info := range pubInfo {
 		if info.Media != expected[i].Media {
@@ -62,6 +98,21 @@ func TestLiveGoodSearch(t *testing.T) {
 				info.Publication, expected[i].Publication)
 		}
 	}
+	if pubInfo[0].RecordID != "2093410" {
+		t.Errorf("Expected record ID 2093410, got '%s'.", pubInfo[0].RecordID)
+	}
+}
+
+func TestRecordURL(t *testing.T) {
+	t.Log("the record URL links to the publication's page in the catalog.")
+	catalogURL := "https://catalog.library.loudoun.gov/"
+	expected := catalogURL + "?section=resource&resourceid=2093410"
+	if got := RecordURL(catalogURL, "2093410"); got != expected {
+		t.Errorf("Expected %s, got %s.", expected, got)
+	}
+	if got := RecordURL(catalogURL, ""); got != catalogURL {
+		t.Errorf("Expected %s without a record, got %s.", catalogURL, got)
+	}
 }
 
 func TestBadURL(t *testing.T) {
@@ -120,3 +171,27 @@ func TestMissingInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeTimestamp(t *testing.T) {
+	t.Log("concurrent searches get different cache busters.")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				timestamp := makeTimestamp()
+				mu.Lock()
+				if seen[timestamp] {
+					t.Errorf("Expected unique timestamps; got %s twice.",
+						timestamp)
+				}
+				seen[timestamp] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,423 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains a more thorough check of the configuration file than
+ValidateConfig.  Each problem found is reported with the line and column
+in the file where it occurs.  In addition to the schema validation, the
+check finds:
+
+  - keys that aren't part of the configuration, e.g., a misspelled
+    'lastnme', which are otherwise silently ignored,
+  - authors listed more than once,
+  - authors routed to notifiers that aren't configured, and webhooks with
+    the same name,
+  - suspicious values that are allowed but probably a mistake, e.g.,
+    a firstname containing a comma, as in 'Grafton, Sue'.
+
+Only the given file is checked; the files it includes aren't read.
+*/
+package booklist
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an error or warning found in the configuration file.  Line
+// and Column are zero if the location is unknown.  Field is the path of
+// the offending value, e.g., 'Authors.1.Lastname'.
+type Problem struct {
+	Line    int
+	Column  int
+	Field   string
+	Message string
+	Warning bool
+}
+
+// Stringer function for Problem struct.
+func (p Problem) String() string {
+	var parts []string
+	if p.Line != 0 {
+		parts = append(parts, fmt.Sprintf("%d:%d", p.Line, p.Column))
+	}
+	if p.Warning {
+		parts = append(parts, "warning")
+	} else {
+		parts = append(parts, "error")
+	}
+	if p.Field != "" {
+		parts = append(parts, p.Field)
+	}
+	parts = append(parts, p.Message)
+	return strings.Join(parts, ": ")
+}
+
+// configKeys maps the fields of the Config and AuthorInfo structures to
+// their YAML keys.
+var configKeys = map[string]string{
+	"URL":       "catalog-url",
+	"Media":     "media-type",
+	"Authors":   "authors",
+	"Firstname": "firstname",
+	"Version":   "version",
+	"Lastname":  "lastname",
+	"TokenEnv":  "token-env",
+}
+
+// allowedKeys lists the keys allowed at the top level of the file, in an
+// entry in the authors list and in the notifiers' configuration.
+var allowedKeys = struct {
+	top, author, notify, email, webhook []string
+}{
+	top: []string{"version", "catalog-url", "media-type", "authors",
+		"include", "notify"},
+	author: []string{"firstname", "lastname", "media-type", "notify"},
+	notify: []string{"email", "webhooks"},
+	email: []string{"server", "port", "starttls", "username",
+		"password-env", "from", "to", "subject", "only-new",
+		"html-template", "text-template"},
+	webhook: []string{"name", "url", "format", "token-env", "only-new",
+		"retries"},
+}
+
+// yamlLine extracts the line number from a parsing error.
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// CheckConfig checks the YAML file contents and returns the problems
+// found, ordered by their location in the file.  The file is valid if
+// none of the problems are errors.
+func CheckConfig(in []byte) []Problem {
+	return CheckConfigFormat(in, ConfigYAML)
+}
+
+// CheckConfigFormat checks the file contents, in one of ConfigFormats, as
+// for CheckConfig.
+func CheckConfigFormat(in []byte, format string) []Problem {
+	config, root, err := parseConfig(in, format)
+	if err != nil {
+		problem := Problem{Message: err.Error()}
+		if match := yamlLine.FindStringSubmatch(err.Error()); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+		}
+		return []Problem{problem}
+	}
+
+	var problems []Problem
+	resultErrors, err := validateSchema(config)
+	if err != nil {
+		problem := Problem{Field: "Version", Message: err.Error()}
+		if node := mappingValue(documentNode(root), "version"); node != nil {
+			problem.Line, problem.Column = node.Line, node.Column
+		}
+		return []Problem{problem}
+	}
+	for _, resultErr := range resultErrors {
+		if includedKey(root, resultErr) {
+			continue
+		}
+		problems = append(problems, schemaProblem(root, resultErr))
+	}
+
+	problems = append(problems, unknownKeys(root)...)
+	problems = append(problems, duplicateAuthors(root, config)...)
+	problems = append(problems, notifierProblems(root, config)...)
+	problems = append(problems, suspiciousValues(root, config)...)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+// includedKey returns whether the schema error is for a required key that's
+// missing from a file with includes; the key may be set by the included
+// files, which are checked when the configuration is loaded.
+func includedKey(root *yaml.Node, resultErr gojsonschema.ResultError) bool {
+	top := documentNode(root)
+	if mappingValue(top, "include") == nil {
+		return false
+	}
+	field := strings.SplitN(resultErr.Field(), ".", 2)[0]
+	return field == "(root)" || mappingValue(top, configKeys[field]) == nil
+}
+
+// HasErrors returns whether any of the problems are errors.
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if !problem.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaProblem converts a schema validation error into a Problem located
+// at the node for the offending field.
+func schemaProblem(root *yaml.Node, resultErr gojsonschema.ResultError) Problem {
+	field := resultErr.Field()
+	node := fieldNode(root, field)
+
+	problem := Problem{
+		Field:   field,
+		Message: resultErr.Description(),
+	}
+	if node != nil {
+		problem.Line, problem.Column = node.Line, node.Column
+	}
+	return problem
+}
+
+// fieldNode returns the YAML node for a field path such as
+// 'Authors.1.Lastname', or the closest enclosing node that exists.
+func fieldNode(root *yaml.Node, field string) *yaml.Node {
+	return nodeAt(documentNode(root), field)
+}
+
+// nodeAt returns the node for a field path relative to the given node, or
+// the closest enclosing node that exists.
+func nodeAt(node *yaml.Node, field string) *yaml.Node {
+	if node == nil || field == "" || field == "(root)" {
+		return node
+	}
+
+	for _, part := range strings.Split(field, ".") {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			key := configKeys[part]
+			if key == "" {
+				key = strings.ToLower(part)
+			}
+			next = mappingValue(node, key)
+			if next == nil {
+				// The same field name may have a different key
+				// elsewhere, e.g., a webhook's URL.
+				next = mappingValue(node, strings.ToLower(part))
+			}
+		case yaml.SequenceNode:
+			if index, err := strconv.Atoi(part); err == nil &&
+				index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node
+}
+
+// documentNode returns the top level mapping of the document, or nil if
+// the document is empty.
+func documentNode(root *yaml.Node) *yaml.Node {
+	if root == nil {
+		return nil
+	}
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil
+		}
+		return root.Content[0]
+	}
+	return root
+}
+
+// mappingValue returns the value node for the given key in a mapping node,
+// or nil if the mapping doesn't contain the key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// unknownKeys reports keys that aren't part of the configuration.
+func unknownKeys(root *yaml.Node) []Problem {
+	var problems []Problem
+	check := func(node *yaml.Node, allowed []string, field string) {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if containsString(allowed, key.Value) {
+				continue
+			}
+			problems = append(problems, Problem{
+				Line:   key.Line,
+				Column: key.Column,
+				Field:  field,
+				Message: fmt.Sprintf("unknown key '%s'; allowed keys "+
+					"are %s", key.Value, strings.Join(allowed, ", ")),
+			})
+		}
+	}
+
+	top := documentNode(root)
+	check(top, allowedKeys.top, "")
+	if authors := mappingValue(top, "authors"); authors != nil &&
+		authors.Kind == yaml.SequenceNode {
+		for i, author := range authors.Content {
+			check(author, allowedKeys.author, fmt.Sprintf("Authors.%d", i))
+		}
+	}
+	notify := mappingValue(top, "notify")
+	check(notify, allowedKeys.notify, "Notify")
+	check(mappingValue(notify, "email"), allowedKeys.email, "Notify.Email")
+	if webhooks := mappingValue(notify, "webhooks"); webhooks != nil &&
+		webhooks.Kind == yaml.SequenceNode {
+		for i, webhook := range webhooks.Content {
+			check(webhook, allowedKeys.webhook,
+				fmt.Sprintf("Notify.Webhooks.%d", i))
+		}
+	}
+	return problems
+}
+
+// duplicateAuthors reports authors listed more than once; the names are
+// compared ignoring case and surrounding spaces.
+func duplicateAuthors(root *yaml.Node, config Config) []Problem {
+	var problems []Problem
+	seen := make(map[string]int)
+	for i, author := range config.Authors {
+		name := authorKey(author.Firstname, author.Lastname)
+		first, ok := seen[name]
+		if !ok {
+			seen[name] = i
+			continue
+		}
+
+		field := fmt.Sprintf("Authors.%d", i)
+		problem := Problem{
+			Field: field,
+			Message: fmt.Sprintf("author '%s %s' is a duplicate of "+
+				"Authors.%d", author.Firstname, author.Lastname, first),
+		}
+		if node := fieldNode(root, field); node != nil {
+			problem.Line, problem.Column = node.Line, node.Column
+			if firstNode := fieldNode(root, fmt.Sprintf("Authors.%d", first)); firstNode != nil {
+				problem.Message += fmt.Sprintf(" on line %d", firstNode.Line)
+			}
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// notifierProblems reports webhooks with the same name and authors routed
+// to notifiers that aren't configured.  If the file includes others and
+// doesn't configure the notifiers itself, the routes can't be checked.
+func notifierProblems(root *yaml.Node, config Config) []Problem {
+	var problems []Problem
+	report := func(field, format string, args ...interface{}) {
+		problem := Problem{Field: field, Message: fmt.Sprintf(format, args...)}
+		if node := fieldNode(root, field); node != nil {
+			problem.Line, problem.Column = node.Line, node.Column
+		}
+		problems = append(problems, problem)
+	}
+
+	if config.Notify != nil {
+		seen := make(map[string]bool)
+		if config.Notify.Email != nil {
+			seen[EmailNotifierName] = true
+		}
+		for i, webhook := range config.Notify.Webhooks {
+			if seen[webhook.Name] {
+				report(fmt.Sprintf("Notify.Webhooks.%d.Name", i),
+					"notifier name '%s' is used more than once",
+					webhook.Name)
+			}
+			seen[webhook.Name] = true
+		}
+	}
+
+	if config.Notify == nil && mappingValue(documentNode(root), "include") != nil {
+		return problems
+	}
+	for i, author := range config.Authors {
+		if name := unknownNotifier(config.Notify, author.Notify); name != "" {
+			report(fmt.Sprintf("Authors.%d.Notify", i), "notifier '%s' "+
+				"isn't configured; the notifiers are %s", name,
+				notifierList(config.Notify))
+		}
+	}
+	return problems
+}
+
+// suspiciousValues reports values that are valid but probably a mistake.
+func suspiciousValues(root *yaml.Node, config Config) []Problem {
+	var problems []Problem
+	warn := func(field, format string, args ...interface{}) {
+		problem := Problem{
+			Field:   field,
+			Message: fmt.Sprintf(format, args...),
+			Warning: true,
+		}
+		if node := fieldNode(root, field); node != nil {
+			problem.Line, problem.Column = node.Line, node.Column
+		}
+		problems = append(problems, problem)
+	}
+
+	if u, err := url.Parse(config.URL); err == nil && config.URL != "" {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			warn("URL", "catalog-url '%s' should begin with http:// "+
+				"or https://", config.URL)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			warn("URL", "catalog-url '%s' contains a query or fragment; "+
+				"it should be the catalog's base URL", config.URL)
+		}
+	}
+
+	for i, author := range config.Authors {
+		for _, name := range []struct{ field, value string }{
+			{fmt.Sprintf("Authors.%d.Firstname", i), author.Firstname},
+			{fmt.Sprintf("Authors.%d.Lastname", i), author.Lastname},
+		} {
+			trimmed := strings.TrimSpace(name.value)
+			switch {
+			case name.value == "":
+				// Reported by the schema validation.
+			case trimmed == "":
+				warn(name.field, "name is blank")
+			case strings.Contains(name.value, ","):
+				warn(name.field, "name '%s' contains a comma; firstname "+
+					"and lastname should be given separately", name.value)
+			case trimmed != name.value:
+				warn(name.field, "name '%s' has leading or trailing "+
+					"spaces", name.value)
+			case strings.IndexAny(name.value, "0123456789") >= 0:
+				warn(name.field, "name '%s' contains a digit", name.value)
+			}
+		}
+	}
+	return problems
+}
+
+// containsString returns whether the list contains the string.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Unit tests related to checking the configuration file. //
+package booklist
+
+import (
+	"strings"
+	"testing"
+)
+
+// findProblem returns the first problem whose message contains the text.
+func findProblem(problems []Problem, text string) (Problem, bool) {
+	for _, problem := range problems {
+		if strings.Contains(problem.Message, text) {
+			return problem, true
+		}
+	}
+	return Problem{}, false
+}
+
+func TestCheckGoodConfig(t *testing.T) {
+	t.Log("a good configuration file has no problems.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+media-type: Book
+authors:
+    - firstname: Sue
+      lastname:  Grafton
+      media-type: eBook
+`
+	problems := CheckConfig([]byte(configString))
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems; got %v.", problems)
+	}
+}
+
+func TestCheckSchemaLine(t *testing.T) {
+	t.Log("schema errors are reported with their line.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname:  Grafton
+    - firstname: Stephen
+      media-type: Vinyl
+`
+	problems := CheckConfig([]byte(configString))
+	if !HasErrors(problems) {
+		t.Fatalf("Expected errors; got %v.", problems)
+	}
+
+	problem, ok := findProblem(problems, "String length")
+	if !ok || problem.Field != "Authors.1.Lastname" || problem.Line != 6 {
+		t.Errorf("Expected missing lastname on line 6; got %v.", problems)
+	}
+	problem, ok = findProblem(problems, "Does not match format")
+	if !ok || problem.Line != 7 || problem.Column != 19 {
+		t.Errorf("Expected invalid media type at 7:19; got %v.", problems)
+	}
+}
+
+func TestCheckUnknownKeys(t *testing.T) {
+	t.Log("unknown keys are reported as errors.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+catalog: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname:  Grafton
+      lastnme:  Grafton
+`
+	problems := CheckConfig([]byte(configString))
+	problem, ok := findProblem(problems, "'catalog'")
+	if !ok || problem.Line != 3 || problem.Warning {
+		t.Errorf("Expected unknown key 'catalog' on line 3; got %v.",
+			problems)
+	}
+	problem, ok = findProblem(problems, "'lastnme'")
+	if !ok || problem.Line != 7 || problem.Column != 7 {
+		t.Errorf("Expected unknown key 'lastnme' at 7:7; got %v.", problems)
+	}
+}
+
+func TestCheckDuplicateAuthors(t *testing.T) {
+	t.Log("authors listed more than once are reported as errors.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname:  Grafton
+    - firstname: Stephen
+      lastname:  King
+    - firstname: sue
+      lastname:  GRAFTON
+`
+	problems := CheckConfig([]byte(configString))
+	problem, ok := findProblem(problems, "duplicate")
+	if !ok || problem.Line != 8 || problem.Warning {
+		t.Fatalf("Expected duplicate author on line 8; got %v.", problems)
+	}
+	if !strings.Contains(problem.Message, "line 4") {
+		t.Errorf("Expected the first occurrence's line; got %s.",
+			problem.Message)
+	}
+}
+
+func TestCheckSuspiciousValues(t *testing.T) {
+	t.Log("suspicious values are reported as warnings.")
+	const configString = `
+catalog-url: ftp://catalog.library.loudoun.gov/
+authors:
+    - firstname: Grafton, Sue
+      lastname:  Grafton
+    - firstname: " Stephen"
+      lastname:  King
+`
+	problems := CheckConfig([]byte(configString))
+	if HasErrors(problems) {
+		t.Errorf("Expected only warnings; got %v.", problems)
+	}
+	for _, expected := range []struct {
+		text string
+		line int
+	}{
+		{"http://", 2},
+		{"comma", 4},
+		{"spaces", 6},
+	} {
+		problem, ok := findProblem(problems, expected.text)
+		if !ok || problem.Line != expected.line || !problem.Warning {
+			t.Errorf("Expected a warning containing '%s' on line %d; "+
+				"got %v.", expected.text, expected.line, problems)
+		}
+	}
+}
+
+func TestCheckParseError(t *testing.T) {
+	t.Log("YAML syntax errors are reported with their line.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+     lastname: Grafton
+`
+	problems := CheckConfig([]byte(configString))
+	if len(problems) != 1 || problems[0].Line == 0 {
+		t.Errorf("Expected one located parse error; got %v.", problems)
+	}
+}
+
+func TestCheckEmailRequired(t *testing.T) {
+	t.Log("an email notifier without a server or recipients is an error.")
+	const configString = `
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname:  Grafton
+notify:
+    email:
+        from: booklist@example.com
+`
+	problems := CheckConfig([]byte(configString))
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 errors; got %v.", problems)
+	}
+	problem, ok := findProblem(problems, "Server is required")
+	if !ok || problem.Warning || problem.Line != 8 {
+		t.Errorf("Expected a missing server on line 8; got %v.", problems)
+	}
+	problem, ok = findProblem(problems, "Invalid type")
+	if !ok || problem.Field != "Notify.Email.To" || problem.Line != 8 {
+		t.Errorf("Expected missing recipients on line 8; got %v.",
+			problems)
+	}
+}
@@ -11,6 +11,9 @@ The configuration file contains:
 
 The config file is expected to be in YAML format.  The tags are as follows:
 
+    version:
+	Required, except in version 1 files.  The version of the file's
+	format, currently 2; a file without a version is version 1.
     catalog-url:
 	Required.  Must be a valid URL for a website using the CARL.X
 	Integrated Library System.
@@ -41,9 +44,16 @@ The config file is expected to be in YAML format.  The tags are as follows:
 	    Required.  Last name of author.
 	media-type:
 	    Optional.  See media-type above for the allowed values.
+	notify:
+	    Optional.  List of the names of the notifiers the author's
+	    results are sent to; by default, they're sent to all of them.
+    notify:
+	Optional.  The notifiers that send the results of a search;
+	see notify.go.
 
 Example YAML config file:
 
+    version: 2
     catalog-url: https://catalog.library.loudoun.gov/
     media-type: Book
     authors:
@@ -63,7 +73,7 @@ import (
 	"strings"
 
 	"github.com/xeipuuv/gojsonschema"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -71,27 +81,36 @@ const (
 	DefaultMediaType = "Book"
 )
 
-// Config is the high level structure for the YAML config file.
+// Config is the high level structure for the YAML config file.  Version is
+// zero for a file without a version, i.e., version 1.
 type Config struct {
-	URL     string       `yaml:"catalog-url"`
-	Media   string       `yaml:"media-type,omitempty"`
-	Authors []AuthorInfo `yaml:"authors,flow"`
+	Version int           `yaml:"version,omitempty"`
+	URL     string        `yaml:"catalog-url"`
+	Media   string        `yaml:"media-type,omitempty"`
+	Authors []AuthorInfo  `yaml:"authors,flow"`
+	Notify  *NotifyConfig `yaml:"notify,omitempty"`
 }
 
 // AuthorInfo provides the sub fields for the Authors field for Config.
+// Notify routes the author's results to the named notifiers only.
 type AuthorInfo struct {
 	Firstname string
 	Lastname  string
-	Media     string `yaml:"media-type,omitempty"`
+	Media     string   `yaml:"media-type,omitempty"`
+	Notify    []string `yaml:"notify,omitempty,flow"`
 }
 
-// schema is the YAML configuration file schema.
-var schema = `
+// schemas maps each version of the configuration file to its schema.
+// Version 1 is the original file, without a version key; later versions
+// require the key.  See migrate.go for upgrading a file between versions.
+var schemas = map[int]string{
+	1: `
 {
         "$schema": "http://json-schema.org/draft-04/schema#",
         "type": "object",
         "required": ["URL", "Authors"],
         "properties": {
+            "Version": {"type": "integer", "enum": [0, 1]},
             "URL": {"type": "string", "format": "uri"},
             "Media": {"type": "string", "format": "media"},
             "Authors": {
@@ -102,13 +121,95 @@ var schema = `
                     "properties": {
                         "Firstname": {"type": "string", "minLength": 1},
                         "Lastname": {"type": "string", "minLength": 1},
-                        "Media": {"type": "string", "format": "media"}
+                        "Media": {"type": "string", "format": "media"},
+                        "Notify": {
+                            "type": ["array", "null"],
+                            "items": {"type": "string", "minLength": 1}
+                        }
                     }
                 }
-            }
+            },
+            "Notify": ` + notifySchema + `
         },
         "additionalProperties": false
-}`
+}`,
+	2: `
+{
+        "$schema": "http://json-schema.org/draft-04/schema#",
+        "type": "object",
+        "required": ["Version", "URL", "Authors"],
+        "properties": {
+            "Version": {"type": "integer", "enum": [2]},
+            "URL": {"type": "string", "format": "uri"},
+            "Media": {"type": "string", "format": "media"},
+            "Authors": {
+                "type": "array",
+                "items": {
+                    "type": "object",
+                    "required": ["Firstname", "Lastname"],
+                    "properties": {
+                        "Firstname": {"type": "string", "minLength": 1},
+                        "Lastname": {"type": "string", "minLength": 1},
+                        "Media": {"type": "string", "format": "media"},
+                        "Notify": {
+                            "type": ["array", "null"],
+                            "items": {"type": "string", "minLength": 1}
+                        }
+                    }
+                }
+            },
+            "Notify": ` + notifySchema + `
+        },
+        "additionalProperties": false
+}`,
+}
+
+// notifySchema is the schema for the notify key, which is the same in each
+// version.
+const notifySchema = `{
+                "type": ["object", "null"],
+                "properties": {
+                    "Email": {
+                        "type": ["object", "null"],
+                        "required": ["Server", "From", "To"],
+                        "properties": {
+                            "Server": {"type": "string", "minLength": 1},
+                            "Port": {
+                                "type": "integer",
+                                "minimum": 0,
+                                "maximum": 65535
+                            },
+                            "From": {"type": "string", "minLength": 1},
+                            "To": {
+                                "type": "array",
+                                "minItems": 1,
+                                "items": {"type": "string", "minLength": 1}
+                            }
+                        }
+                    },
+                    "Webhooks": {
+                        "type": ["array", "null"],
+                        "items": {
+                            "type": "object",
+                            "required": ["Name", "URL"],
+                            "properties": {
+                                "Name": {"type": "string", "minLength": 1},
+                                "URL": {"type": "string", "format": "uri"},
+                                "Format": {
+                                    "type": "string",
+                                    "enum": ["", "generic", "slack",
+                                        "discord", "matrix"]
+                                },
+                                "Retries": {
+                                    "type": ["integer", "null"],
+                                    "minimum": 0,
+                                    "maximum": 10
+                                }
+                            }
+                        }
+                    }
+                }
+            }`
 
 // MediaTypes - array of supported media types.
 //
@@ -158,42 +259,94 @@ func convertMediaType(config *Config) {
 	}
 }
 
-// ReadConfig return contents of file into a byte slice.
-func ReadConfig(configFileName string) ([]byte, error) {
+// LookupMediaType converts a media type name, in any case, to the value
+// needed by the URL request, e.g., 'ebook' to 'eBook'.  Returns an error
+// if the media type isn't supported.
+func LookupMediaType(name string) (string, error) {
+	media, ok := MediaTypes[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unsupported media type '%s'", name)
+	}
+	return media, nil
+}
+
+// ReadConfig return contents of file into a byte slice along with the
+// absolute path of the file read.  If the file name is empty, the file is
+// found with FindConfig.
+func ReadConfig(configFileName string) ([]byte, string, error) {
+	if configFileName == "" {
+		var err error
+		configFileName, err = FindConfig()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
 	path, err := filepath.Abs(configFileName)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	fileInfo, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		return nil, err
+		return nil, path, err
 	}
 	if err != nil {
-		return nil, err
+		return nil, path, err
 	}
 
 	if fileInfo.IsDir() {
-		return nil, fmt.Errorf("%s is a directory; must be a file",
+		return nil, path, fmt.Errorf("%s is a directory; must be a file",
 			configFileName)
 	}
 
-	return ioutil.ReadFile(path)
+	contents, err := ioutil.ReadFile(path)
+	return contents, path, err
 }
 
-// ValidateConfig validates the YAML file contents against a schema.
-func ValidateConfig(in []byte) (Config, error) {
+// parseConfig parses the file contents, in one of ConfigFormats, into the
+// Go structure, 'Config', and also returns the YAML node tree so that
+// errors can be located in the file.
+func parseConfig(in []byte, format string) (Config, *yaml.Node, error) {
 	var config Config
 
 	if len(in) == 0 {
-		return config, fmt.Errorf("configuration content is empty")
+		return config, nil, fmt.Errorf("configuration content is empty")
 	}
 
-	// Marshal the contents of the YAML into the Go structure, 'Config'.
-	err := yaml.Unmarshal(in, &config)
+	root, err := configNode(in, format)
+	if err == nil {
+		emptyAuthors(root)
+		err = root.Decode(&config)
+	}
 	if err != nil {
-		return config,
-			fmt.Errorf("unable to parse YAML config file:  %s", err)
+		return config, nil, fmt.Errorf("unable to parse %s config file:  %s",
+			strings.ToUpper(format), err)
+	}
+	return config, root, nil
+}
+
+// emptyAuthors replaces null entries in the authors list with empty
+// mappings.  Otherwise, the null entries are dropped when decoded rather
+// than being reported as authors without names.
+func emptyAuthors(root *yaml.Node) {
+	authors := mappingValue(documentNode(root), "authors")
+	if authors == nil || authors.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, author := range authors.Content {
+		if author.Kind == yaml.ScalarNode && author.Tag == "!!null" {
+			author.Kind, author.Tag, author.Value =
+				yaml.MappingNode, "!!map", ""
+		}
+	}
+}
+
+// validateSchema validates the config structure against the schema for its
+// version and returns the validation errors.
+func validateSchema(config Config) ([]gojsonschema.ResultError, error) {
+	if err := checkVersion(config); err != nil {
+		return nil, err
 	}
 
 	// To prepare for validation, load the config structure, add the
@@ -201,25 +354,65 @@ func ValidateConfig(in []byte) (Config, error) {
 	structLoader := gojsonschema.NewGoLoader(config)
 
 	gojsonschema.FormatCheckers.Add("media", mediaFormatChecker{})
-	schemaLoader := gojsonschema.NewStringLoader(schema)
+	schemaLoader := gojsonschema.NewStringLoader(
+		schemas[config.SchemaVersion()])
 
 	// Validate the config structure against the schema.
 	result, err := gojsonschema.Validate(schemaLoader, structLoader)
 
 	// Any problems with the schema itself?
 	if err != nil {
-		return config, fmt.Errorf("invalid schema: %s", err)
+		return nil, fmt.Errorf("invalid schema: %s", err)
+	}
+	return result.Errors(), nil
+}
+
+// ValidateConfig validates the YAML file contents against a schema.
+func ValidateConfig(in []byte) (Config, error) {
+	return ValidateConfigFormat(in, ConfigYAML)
+}
+
+// ValidateConfigFormat validates the file contents, in one of
+// ConfigFormats, against a schema.
+func ValidateConfigFormat(in []byte, format string) (Config, error) {
+	// Marshal the contents of the file into the Go structure, 'Config'.
+	config, root, err := parseConfig(in, format)
+	if err != nil {
+		return config, err
+	}
+
+	// Keys missing from a file with includes may be set by the included
+	// files, which aren't read here.
+	ignore := func(resultErr gojsonschema.ResultError) bool {
+		return includedKey(root, resultErr)
+	}
+	locate := func(resultErr gojsonschema.ResultError) string {
+		return fmt.Sprintf("line %d", schemaProblem(root, resultErr).Line)
+	}
+	return validateConfig(config, ignore, locate)
+}
+
+// validateConfig validates the config structure against the schema and
+// transforms it for use in searches.  The errors for which ignore, if not
+// nil, returns true are ignored.  The locate function describes where the
+// value in error came from, e.g., the line in the file.
+func validateConfig(config Config, ignore func(gojsonschema.ResultError) bool, locate func(gojsonschema.ResultError) string) (Config, error) {
+	resultErrors, err := validateSchema(config)
+	if err != nil {
+		return config, err
 	}
 
 	// Any validation issues?  If so, create an array of the validation
-	// errors.  Unfortunately, this implementation of schema validation
-	// doesn't provide line numbers where errors are found.
-	if !result.Valid() {
-		var errmsg []string
-		for _, err := range result.Errors() {
-			errmsg = append(errmsg, fmt.Sprintf("- %s\n", err))
+	// errors, each with the location where it was found.
+	var errmsg []string
+	for _, resultErr := range resultErrors {
+		if ignore == nil || !ignore(resultErr) {
+			errmsg = append(errmsg, fmt.Sprintf("- %s: %s\n",
+				locate(resultErr), resultErr))
 		}
-		return config, fmt.Errorf("YAML failed schema validation: %s",
+	}
+	if len(errmsg) != 0 {
+		return config, fmt.Errorf("config failed schema validation: %s",
 			strings.Join(errmsg[:], "\n"))
 	}
 
@@ -232,7 +425,7 @@ func ValidateConfig(in []byte) (Config, error) {
 		config.URL += "/"
 	}
 
-	return config, err
+	return config, nil
 }
 
 // Stringer function for Config struct.
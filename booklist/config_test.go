@@ -60,7 +60,7 @@ func TestNonexistentConfig(t *testing.T) {
 	t.Log("attempt to read a non-existent config file.")
 	var ok error
 
-	_, ok = ReadConfig("file_does_not_exist")
+	_, _, ok = ReadConfig("file_does_not_exist")
 	if ok == nil {
 		t.Error("Expected error due to non-existent config file.")
 	}
@@ -89,7 +89,7 @@ func TestEmptyConfig(t *testing.T) {
 	var ok error
 	var content []byte
 
-	content, ok = ReadConfig(tmpfileName)
+	content, _, ok = ReadConfig(tmpfileName)
 	if ok != nil {
 		t.Error("Empty config file should not be an error until " +
 			"contents are processed.")
@@ -108,7 +108,7 @@ func TestEmptyConfig(t *testing.T) {
 func TestFileAsDir(t *testing.T) {
 	t.Log("attempt to read a directory instead of a config file")
 
-	_, ok := ReadConfig(".")
+	_, _, ok := ReadConfig(".")
 	if ok == nil {
 		t.Error("Config file cannot be a directory; must be a file.")
 	}
@@ -123,7 +123,7 @@ func TestBadYamlFormat(t *testing.T) {
 	var ok error
 	var content []byte
 
-	content, ok = ReadConfig("config.go")
+	content, _, ok = ReadConfig("config.go")
 	_, ok = ValidateConfig(content)
 	if ok == nil {
 		t.Errorf("Expected error with non-YAML file (config.go) as input.")
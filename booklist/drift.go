@@ -0,0 +1,107 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the tracking of resources returned by the catalog that
+are missing the fields a search relies on.  A few such resources are
+normal; e.g., some publications have no author.  But when most of them
+are missing a field, the library's catalog has probably changed in a way
+that breaks the parsing of its responses, and the search results can't
+be trusted.
+*/
+package booklist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultDriftThreshold is the fraction of resources missing an expected
+// field above which the responses are considered to have drifted from
+// the expected schema.
+const DefaultDriftThreshold = 0.25
+
+// ExpectedFields are the resource fields used by a search.
+var ExpectedFields = []string{"shortAuthor", "format", "shortTitle"}
+
+// DriftStats counts the resources missing expected fields.  It's safe
+// for concurrent use, so one DriftStats can be shared by the searches
+// of a run.
+type DriftStats struct {
+	mu        sync.Mutex
+	resources int
+	incorrect int
+	missing   map[string]int
+}
+
+// add records a resource and the expected fields it was missing.
+func (d *DriftStats) add(missingFields []string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resources++
+	if len(missingFields) == 0 {
+		return
+	}
+	d.incorrect++
+	if d.missing == nil {
+		d.missing = make(map[string]int)
+	}
+	for _, field := range missingFields {
+		d.missing[field]++
+	}
+}
+
+// Resources returns the number of resources examined.
+func (d *DriftStats) Resources() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.resources
+}
+
+// Missing returns the number of resources missing the given field.
+func (d *DriftStats) Missing(field string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.missing[field]
+}
+
+// Rate returns the fraction of resources missing at least one expected
+// field; zero if no resources were examined.
+func (d *DriftStats) Rate() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resources == 0 {
+		return 0
+	}
+	return float64(d.incorrect) / float64(d.resources)
+}
+
+// Exceeds returns whether the rate of resources missing expected fields
+// is greater than the given threshold.
+func (d *DriftStats) Exceeds(threshold float64) bool {
+	return d.Rate() > threshold
+}
+
+// Stringer function for DriftStats struct.
+func (d *DriftStats) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var fields []string
+	for field, count := range d.missing {
+		fields = append(fields, fmt.Sprintf("%s: %d", field, count))
+	}
+	sort.Strings(fields)
+
+	summary := fmt.Sprintf("%d of %d resources missing expected fields",
+		d.incorrect, d.resources)
+	if len(fields) != 0 {
+		summary += " (" + strings.Join(fields, ", ") + ")"
+	}
+	return summary
+}
@@ -0,0 +1,71 @@
+// Unit tests related to schema drift detection. //
+package booklist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDriftStats(t *testing.T) {
+	t.Log("resources missing expected fields are counted.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 4}`),
+		replyWith(`{"resources": [
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X", "format": "Book"},
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X"},
+		    {"shortAuthor": "Grafton, Sue", "title": "X", "mediaType": "Book"},
+		    {"shortTitle": "The Mystery Writers of America cookbook",
+		     "format": "Book"}
+		]}`))
+	defer ts.Close()
+
+	drift := new(DriftStats)
+	c := testCatalog(ts.URL)
+	c.Drift = drift
+	pubs, err := c.PublicationSearch()
+	if err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+	if len(pubs) != 3 {
+		t.Errorf("Expected 3 publications; got %d.", len(pubs))
+	}
+
+	if drift.Resources() != 4 {
+		t.Errorf("Expected 4 resources examined; got %d.", drift.Resources())
+	}
+	for field, expected := range map[string]int{
+		"shortAuthor": 1,
+		"format":      2,
+		"shortTitle":  1,
+	} {
+		if got := drift.Missing(field); got != expected {
+			t.Errorf("Expected %d resources missing %s; got %d.",
+				expected, field, got)
+		}
+	}
+	if drift.Rate() != 0.75 {
+		t.Errorf("Expected drift rate of 0.75; got %v.", drift.Rate())
+	}
+	if !drift.Exceeds(DefaultDriftThreshold) {
+		t.Errorf("Expected drift rate to exceed the default threshold.")
+	}
+	if !strings.Contains(drift.String(), "3 of 4 resources") {
+		t.Errorf("Unexpected drift summary: %s.", drift)
+	}
+}
+
+func TestNoDrift(t *testing.T) {
+	t.Log("complete resources don't exceed the threshold.")
+	drift := new(DriftStats)
+	if drift.Rate() != 0 || drift.Exceeds(DefaultDriftThreshold) {
+		t.Errorf("Expected no drift without resources; got %v.", drift.Rate())
+	}
+
+	drift.add(nil)
+	drift.add(nil)
+	drift.add(nil)
+	drift.add([]string{"shortAuthor"})
+	if drift.Exceeds(DefaultDriftThreshold) {
+		t.Errorf("Expected drift rate of %v to not exceed %v.",
+			drift.Rate(), DefaultDriftThreshold)
+	}
+}
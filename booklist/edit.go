@@ -0,0 +1,277 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains functions for editing the list of authors in the
+configuration file.  The file is edited as a tree of YAML nodes rather than
+as a Config structure so that the comments and the order of the keys are
+preserved when the file is written back.  The file is reformatted, though,
+e.g., the spacing after a colon isn't preserved.  Only YAML files can be
+edited.
+*/
+package booklist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrAuthorNotFound is returned when the author to change isn't in the
+// configuration file.
+var ErrAuthorNotFound = errors.New("author not found")
+
+// ErrDuplicateAuthor is returned when the author to add is already in the
+// configuration file.
+var ErrDuplicateAuthor = errors.New("author already listed")
+
+// BackupSuffix is appended to the name of the configuration file to form
+// the name of the copy made by WriteConfig.
+const BackupSuffix = ".bak"
+
+// ConfigEditor edits the list of authors in a configuration file.
+type ConfigEditor struct {
+	root *yaml.Node
+}
+
+// NewConfigEditor parses the YAML file contents for editing.
+func NewConfigEditor(in []byte) (*ConfigEditor, error) {
+	var root yaml.Node
+	if len(in) == 0 {
+		return nil, fmt.Errorf("configuration content is empty")
+	}
+	if err := yaml.Unmarshal(in, &root); err != nil {
+		return nil, fmt.Errorf("unable to parse YAML config file:  %s", err)
+	}
+	if top := documentNode(&root); top == nil || top.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("unable to parse YAML config file:  " +
+			"expected a mapping of keys to values")
+	}
+	return &ConfigEditor{root: &root}, nil
+}
+
+// authorKey returns the name used to compare authors; case and surrounding
+// spaces are ignored.
+func authorKey(firstname, lastname string) string {
+	return strings.ToLower(strings.TrimSpace(firstname) + " " +
+		strings.TrimSpace(lastname))
+}
+
+// authors returns the node for the list of authors, creating it if
+// necessary.
+func (ed *ConfigEditor) authors() (*yaml.Node, error) {
+	top := documentNode(ed.root)
+	authors := mappingValue(top, "authors")
+	if authors == nil {
+		authors = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		top.Content = append(top.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "authors"},
+			authors)
+	}
+	if authors.Kind == yaml.ScalarNode && authors.Tag == "!!null" {
+		authors.Kind, authors.Tag, authors.Value = yaml.SequenceNode, "!!seq", ""
+	}
+	if authors.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: authors must be a list",
+			authors.Line)
+	}
+	return authors, nil
+}
+
+// findAuthor returns the index in the authors list of the named author, or
+// -1 if the author isn't listed.
+func (ed *ConfigEditor) findAuthor(authors *yaml.Node, firstname, lastname string) int {
+	key := authorKey(firstname, lastname)
+	for i, author := range authors.Content {
+		first := mappingValue(author, "firstname")
+		last := mappingValue(author, "lastname")
+		if first != nil && last != nil &&
+			authorKey(first.Value, last.Value) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddAuthor appends the author to the end of the authors list.  The
+// author's media type is omitted if empty.
+func (ed *ConfigEditor) AddAuthor(author AuthorInfo) error {
+	authors, err := ed.authors()
+	if err != nil {
+		return err
+	}
+	if ed.findAuthor(authors, author.Firstname, author.Lastname) != -1 {
+		return fmt.Errorf("%s %s: %w", author.Firstname, author.Lastname,
+			ErrDuplicateAuthor)
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setMappingValue(entry, "firstname", author.Firstname)
+	setMappingValue(entry, "lastname", author.Lastname)
+	if author.Media != "" {
+		setMappingValue(entry, "media-type", author.Media)
+	}
+	authors.Content = append(authors.Content, entry)
+	return nil
+}
+
+// RemoveAuthor removes the named author from the authors list.
+func (ed *ConfigEditor) RemoveAuthor(firstname, lastname string) error {
+	authors, err := ed.authors()
+	if err != nil {
+		return err
+	}
+	i := ed.findAuthor(authors, firstname, lastname)
+	if i == -1 {
+		return fmt.Errorf("%s %s: %w", firstname, lastname, ErrAuthorNotFound)
+	}
+
+	// Keep any comment preceding the removed author by moving it to the
+	// next entry.
+	removed := authors.Content[i]
+	if removed.HeadComment != "" && i+1 < len(authors.Content) {
+		next := authors.Content[i+1]
+		next.HeadComment = strings.TrimSpace(removed.HeadComment + "\n" +
+			next.HeadComment)
+	}
+	authors.Content = append(authors.Content[:i], authors.Content[i+1:]...)
+	return nil
+}
+
+// SetAuthorMedia sets the media type of the named author; an empty media
+// type removes the author's media type so the default is used.
+func (ed *ConfigEditor) SetAuthorMedia(firstname, lastname, media string) error {
+	authors, err := ed.authors()
+	if err != nil {
+		return err
+	}
+	i := ed.findAuthor(authors, firstname, lastname)
+	if i == -1 {
+		return fmt.Errorf("%s %s: %w", firstname, lastname, ErrAuthorNotFound)
+	}
+
+	author := authors.Content[i]
+	if media == "" {
+		deleteMappingKey(author, "media-type")
+	} else {
+		setMappingValue(author, "media-type", media)
+	}
+	return nil
+}
+
+// Bytes returns the edited YAML file contents.  The contents are validated
+// so that an edit can't produce an invalid file.
+func (ed *ConfigEditor) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(4)
+	if err := encoder.Encode(ed.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	out := separateComments(buf.Bytes())
+	if _, err := ValidateConfig(out); err != nil {
+		return nil, fmt.Errorf("edited configuration is invalid: %w", err)
+	}
+	return out, nil
+}
+
+// separateComments restores the blank line before each top level comment
+// block, which the YAML encoder drops.
+func separateComments(in []byte) []byte {
+	lines := strings.Split(string(in), "\n")
+	var out []string
+	for i, line := range lines {
+		if i > 0 && strings.HasPrefix(line, "#") {
+			previous := lines[i-1]
+			if previous != "" && !strings.HasPrefix(previous, "#") {
+				out = append(out, "")
+			}
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// setMappingValue sets the value of the key in a mapping node, adding the
+// key if necessary.
+func setMappingValue(node *yaml.Node, key, value string) {
+	if existing := mappingValue(node, key); existing != nil {
+		existing.Kind, existing.Tag, existing.Value =
+			yaml.ScalarNode, "!!str", value
+		existing.Content = nil
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// deleteMappingKey removes the key and its value from a mapping node.
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// WriteConfig replaces the contents of the configuration file.  The file
+// is written atomically:  the contents are written to a temporary file in
+// the same directory, which is then renamed to the file's name.  The
+// previous contents are first copied to a backup file whose name has
+// BackupSuffix appended.
+func WriteConfig(configFileName string, contents []byte) error {
+	mode := os.FileMode(0644)
+	if fileInfo, err := os.Stat(configFileName); err == nil {
+		mode = fileInfo.Mode().Perm()
+		previous, err := ioutil.ReadFile(configFileName)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(configFileName+BackupSuffix, previous, mode)
+		if err != nil {
+			return fmt.Errorf("unable to back up config file:  %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return writeFileAtomic(configFileName, contents, mode)
+}
+
+// writeFileAtomic writes the contents to a temporary file in the same
+// directory as the named file, then renames it to the file's name, so that
+// the file is never left partly written.
+func writeFileAtomic(fileName string, contents []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName),
+		"."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
@@ -0,0 +1,169 @@
+// Unit tests related to editing the configuration file. //
+package booklist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editConfig = `# Library settings.
+catalog-url: https://catalog.library.loudoun.gov/
+media-type: Book
+
+# Favorite authors.
+authors:
+    # Mysteries.
+    - firstname: Sue
+      lastname: Grafton
+      media-type: eBook # Large print isn't available.
+    - firstname: Stephen
+      lastname: King
+`
+
+// editedConfig applies the edit to editConfig and returns the result.
+func editedConfig(t *testing.T, edit func(ed *ConfigEditor) error) string {
+	ed, err := NewConfigEditor([]byte(editConfig))
+	if err != nil {
+		t.Fatalf("Unable to parse config: %s.", err)
+	}
+	if err := edit(ed); err != nil {
+		t.Fatalf("Edit failed: %s.", err)
+	}
+	out, err := ed.Bytes()
+	if err != nil {
+		t.Fatalf("Unable to encode config: %s.", err)
+	}
+	return string(out)
+}
+
+func TestAddAuthor(t *testing.T) {
+	t.Log("an added author is appended and the comments are preserved.")
+	out := editedConfig(t, func(ed *ConfigEditor) error {
+		return ed.AddAuthor(AuthorInfo{
+			Firstname: "Alexander",
+			Lastname:  "McCall Smith",
+			Media:     "book on cd",
+		})
+	})
+
+	config, err := ValidateConfig([]byte(out))
+	if err != nil {
+		t.Fatalf("Edited config is invalid: %s.", err)
+	}
+	if len(config.Authors) != 3 || config.Authors[2].Lastname != "McCall Smith" ||
+		config.Authors[2].Media != "Book on CD" {
+		t.Errorf("Expected McCall Smith to be added last; got %v.", config)
+	}
+	for _, comment := range []string{"# Library settings.",
+		"# Favorite authors.", "# Mysteries.",
+		"# Large print isn't available."} {
+		if !strings.Contains(out, comment) {
+			t.Errorf("Expected comment '%s' to be preserved; got:\n%s",
+				comment, out)
+		}
+	}
+	if strings.Index(out, "catalog-url") > strings.Index(out, "authors") {
+		t.Errorf("Expected the order of keys to be preserved; got:\n%s", out)
+	}
+}
+
+func TestAddDuplicateAuthor(t *testing.T) {
+	t.Log("adding an author already listed is an error.")
+	ed, err := NewConfigEditor([]byte(editConfig))
+	if err != nil {
+		t.Fatalf("Unable to parse config: %s.", err)
+	}
+	err = ed.AddAuthor(AuthorInfo{Firstname: "sue", Lastname: "GRAFTON"})
+	if !errors.Is(err, ErrDuplicateAuthor) {
+		t.Errorf("Expected ErrDuplicateAuthor; got %v.", err)
+	}
+}
+
+func TestRemoveAuthor(t *testing.T) {
+	t.Log("a removed author's preceding comment is kept.")
+	out := editedConfig(t, func(ed *ConfigEditor) error {
+		return ed.RemoveAuthor("Sue", "Grafton")
+	})
+	if strings.Contains(out, "Grafton") {
+		t.Errorf("Expected Grafton to be removed; got:\n%s", out)
+	}
+	if !strings.Contains(out, "# Mysteries.") {
+		t.Errorf("Expected the comment to be kept; got:\n%s", out)
+	}
+
+	ed, _ := NewConfigEditor([]byte(editConfig))
+	if err := ed.RemoveAuthor("Agatha", "Christie"); !errors.Is(err, ErrAuthorNotFound) {
+		t.Errorf("Expected ErrAuthorNotFound; got %v.", err)
+	}
+}
+
+func TestSetAuthorMedia(t *testing.T) {
+	t.Log("an author's media type can be set and removed.")
+	out := editedConfig(t, func(ed *ConfigEditor) error {
+		if err := ed.SetAuthorMedia("Stephen", "King", "DVD"); err != nil {
+			return err
+		}
+		return ed.SetAuthorMedia("Sue", "Grafton", "")
+	})
+	config, err := ValidateConfig([]byte(out))
+	if err != nil {
+		t.Fatalf("Edited config is invalid: %s.", err)
+	}
+	if config.Authors[0].Media != "" || config.Authors[1].Media != "DVD" {
+		t.Errorf("Expected media types of '' and 'DVD'; got %v.", config)
+	}
+}
+
+func TestInvalidEdit(t *testing.T) {
+	t.Log("an edit producing an invalid file is rejected.")
+	ed, _ := NewConfigEditor([]byte(editConfig))
+	if err := ed.SetAuthorMedia("Stephen", "King", "Vinyl"); err != nil {
+		t.Fatalf("Edit failed: %s.", err)
+	}
+	if _, err := ed.Bytes(); err == nil ||
+		!strings.Contains(err.Error(), "Does not match format") {
+		t.Errorf("Expected a schema error; got %v.", err)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	t.Log("writing the config file leaves a backup of the previous contents.")
+	dir, err := ioutil.TempDir("", "booklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFileName := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(configFileName, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteConfig(configFileName, []byte("new")); err != nil {
+		t.Fatalf("Write failed: %s.", err)
+	}
+
+	for fileName, expected := range map[string]string{
+		configFileName:                "new",
+		configFileName + BackupSuffix: "old",
+	} {
+		contents, err := ioutil.ReadFile(fileName)
+		if err != nil || string(contents) != expected {
+			t.Errorf("Expected %s to contain '%s'; got '%s' (%v).",
+				fileName, expected, contents, err)
+		}
+	}
+	if fileInfo, err := os.Stat(configFileName); err != nil ||
+		fileInfo.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file mode to be preserved; got %v.", fileInfo)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Expected only the file and its backup; got %d files.",
+			len(files))
+	}
+}
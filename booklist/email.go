@@ -0,0 +1,329 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the email notifier, which sends the digest of a run by
+SMTP as a message with both HTML and plain text parts.  The parts are
+rendered by templates, which can be replaced by templates of one's own;
+see EmailData for the values available to them.  The password used to log
+in to the SMTP server is read from an environment variable rather than the
+configuration file.
+*/
+package booklist
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	// Timeout in seconds for connecting to and talking with the SMTP
+	// server.
+	smtpTimeout = 30
+
+	// Default SMTP ports, with and without STARTTLS.
+	defaultSubmissionPort = 587
+	defaultSMTPPort       = 25
+)
+
+// DefaultEmailSubject is the template for the subject of the email.
+const DefaultEmailSubject = `{{if .OnlyNew}}{{.Count}} new titles{{else}}` +
+	`{{.Count}} titles{{end}} from booklist`
+
+// DefaultEmailText is the template for the plain text part of the email.
+const DefaultEmailText = `{{if .OnlyNew}}New titles{{else}}Titles{{end}} found by booklist on {{.Time.Format "Jan 2, 2006"}}:
+{{range .Authors}}
+{{.Author}} -- {{.Media}}s:
+{{range .Publications}}  [{{.Media}}]  {{.Publication}}
+{{else}}  none
+{{end}}{{else}}
+No titles were found.
+{{end}}`
+
+// DefaultEmailHTML is the template for the HTML part of the email.
+const DefaultEmailHTML = `<!DOCTYPE html>
+<html>
+<body>
+<p>{{if .OnlyNew}}New titles{{else}}Titles{{end}} found by booklist on {{.Time.Format "Jan 2, 2006"}}:</p>
+{{range .Authors}}<h3>{{.Author}} &mdash; {{.Media}}s</h3>
+<ul>
+{{range .Publications}}<li>[{{.Media}}] {{.Publication}}</li>
+{{else}}<li>none</li>
+{{end}}</ul>
+{{else}}<p>No titles were found.</p>
+{{end}}</body>
+</html>
+`
+
+// EmailConfig configures the email notifier.  The password is read from
+// the environment variable named by PasswordEnv.  If OnlyNew is set, the
+// email lists only the titles that are new since the previous run, and
+// isn't sent if there are none.  The templates are files that replace
+// DefaultEmailHTML and DefaultEmailText.
+type EmailConfig struct {
+	Server       string   `yaml:"server" json:",omitempty"`
+	Port         int      `yaml:"port,omitempty"`
+	StartTLS     bool     `yaml:"starttls,omitempty"`
+	Username     string   `yaml:"username,omitempty"`
+	PasswordEnv  string   `yaml:"password-env,omitempty"`
+	From         string   `yaml:"from" json:",omitempty"`
+	To           []string `yaml:"to,flow"`
+	Subject      string   `yaml:"subject,omitempty"`
+	OnlyNew      bool     `yaml:"only-new,omitempty"`
+	HTMLTemplate string   `yaml:"html-template,omitempty"`
+	TextTemplate string   `yaml:"text-template,omitempty"`
+}
+
+// EmailData is the data passed to the email templates.  Authors holds the
+// results shown:  all of them, or with OnlyNew, only the new titles.  Count
+// is the number of titles in Authors.
+type EmailData struct {
+	Time    time.Time
+	Authors []SearchResult
+	OnlyNew bool
+	Count   int
+}
+
+// EmailNotifier sends the digest of a run by email.  Getenv is used to
+// look up the password; it defaults to os.Getenv.
+type EmailNotifier struct {
+	Config EmailConfig
+	Getenv func(string) string
+
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// NewEmailNotifier returns an email notifier, reading its templates.
+func NewEmailNotifier(config EmailConfig) (*EmailNotifier, error) {
+	n := &EmailNotifier{Config: config, Getenv: os.Getenv}
+
+	subject := config.Subject
+	if subject == "" {
+		subject = DefaultEmailSubject
+	}
+	textSource, err := readTemplate(config.TextTemplate, DefaultEmailText)
+	if err != nil {
+		return nil, err
+	}
+	htmlSource, err := readTemplate(config.HTMLTemplate, DefaultEmailHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.subject, err = texttemplate.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("invalid email subject:  %s", err)
+	}
+	if n.text, err = texttemplate.New("text").Parse(textSource); err != nil {
+		return nil, fmt.Errorf("invalid email text template:  %s", err)
+	}
+	if n.html, err = htmltemplate.New("html").Parse(htmlSource); err != nil {
+		return nil, fmt.Errorf("invalid email HTML template:  %s", err)
+	}
+	return n, nil
+}
+
+// readTemplate returns the contents of the template file, or the default
+// template if no file is given.
+func readTemplate(fileName, defaultTemplate string) (string, error) {
+	if fileName == "" {
+		return defaultTemplate, nil
+	}
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("unable to read email template:  %s", err)
+	}
+	return string(contents), nil
+}
+
+// Name returns the name of the email notifier, EmailNotifierName.
+func (n *EmailNotifier) Name() string {
+	return EmailNotifierName
+}
+
+// Notify sends the digest by email.  With OnlyNew, nothing is sent if
+// there are no new titles.
+func (n *EmailNotifier) Notify(digest Digest) error {
+	message, err := n.Payload(digest)
+	if err != nil || message == nil {
+		return err
+	}
+	if err := n.send(message); err != nil {
+		return fmt.Errorf("unable to send email via %s:  %s",
+			n.address(), err)
+	}
+	return nil
+}
+
+// Payload returns the email that Notify would send, or nil if none would
+// be sent, e.g., if no authors are routed to email.
+func (n *EmailNotifier) Payload(digest Digest) ([]byte, error) {
+	if len(digest.Results) == 0 || n.Config.OnlyNew && len(digest.New) == 0 {
+		return nil, nil
+	}
+	return n.Message(digest)
+}
+
+// Message returns the email for the digest, with its headers.
+func (n *EmailNotifier) Message(digest Digest) ([]byte, error) {
+	data := EmailData{
+		Time:    digest.Time,
+		Authors: digest.Shown(n.Config.OnlyNew),
+		OnlyNew: n.Config.OnlyNew,
+	}
+	data.Count = countPublications(data.Authors)
+
+	var subject, text, html bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := n.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := n.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	// The body is an alternative of the plain text and HTML parts.
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		contents    []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.contents); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", n.Config.From},
+		{"To", strings.Join(n.Config.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8",
+			strings.TrimSpace(subject.String()))},
+		{"Date", digest.Time.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" +
+			parts.Boundary()},
+	} {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// address returns the host and port of the SMTP server.
+func (n *EmailNotifier) address() string {
+	port := n.Config.Port
+	if port == 0 {
+		port = defaultSMTPPort
+		if n.Config.StartTLS {
+			port = defaultSubmissionPort
+		}
+	}
+	return net.JoinHostPort(n.Config.Server, strconv.Itoa(port))
+}
+
+// send delivers the message to the SMTP server.
+func (n *EmailNotifier) send(message []byte) error {
+	conn, err := net.DialTimeout("tcp", n.address(), smtpTimeout*time.Second)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout * time.Second)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.Config.Server)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.Config.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server doesn't support STARTTLS")
+		}
+		err := client.StartTLS(&tls.Config{ServerName: n.Config.Server})
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.Config.Username != "" {
+		password := n.Getenv(n.Config.PasswordEnv)
+		if n.Config.PasswordEnv == "" || password == "" {
+			return fmt.Errorf("no password for %s; set password-env to "+
+				"an environment variable holding it", n.Config.Username)
+		}
+		auth := smtp.PlainAuth("", n.Config.Username, password,
+			n.Config.Server)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(envelopeAddress(n.Config.From)); err != nil {
+		return err
+	}
+	for _, to := range n.Config.To {
+		if err := client.Rcpt(envelopeAddress(to)); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// envelopeAddress returns the bare address for an address that may include
+// a name, e.g., 'me@example.com' for 'Me <me@example.com>'.
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
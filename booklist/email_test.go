@@ -0,0 +1,202 @@
+// Unit tests related to the email notifier. //
+package booklist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+// emailConfig returns the configuration for sending email to the fake
+// SMTP server.
+func emailConfig(server *booklisttest.SMTPServer) EmailConfig {
+	return EmailConfig{
+		Server: server.Host,
+		Port:   server.Port,
+		From:   "Booklist <booklist@example.com>",
+		To:     []string{"me@example.com", "you@example.com"},
+	}
+}
+
+// emailParts returns the subject and the contents of the parts of an
+// email, by content type.
+func emailParts(t *testing.T, data []byte) (string, map[string]string) {
+	t.Helper()
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unable to parse email: %s.", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(
+		message.Header.Get("Subject"))
+
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Unable to parse content type: %s.", err)
+	}
+	parts := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		contents, _ := ioutil.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(contents)
+	}
+	return subject, parts
+}
+
+func TestEmailDigest(t *testing.T) {
+	t.Log("the digest is sent with plain text and HTML parts.")
+	server := booklisttest.NewSMTPServer()
+	defer server.Close()
+
+	notifier, err := NewEmailNotifier(emailConfig(server))
+	if err != nil {
+		t.Fatalf("Unable to create notifier: %s.", err)
+	}
+	if err := notifier.Notify(NewDigest(currentRun, previousRun)); err != nil {
+		t.Fatalf("Notify failed: %s.", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email; got %d.", len(messages))
+	}
+	if messages[0].From != "booklist@example.com" ||
+		strings.Join(messages[0].To, ",") != "me@example.com,you@example.com" {
+		t.Errorf("Unexpected envelope: %s to %v.", messages[0].From,
+			messages[0].To)
+	}
+
+	subject, parts := emailParts(t, messages[0].Data)
+	if subject != "3 titles from booklist" {
+		t.Errorf("Unexpected subject '%s'.", subject)
+	}
+	for _, expected := range []string{"Grafton, Sue -- Books:",
+		"[Large Print]  X", "King, Stephen -- Books:\n  none"} {
+		if !strings.Contains(parts["text/plain"], expected) {
+			t.Errorf("Expected text part to contain '%s'; got:\n%s",
+				expected, parts["text/plain"])
+		}
+	}
+	if !strings.Contains(parts["text/html"], "<li>[Book] Alert</li>") {
+		t.Errorf("Expected HTML part to list 'Alert'; got:\n%s",
+			parts["text/html"])
+	}
+}
+
+func TestEmailOnlyNew(t *testing.T) {
+	t.Log("with only-new, the email lists new titles and isn't sent without any.")
+	server := booklisttest.NewSMTPServer()
+	defer server.Close()
+
+	config := emailConfig(server)
+	config.OnlyNew = true
+	templateFile := filepath.Join(t.TempDir(), "text.tmpl")
+	writeFile(t, templateFile,
+		"{{range .Authors}}{{.Author}}: {{len .Publications}}\n{{end}}")
+	config.TextTemplate = templateFile
+	notifier, err := NewEmailNotifier(config)
+	if err != nil {
+		t.Fatalf("Unable to create notifier: %s.", err)
+	}
+
+	if err := notifier.Notify(NewDigest(currentRun, currentRun)); err != nil {
+		t.Fatalf("Notify failed: %s.", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("Expected no email without new titles; got %d.", n)
+	}
+
+	if err := notifier.Notify(NewDigest(currentRun, previousRun)); err != nil {
+		t.Fatalf("Notify failed: %s.", err)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email; got %d.", len(messages))
+	}
+	subject, parts := emailParts(t, messages[0].Data)
+	expected := "Grafton, Sue: 1\nPatterson, James: 1\n"
+	if subject != "2 new titles from booklist" || parts["text/plain"] != expected {
+		t.Errorf("Expected '2 new titles' with text '%s'; got '%s' with "+
+			"'%s'.", expected, subject, parts["text/plain"])
+	}
+}
+
+func TestEmailCredentials(t *testing.T) {
+	t.Log("the password is read from the environment.")
+	server := booklisttest.NewSMTPServer()
+	defer server.Close()
+	server.SetCredentials("me", "secret")
+
+	config := emailConfig(server)
+	config.Username = "me"
+	config.PasswordEnv = "BOOKLIST_TEST_PASSWORD"
+	notifier, err := NewEmailNotifier(config)
+	if err != nil {
+		t.Fatalf("Unable to create notifier: %s.", err)
+	}
+	digest := NewDigest(currentRun, nil)
+
+	env := map[string]string{}
+	notifier.Getenv = func(name string) string { return env[name] }
+	err = notifier.Notify(digest)
+	if err == nil || !strings.Contains(err.Error(), "no password for me") {
+		t.Errorf("Expected missing password error; got: %v.", err)
+	}
+
+	env["BOOKLIST_TEST_PASSWORD"] = "wrong"
+	if err := notifier.Notify(digest); err == nil {
+		t.Errorf("Expected authentication to fail.")
+	}
+
+	env["BOOKLIST_TEST_PASSWORD"] = "secret"
+	if err := notifier.Notify(digest); err != nil {
+		t.Errorf("Notify failed: %s.", err)
+	}
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("Expected 1 email; got %d.", n)
+	}
+}
+
+func TestEmailConfigInFile(t *testing.T) {
+	t.Log("the notify key is validated and its templates found.")
+	home := setHome(t)
+	configFileName := filepath.Join(home, "config.yml")
+	writeFile(t, configFileName, version1Config+`notify:
+    email:
+        server: smtp.example.com
+        from: booklist@example.com
+        to: [me@example.com]
+        html-template: templates/digest.html
+`)
+	loaded, err := LoadConfig(configFileName, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	expected := filepath.Join(home, "templates", "digest.html")
+	if got := loaded.Notify.Email.HTMLTemplate; got != expected {
+		t.Errorf("Expected template %s; got %s.", expected, got)
+	}
+
+	problems := CheckConfig([]byte(version1Config + `notify:
+    email:
+        server: smtp.example.com
+        from: booklist@example.com
+        to: []
+        pasword-env: X
+`))
+	if len(problems) != 2 || problems[0].Line != 11 || problems[1].Line != 12 {
+		t.Errorf("Expected errors for 'to' and 'pasword-env'; got %v.",
+			problems)
+	}
+}
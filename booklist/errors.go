@@ -0,0 +1,76 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the error types returned by a catalog search.  Callers
+can use errors.Is and errors.As to distinguish between the failures:
+
+  - a request that never received a response (DNS failure, refused
+    connection, timeout) is returned as a *RequestError wrapping the
+    underlying net error,
+  - a response with a status other than 200 is returned as an *HTTPError,
+  - a response body that isn't valid JSON is returned as a *DecodeError,
+  - a response with 'success: false' wraps ErrSearchRejected,
+  - receiving more publications than the count request promised wraps
+    ErrCountMismatch.
+*/
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrSearchRejected indicates the catalog answered the request but
+	// reported that it was unsuccessful, e.g., due to an unsupported filter.
+	ErrSearchRejected = errors.New("catalog rejected the search")
+
+	// ErrCountMismatch indicates the catalog returned more publications
+	// than it reported were available.
+	ErrCountMismatch = errors.New("received more publications than expected")
+)
+
+// RequestError is returned when a POST request fails before a response is
+// received.  Err is the error returned by the HTTP client.
+type RequestError struct {
+	URL string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("POST request '%s' failed; %s", e.URL, e.Err)
+}
+
+// Unwrap returns the underlying HTTP client error.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError is returned when the catalog responds with a status other
+// than 200 OK.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("POST request '%s' failed; HTTP error: %d %s",
+		e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// DecodeError is returned when the catalog's response can't be decoded
+// as JSON.  Err is the error returned by the JSON decoder.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("unable to decode response to '%s': %s", e.URL, e.Err)
+}
+
+// Unwrap returns the underlying JSON decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,118 @@
+// Unit tests related to catalog search errors. //
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newErrorServer returns a test server whose count and search endpoints
+// reply using the given handlers.
+func newErrorServer(count, search http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/count", count)
+	mux.HandleFunc("/search", search)
+	return httptest.NewServer(mux)
+}
+
+func replyWith(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}
+}
+
+func testCatalog(url string) CatalogInfo {
+	return CatalogInfo{
+		URL:    url + "/",
+		Author: "Grafton, Sue",
+		Media:  "Book",
+		Year:   "2015",
+		Log:    testLog,
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	t.Log("non-200 response is reported as an HTTPError.")
+	ts := newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}, replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	_, err := testCatalog(ts.URL).PublicationSearch()
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Expected an HTTPError; got %v.", err)
+	}
+	if httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d; got %d.",
+			http.StatusServiceUnavailable, httpErr.StatusCode)
+	}
+	if httpErr.URL == "" {
+		t.Error("Expected HTTPError to contain the request URL.")
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Log("malformed JSON response is reported as a DecodeError.")
+	ts := newErrorServer(replyWith("<html>not json</html>"),
+		replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	_, err := testCatalog(ts.URL).PublicationSearch()
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError; got %v.", err)
+	}
+}
+
+func TestSearchRejected(t *testing.T) {
+	t.Log("'success: false' response is reported as ErrSearchRejected.")
+	ts := newErrorServer(replyWith(`{"success": false, "totalHits": 0}`),
+		replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	_, err := testCatalog(ts.URL).PublicationSearch()
+	if !errors.Is(err, ErrSearchRejected) {
+		t.Errorf("Expected ErrSearchRejected; got %v.", err)
+	}
+}
+
+func TestCountMismatch(t *testing.T) {
+	t.Log("more publications than counted is reported as ErrCountMismatch.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X", "format": "Book"},
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "Y", "format": "Book"}
+		]}`))
+	defer ts.Close()
+
+	_, err := testCatalog(ts.URL).PublicationSearch()
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Errorf("Expected ErrCountMismatch; got %v.", err)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	t.Log("connection failure is reported as a RequestError.")
+	ts := newErrorServer(replyWith(""), replyWith(""))
+	url := ts.URL
+	ts.Close()
+
+	_, err := testCatalog(url).PublicationSearch()
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("Expected a RequestError; got %v.", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Errorf("Expected RequestError to wrap a net.OpError; got %v.",
+			reqErr.Err)
+	}
+}
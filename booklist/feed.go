@@ -0,0 +1,310 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the feed of the titles found by the searches, which can
+be written as an Atom or RSS 2.0 file for a feed reader.  The feed has an
+entry for each title, with its author, format, a link to its record in the
+catalog and the date it was first found.  The entries are accumulated
+across runs in the state directory, newest first, keeping the last
+DefaultFeedEntries or so; an entry's ID is made when the title is first
+found and kept thereafter, so that feed readers don't show it again.  The
+titles found are remembered apart from the entries, so that a title whose
+entry has been dropped isn't added again.
+*/
+package booklist
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Formats of the feed file.
+const (
+	FeedAtom = "atom"
+	FeedRSS  = "rss"
+)
+
+const (
+	// DefaultFeedEntries is the number of entries kept in the feed,
+	// unless configured otherwise.
+	DefaultFeedEntries = 100
+
+	// feedFile is the name of the file, in the state directory, holding
+	// the feed's entries.
+	feedFile = "feed.json"
+)
+
+// FeedEntry is a title in the feed.  Media is the media type searched for
+// and Format the title's own media type.
+type FeedEntry struct {
+	ID        string
+	Author    string
+	Media     string
+	Format    string
+	Title     string
+	Link      string
+	FirstSeen time.Time
+}
+
+// Feed is the titles found by the searches, newest first.  Updated is the
+// time an entry was last added.  Seen holds the time each title was last
+// found, by its publicationKey, including those of the dropped entries; a
+// title is forgotten once it's gone from the searches for longer than the
+// oldest entry has been in the feed.
+type Feed struct {
+	Updated time.Time
+	Entries []FeedEntry
+	Seen    map[string]time.Time `json:",omitempty"`
+}
+
+// FeedPath returns the path of the file holding the feed's entries.
+func FeedPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, feedFile), nil
+}
+
+// LoadFeed reads the feed saved by SaveFeed.  Returns an empty feed if the
+// file doesn't exist, e.g., before the first run.
+func LoadFeed(fileName string) (*Feed, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return new(Feed), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed := new(Feed)
+	if err := json.Unmarshal(contents, feed); err != nil {
+		return nil, fmt.Errorf("unable to parse feed file %s:  %s",
+			fileName, err)
+	}
+	return feed, nil
+}
+
+// SaveFeed writes the feed, creating the file's directory if necessary.
+func SaveFeed(fileName string, feed *Feed) error {
+	contents, err := json.MarshalIndent(feed, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, append(contents, '\n'), 0644)
+}
+
+// Add adds an entry for each title in the run that hasn't been found
+// before, then drops the oldest entries beyond the number to keep and the
+// titles not found since the oldest entry remaining.  The titles are linked
+// to their records in the catalog with the given url.  Returns the number
+// of entries added.
+func (f *Feed) Add(run *RunResults, catalogURL string, keep int) int {
+	if f.Seen == nil {
+		f.Seen = make(map[string]time.Time)
+	}
+
+	var added []FeedEntry
+	for _, result := range run.Results {
+		for _, pub := range result.Publications {
+			key := publicationKey(result, pub)
+			_, seen := f.Seen[key]
+			f.Seen[key] = run.Time
+			if seen {
+				continue
+			}
+			added = append(added, FeedEntry{
+				ID:        feedEntryID(run.Time, key),
+				Author:    result.Author,
+				Media:     result.Media,
+				Format:    pub.Media,
+				Title:     pub.Publication,
+				Link:      RecordURL(catalogURL, pub.RecordID),
+				FirstSeen: run.Time,
+			})
+		}
+	}
+
+	if len(added) != 0 || f.Updated.IsZero() {
+		f.Updated = run.Time
+	}
+	f.Entries = append(added, f.Entries...)
+	if keep > 0 && len(f.Entries) > keep {
+		f.Entries = f.Entries[:keep]
+	}
+	if len(f.Entries) != 0 {
+		oldest := f.Entries[len(f.Entries)-1].FirstSeen
+		for key, lastSeen := range f.Seen {
+			if lastSeen.Before(oldest) {
+				delete(f.Seen, key)
+			}
+		}
+	}
+	return len(added)
+}
+
+// feedEntryID returns the ID of the entry for a publication first found at
+// the given time:  a tag URI made from the date and a hash of the
+// publication's key.
+func feedEntryID(firstSeen time.Time, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return fmt.Sprintf("tag:booklist,%s:%s", firstSeen.UTC().Format("2006-01-02"),
+		hex.EncodeToString(sum[:10]))
+}
+
+// summary describes the entry in a sentence.
+func (e FeedEntry) summary() string {
+	return fmt.Sprintf("%s by %s, first found in the catalog on %s.",
+		e.Format, e.Author, e.FirstSeen.Format("Jan 2, 2006"))
+}
+
+// WriteAtom writes the feed as an Atom feed with the given title.  The
+// feed links to the catalog with the given url.
+func (f *Feed) WriteAtom(w io.Writer, title, catalogURL string) error {
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type category struct {
+		Term string `xml:"term,attr"`
+	}
+	type entry struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Link      link       `xml:"link"`
+		Updated   string     `xml:"updated"`
+		Published string     `xml:"published"`
+		Author    string     `xml:"author>name"`
+		Category  []category `xml:"category"`
+		Summary   string     `xml:"summary"`
+	}
+	feed := struct {
+		XMLName   xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID        string   `xml:"id"`
+		Title     string   `xml:"title"`
+		Link      link     `xml:"link"`
+		Updated   string   `xml:"updated"`
+		Generator string   `xml:"generator"`
+		Entries   []entry  `xml:"entry"`
+	}{
+		ID:        catalogURL,
+		Title:     title,
+		Link:      link{Href: catalogURL, Rel: "alternate"},
+		Updated:   f.Updated.UTC().Format(time.RFC3339),
+		Generator: "booklist",
+	}
+	for _, e := range f.Entries {
+		firstSeen := e.FirstSeen.UTC().Format(time.RFC3339)
+		feed.Entries = append(feed.Entries, entry{
+			ID:        e.ID,
+			Title:     e.Title,
+			Link:      link{Href: e.Link},
+			Updated:   firstSeen,
+			Published: firstSeen,
+			Author:    e.Author,
+			Category:  []category{{Term: e.Format}},
+			Summary:   e.summary(),
+		})
+	}
+	return writeXML(w, feed)
+}
+
+// WriteRSS writes the feed as an RSS 2.0 feed with the given title.  The
+// feed links to the catalog with the given url.
+func (f *Feed) WriteRSS(w io.Writer, title, catalogURL string) error {
+	type guid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		ID          string `xml:",chardata"`
+	}
+	type item struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		GUID        guid   `xml:"guid"`
+		PubDate     string `xml:"pubDate"`
+		Creator     string `xml:"dc:creator"`
+		Category    string `xml:"category"`
+		Description string `xml:"description"`
+	}
+	type channel struct {
+		Title         string `xml:"title"`
+		Link          string `xml:"link"`
+		Description   string `xml:"description"`
+		LastBuildDate string `xml:"lastBuildDate"`
+		Generator     string `xml:"generator"`
+		Items         []item `xml:"item"`
+	}
+	rss := struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		DC      string   `xml:"xmlns:dc,attr"`
+		Channel channel  `xml:"channel"`
+	}{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: channel{
+			Title:         title,
+			Link:          catalogURL,
+			Description:   "Titles found in the library's catalog by booklist",
+			LastBuildDate: f.Updated.Format(time.RFC1123Z),
+			Generator:     "booklist",
+		},
+	}
+	for _, e := range f.Entries {
+		rss.Channel.Items = append(rss.Channel.Items, item{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        guid{ID: e.ID},
+			PubDate:     e.FirstSeen.Format(time.RFC1123Z),
+			Creator:     e.Author,
+			Category:    e.Format,
+			Description: e.summary(),
+		})
+	}
+	return writeXML(w, rss)
+}
+
+// WriteFile writes the feed to the named file, in one of the feed formats,
+// replacing the file in one step so that a feed reader never sees it half
+// written.
+func (f *Feed) WriteFile(fileName, format, title, catalogURL string) error {
+	var contents bytes.Buffer
+	var err error
+	switch format {
+	case FeedAtom:
+		err = f.WriteAtom(&contents, title, catalogURL)
+	case FeedRSS:
+		err = f.WriteRSS(&contents, title, catalogURL)
+	default:
+		err = fmt.Errorf("unknown feed format '%s'", format)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, contents.Bytes(), 0644)
+}
+
+// writeXML writes the value as an indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,182 @@
+// Unit tests related to the feed of titles found. //
+package booklist
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const feedCatalogURL = "https://catalog.library.loudoun.gov/"
+
+func TestFeedAdd(t *testing.T) {
+	t.Log("titles are added once, newest first, keeping their IDs.")
+	feed := new(Feed)
+	if added := feed.Add(previousRun, feedCatalogURL, 10); added != 1 {
+		t.Errorf("Expected 1 entry added; got %d.", added)
+	}
+	firstID := feed.Entries[0].ID
+	if !strings.HasPrefix(firstID, "tag:booklist,2015-06-01:") {
+		t.Errorf("Unexpected entry ID %s.", firstID)
+	}
+
+	if added := feed.Add(currentRun, feedCatalogURL, 10); added != 2 {
+		t.Errorf("Expected 2 entries added; got %d.", added)
+	}
+	var titles []string
+	for _, entry := range feed.Entries {
+		titles = append(titles, entry.Format+" "+entry.Title)
+	}
+	expected := "Large Print X; Book Alert; Book X"
+	if strings.Join(titles, "; ") != expected {
+		t.Errorf("Expected entries %s; got %v.", expected, titles)
+	}
+	if feed.Entries[2].ID != firstID ||
+		!feed.Entries[2].FirstSeen.Equal(previousRun.Time) {
+		t.Errorf("Expected the first entry to keep its ID and date; got %v.",
+			feed.Entries[2])
+	}
+	if !feed.Updated.Equal(currentRun.Time) {
+		t.Errorf("Expected feed updated at %s; got %s.", currentRun.Time,
+			feed.Updated)
+	}
+
+	if added := feed.Add(currentRun, feedCatalogURL, 2); added != 0 ||
+		len(feed.Entries) != 2 || feed.Entries[1].Title != "Alert" {
+		t.Errorf("Expected the oldest entry to be dropped; got %d added "+
+			"and %v.", added, feed.Entries)
+	}
+}
+
+func TestFeedKeepFewer(t *testing.T) {
+	t.Log("titles whose entries were dropped aren't added again.")
+	fileName := filepath.Join(t.TempDir(), feedFile)
+	result := SearchResult{Author: "Grafton, Sue", Media: "Book"}
+	for _, title := range []string{"S", "T", "U", "V", "W"} {
+		result.Publications = append(result.Publications,
+			PublicationInfo{Media: "Book", Publication: title})
+	}
+	start := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	for day, expected := range []int{5, 0, 0} {
+		feed, err := LoadFeed(fileName)
+		if err != nil {
+			t.Fatalf("Load failed: %s.", err)
+		}
+		run := &RunResults{Time: start.AddDate(0, 0, day),
+			Results: []SearchResult{result}}
+		if added := feed.Add(run, feedCatalogURL, 3); added != expected {
+			t.Errorf("Expected %d entries added on day %d; got %d.",
+				expected, day+1, added)
+		}
+		if len(feed.Entries) != 3 || len(feed.Seen) != 5 {
+			t.Errorf("Expected 3 entries and 5 titles seen; got %d and %d.",
+				len(feed.Entries), len(feed.Seen))
+		}
+		if err := SaveFeed(fileName, feed); err != nil {
+			t.Fatalf("Save failed: %s.", err)
+		}
+	}
+
+	t.Log("titles gone since the oldest entry was added are forgotten.")
+	feed, err := LoadFeed(fileName)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	for day, title := range []string{"X", "Y", "Z"} {
+		run := &RunResults{Time: start.AddDate(0, 0, day+3),
+			Results: []SearchResult{{Author: "Grafton, Sue", Media: "Book",
+				Publications: []PublicationInfo{
+					{Media: "Book", Publication: title},
+				}}}}
+		feed.Add(run, feedCatalogURL, 3)
+	}
+	if len(feed.Entries) != 3 || len(feed.Seen) != 3 ||
+		feed.Entries[2].Title != "X" {
+		t.Errorf("Expected only X, Y and Z; got %v and %v.", feed.Entries,
+			feed.Seen)
+	}
+}
+
+func TestFeedFormats(t *testing.T) {
+	t.Log("the feed is written as well formed Atom and RSS.")
+	run := &RunResults{
+		Time: time.Date(2015, 6, 2, 8, 0, 0, 0, time.UTC),
+		Results: []SearchResult{{Author: "Grafton, Sue", Media: "Book",
+			Publications: []PublicationInfo{
+				{Media: "Book", Publication: "X & Y", RecordID: "2093410"},
+			}}},
+	}
+	feed := new(Feed)
+	feed.Add(run, feedCatalogURL, 10)
+	link := feedCatalogURL + "?section=resource&amp;resourceid=2093410"
+
+	var atom bytes.Buffer
+	if err := feed.WriteAtom(&atom, "New titles", feedCatalogURL); err != nil {
+		t.Fatalf("Unable to write Atom feed: %s.", err)
+	}
+	var parsedAtom struct {
+		XMLName xml.Name
+		Entries []struct {
+			ID     string `xml:"id"`
+			Title  string `xml:"title"`
+			Author string `xml:"author>name"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(atom.Bytes(), &parsedAtom); err != nil {
+		t.Fatalf("Atom feed isn't well formed: %s.", err)
+	}
+	if parsedAtom.XMLName.Space != "http://www.w3.org/2005/Atom" ||
+		len(parsedAtom.Entries) != 1 ||
+		parsedAtom.Entries[0].Title != "X & Y" ||
+		parsedAtom.Entries[0].Author != "Grafton, Sue" ||
+		parsedAtom.Entries[0].ID != feed.Entries[0].ID ||
+		!strings.Contains(atom.String(), `<link href="`+link+`">`) {
+		t.Errorf("Unexpected Atom feed:\n%s", atom.String())
+	}
+
+	var rss bytes.Buffer
+	if err := feed.WriteRSS(&rss, "New titles", feedCatalogURL); err != nil {
+		t.Fatalf("Unable to write RSS feed: %s.", err)
+	}
+	var parsedRSS struct {
+		Version string `xml:"version,attr"`
+		Items   []struct {
+			GUID    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(rss.Bytes(), &parsedRSS); err != nil {
+		t.Fatalf("RSS feed isn't well formed: %s.", err)
+	}
+	if parsedRSS.Version != "2.0" || len(parsedRSS.Items) != 1 ||
+		parsedRSS.Items[0].GUID != feed.Entries[0].ID ||
+		parsedRSS.Items[0].PubDate != "Tue, 02 Jun 2015 08:00:00 +0000" ||
+		!strings.Contains(rss.String(), "<link>"+link+"</link>") {
+		t.Errorf("Unexpected RSS feed:\n%s", rss.String())
+	}
+}
+
+func TestSaveAndLoadFeed(t *testing.T) {
+	t.Log("a saved feed is loaded unchanged.")
+	fileName := filepath.Join(t.TempDir(), "state", feedFile)
+	feed, err := LoadFeed(fileName)
+	if err != nil || len(feed.Entries) != 0 {
+		t.Errorf("Expected an empty feed before the first run; got %v, %v.",
+			feed, err)
+	}
+
+	feed.Add(currentRun, feedCatalogURL, 10)
+	if err := SaveFeed(fileName, feed); err != nil {
+		t.Fatalf("Save failed: %s.", err)
+	}
+	loaded, err := LoadFeed(fileName)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if len(loaded.Entries) != 3 || loaded.Entries[0] != feed.Entries[0] {
+		t.Errorf("Expected %v; got %v.", feed.Entries, loaded.Entries)
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the parsing of configuration files in formats other than
+YAML.  The configuration file can be written in YAML, JSON or TOML; the
+format is given explicitly or detected from the file's extension:
+
+  - .json files are JSON,
+  - .toml files are TOML,
+  - any other file, e.g., .yml or .yaml, is YAML.
+
+The keys are the same in every format, e.g., in TOML:
+
+    catalog-url = "https://catalog.library.loudoun.gov/"
+    media-type = "book"
+
+    [[authors]]
+    firstname = "Sue"
+    lastname = "Grafton"
+
+JSON and TOML files are converted to a tree of YAML nodes, with the line of
+each key and value, so that every format is decoded into the same Config
+structure, validated by the same schema and checked by CheckConfig.
+*/
+package booklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats.
+const (
+	ConfigYAML = "yaml"
+	ConfigJSON = "json"
+	ConfigTOML = "toml"
+)
+
+// ConfigFormats lists the configuration file formats.
+var ConfigFormats = []string{ConfigYAML, ConfigJSON, ConfigTOML}
+
+// DetectConfigFormat returns the format of a configuration file from its
+// extension.  Files with an unknown extension are assumed to be YAML.
+func DetectConfigFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return ConfigJSON
+	case ".toml":
+		return ConfigTOML
+	}
+	return ConfigYAML
+}
+
+// ParseConfigFormat returns the configuration file format with the given
+// name, ignoring case.  Returns an error if it isn't one of ConfigFormats.
+func ParseConfigFormat(name string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(name))
+	if !containsString(ConfigFormats, format) {
+		return "", fmt.Errorf("unknown config format '%s'; must be one of %s",
+			name, strings.Join(ConfigFormats, ", "))
+	}
+	return format, nil
+}
+
+// configNode parses the file contents in the given format into a tree of
+// YAML nodes.  Parsing errors give the line as 'line N', as for YAML.
+func configNode(in []byte, format string) (*yaml.Node, error) {
+	var root yaml.Node
+	switch format {
+	case ConfigYAML:
+		if err := yaml.Unmarshal(in, &root); err != nil {
+			return nil, err
+		}
+		return &root, nil
+	case ConfigJSON:
+		return jsonNode(in)
+	case ConfigTOML:
+		return tomlNode(in)
+	}
+	_, err := ParseConfigFormat(format)
+	return nil, err
+}
+
+// jsonNode parses JSON contents into a YAML document node.
+func jsonNode(in []byte) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(in))
+	decoder.UseNumber()
+
+	node, err := jsonValue(decoder, in)
+	if err == nil {
+		offset := decoder.InputOffset()
+		if _, err = decoder.Token(); err == io.EOF {
+			return &yaml.Node{
+				Kind:    yaml.DocumentNode,
+				Line:    1,
+				Column:  1,
+				Content: []*yaml.Node{node},
+			}, nil
+		}
+		if err == nil {
+			line, _ := jsonPosition(in, offset)
+			return nil, fmt.Errorf("line %d: unexpected content after "+
+				"the JSON value", line)
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, _ := jsonPosition(in, syntaxErr.Offset)
+		return nil, fmt.Errorf("line %d: %s", line, syntaxErr)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		line, _ := jsonPosition(in, int64(len(in)))
+		return nil, fmt.Errorf("line %d: unexpected end of JSON input", line)
+	}
+	return nil, err
+}
+
+// jsonValue reads the next JSON value from the decoder and returns it as a
+// YAML node.
+func jsonValue(decoder *json.Decoder, in []byte) (*yaml.Node, error) {
+	offset := decoder.InputOffset()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode}
+	node.Line, node.Column = jsonPosition(in, offset)
+	switch value := token.(type) {
+	case json.Delim:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		if value == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := jsonValue(decoder, in)
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, key)
+			}
+			child, err := jsonValue(decoder, in)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// Consume the closing delimiter.
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		node.Tag, node.Value = "!!str", value
+	case json.Number:
+		node.Tag, node.Value = "!!float", value.String()
+		if _, err := value.Int64(); err == nil {
+			node.Tag = "!!int"
+		}
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(value)
+	case nil:
+		node.Tag, node.Value = "!!null", "null"
+	}
+	return node, nil
+}
+
+// jsonPosition returns the line and column of the first token at or after
+// the offset in the JSON contents, skipping spaces and separators.
+func jsonPosition(in []byte, offset int64) (int, int) {
+	if offset > int64(len(in)) {
+		offset = int64(len(in))
+	}
+	for offset < int64(len(in)) && strings.IndexByte(" \t\r\n,:", in[offset]) != -1 {
+		offset++
+	}
+	line := bytes.Count(in[:offset], []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(in[:offset], '\n')
+	return line, column
+}
+
+// tomlLines records the lines of the keys in a TOML file:  the keys before
+// any table header, and for each array of tables, e.g., [[authors]], the
+// header and keys of each table.
+type tomlLines struct {
+	top    map[string]int
+	tables map[string][]map[string]int
+}
+
+// tomlNode parses TOML contents into a YAML document node.  The TOML parser
+// doesn't report the positions of the keys, so they're found by scanning
+// the lines of the file.
+func tomlNode(in []byte) (*yaml.Node, error) {
+	var values map[string]interface{}
+	if _, err := toml.NewDecoder(bytes.NewReader(in)).Decode(&values); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("line %d: %s", parseErr.Position.Line,
+				parseErr.Message)
+		}
+		return nil, err
+	}
+
+	var top yaml.Node
+	if err := top.Encode(values); err != nil {
+		return nil, err
+	}
+	lines := scanTOML(in)
+	top.Line, top.Column = 1, 1
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		key, value := top.Content[i], top.Content[i+1]
+		line := lines.top[key.Value]
+		setLine(key, line)
+		setLine(value, line)
+
+		// Each table in an array of tables is located at its header.
+		tables := lines.tables[key.Value]
+		if value.Kind != yaml.SequenceNode || len(tables) != len(value.Content) {
+			continue
+		}
+		for j, entry := range value.Content {
+			setLine(entry, tables[j][""])
+			for k := 0; k+1 < len(entry.Content); k += 2 {
+				if line, ok := tables[j][entry.Content[k].Value]; ok {
+					entry.Content[k].Line = line
+					setLine(entry.Content[k+1], line)
+				}
+			}
+		}
+	}
+	return &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Line:    1,
+		Column:  1,
+		Content: []*yaml.Node{&top},
+	}, nil
+}
+
+// setLine sets the line of a node and the nodes it contains.
+func setLine(node *yaml.Node, line int) {
+	node.Line, node.Column = line, 1
+	for _, child := range node.Content {
+		setLine(child, line)
+	}
+}
+
+// scanTOML finds the lines of the keys and table headers in TOML contents.
+// Only the simple forms used by configuration files are recognized; keys
+// that aren't found are located at line 0, i.e., nowhere in particular.
+func scanTOML(in []byte) tomlLines {
+	lines := tomlLines{
+		top:    map[string]int{},
+		tables: map[string][]map[string]int{},
+	}
+	unquote := func(key string) string {
+		return strings.Trim(strings.TrimSpace(key), `"'`)
+	}
+
+	var table map[string]int
+	for i, line := range strings.Split(string(in), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[["):
+			name := unquote(strings.Trim(line, "[] "))
+			table = map[string]int{"": i + 1}
+			lines.tables[name] = append(lines.tables[name], table)
+			if _, ok := lines.top[name]; !ok {
+				lines.top[name] = i + 1
+			}
+		case strings.HasPrefix(line, "["):
+			name := unquote(strings.Trim(line, "[] "))
+			table = map[string]int{"": i + 1}
+			lines.top[name] = i + 1
+		case strings.Contains(line, "="):
+			key := unquote(line[:strings.Index(line, "=")])
+			if table == nil {
+				lines.top[key] = i + 1
+			} else if _, ok := table[key]; !ok {
+				table[key] = i + 1
+			}
+		}
+	}
+	return lines
+}
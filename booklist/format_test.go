@@ -0,0 +1,161 @@
+// Unit tests related to configuration files in JSON and TOML. //
+package booklist
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlFormatConfig = `catalog-url: https://catalog.library.loudoun.gov/
+media-type: ebook
+authors:
+    - firstname: Sue
+      lastname: Grafton
+    - firstname: Stephen
+      lastname: King
+      media-type: large print
+`
+
+const jsonFormatConfig = `{
+    "catalog-url": "https://catalog.library.loudoun.gov/",
+    "media-type": "ebook",
+    "authors": [
+        {"firstname": "Sue", "lastname": "Grafton"},
+        {
+            "firstname": "Stephen",
+            "lastname": "King",
+            "media-type": "large print"
+        }
+    ]
+}
+`
+
+const tomlFormatConfig = `catalog-url = "https://catalog.library.loudoun.gov/"
+media-type = "ebook"
+
+[[authors]]
+firstname = "Sue"
+lastname = "Grafton"
+
+[[authors]]
+firstname = "Stephen"
+lastname = "King"
+media-type = "large print"
+`
+
+func TestConfigFormatsMatch(t *testing.T) {
+	t.Log("the same config in each format gives the same structure.")
+	expected, err := ValidateConfig([]byte(yamlFormatConfig))
+	if err != nil {
+		t.Fatalf("YAML validation failed: %s.", err)
+	}
+	for format, contents := range map[string]string{
+		ConfigJSON: jsonFormatConfig,
+		ConfigTOML: tomlFormatConfig,
+	} {
+		config, err := ValidateConfigFormat([]byte(contents), format)
+		if err != nil {
+			t.Errorf("%s validation failed: %s.", format, err)
+		} else if !reflect.DeepEqual(config, expected) {
+			t.Errorf("Expected %s config %v; got %v.", format, expected,
+				config)
+		}
+	}
+}
+
+func TestConfigFormatProblemLines(t *testing.T) {
+	t.Log("problems in JSON and TOML files are reported at their lines.")
+	tests := []struct {
+		format   string
+		contents string
+		expected []string
+	}{
+		{ConfigJSON, strings.Replace(jsonFormatConfig, `"lastname": "King"`,
+			`"lastname": "", "lastnme": "King"`, 1),
+			[]string{"8:", "8:"}},
+		{ConfigTOML, strings.Replace(tomlFormatConfig, `lastname = "King"`,
+			"lastname = \"\"\nlastnme = \"King\"", 1),
+			[]string{"10:", "11:"}},
+		{ConfigJSON, "{\n\"authors\": [\n", []string{"3:"}},
+		{ConfigJSON, "{}\n{}\n", []string{"2:"}},
+		{ConfigTOML, "catalog-url = \"x\"\nauthors = [\n", []string{"2:"}},
+	}
+	for _, test := range tests {
+		problems := CheckConfigFormat([]byte(test.contents), test.format)
+		var got []string
+		for _, problem := range problems {
+			if !problem.Warning {
+				got = append(got, problem.String())
+			}
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("Expected %d %s errors; got: %v.", len(test.expected),
+				test.format, got)
+			continue
+		}
+		for i, prefix := range test.expected {
+			if !strings.HasPrefix(got[i], prefix) {
+				t.Errorf("Expected %s error at line %s; got: %s.",
+					test.format, prefix, got[i])
+			}
+		}
+	}
+}
+
+func TestDetectConfigFormat(t *testing.T) {
+	t.Log("the config format is detected from the file extension.")
+	for fileName, expected := range map[string]string{
+		"config.yml":     ConfigYAML,
+		"config.yaml":    ConfigYAML,
+		"config":         ConfigYAML,
+		"config.json":    ConfigJSON,
+		"/a/config.TOML": ConfigTOML,
+	} {
+		if got := DetectConfigFormat(fileName); got != expected {
+			t.Errorf("Expected format %s for %s; got %s.", expected,
+				fileName, got)
+		}
+	}
+
+	if format, err := ParseConfigFormat(" JSON"); err != nil ||
+		format != ConfigJSON {
+		t.Errorf("Expected format json; got %s, %v.", format, err)
+	}
+	if _, err := ParseConfigFormat("xml"); err == nil {
+		t.Errorf("Expected error for unknown format xml.")
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	t.Log("a config file can include files in other formats.")
+	home := setHome(t)
+	writeFile(t, filepath.Join(home, "authors.toml"), `[[authors]]
+firstname = "Sue"
+lastname = "Grafton"
+`)
+	configFileName := filepath.Join(home, "config.json")
+	writeFile(t, configFileName, `{
+    "include": "authors.toml",
+    "catalog-url": "https://catalog.library.loudoun.gov/"
+}`)
+
+	loaded, err := LoadConfig(configFileName, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if len(loaded.Authors) != 1 || loaded.Authors[0].Lastname != "Grafton" {
+		t.Errorf("Unexpected merged config: %v.", loaded.Config)
+	}
+	if got := loaded.AuthorOrigin(0).String(); got !=
+		filepath.Join(home, "authors.toml")+":1" {
+		t.Errorf("Expected author to come from authors.toml:1; got %s.", got)
+	}
+
+	// The format given explicitly overrides the extension.
+	_, err = LoadConfigFormat(configFileName, ConfigTOML, nil)
+	if err == nil || !strings.Contains(err.Error(), "unable to parse TOML") {
+		t.Errorf("Expected TOML parse error; got: %v.", err)
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the history of the runs, kept in a bbolt database in the
+state directory; see StateDir.  Each run is recorded with its start and end
+times, a hash of the configuration it used, the number of titles found for
+each author, its error, if it failed, and its results.  The runs can then be
+listed and compared, e.g., to tell when a title disappeared from the catalog
+or when the library's website started failing.
+
+Only the last DefaultHistoryRuns runs are kept; older runs are dropped as
+new ones are recorded, so that the database doesn't grow without limit.
+
+The database is locked while it's open, so it's opened only for as long as
+it's needed; a second booklist process waits for the lock for up to
+historyTimeout.
+*/
+package booklist
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v3"
+)
+
+// historyFile is the name of the database, in the state directory, holding
+// the history of the runs.
+const historyFile = "history.db"
+
+// DefaultHistoryRuns is the number of runs kept in the history, e.g., two
+// years of daily runs.
+const DefaultHistoryRuns = 730
+
+// historyTimeout is how long to wait for another process to close the
+// database.
+const historyTimeout = 5 * time.Second
+
+// The database's buckets, each keyed by the run's ID.  The results are kept
+// apart from the rest of the run so that listing the runs is cheap.
+var (
+	runsBucket    = []byte("runs")
+	resultsBucket = []byte("results")
+)
+
+// ErrRunNotFound is returned for a run that isn't in the history.
+var ErrRunNotFound = errors.New("no such run")
+
+// AuthorCount is the number of titles found for an author and media type.
+type AuthorCount struct {
+	Author string
+	Media  string
+	Titles int
+}
+
+// HistoryRun is a run recorded in the history.  ID numbers the runs in the
+// order they were recorded, from 1.  ConfigHash identifies the
+// configuration used; see ConfigHash.  Counts and Results are those of the
+// authors searched, which, if the run failed, may not be all of them.
+type HistoryRun struct {
+	ID         uint64 `json:"-"`
+	Start      time.Time
+	End        time.Time
+	ConfigHash string
+	Counts     []AuthorCount
+	Error      string         `json:",omitempty"`
+	Results    []SearchResult `json:"-"`
+}
+
+// NewHistoryRun returns the run, started at the given time with the
+// configuration, for the history.  The results may be nil or incomplete if
+// the run failed with the error.
+func NewHistoryRun(config Config, start time.Time, run *RunResults, err error) *HistoryRun {
+	h := &HistoryRun{
+		Start:      start,
+		End:        time.Now(),
+		ConfigHash: ConfigHash(config),
+	}
+	if run != nil {
+		h.Results = run.Results
+		for _, result := range run.Results {
+			h.Counts = append(h.Counts, AuthorCount{
+				Author: result.Author,
+				Media:  result.Media,
+				Titles: len(result.Publications),
+			})
+		}
+	}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	return h
+}
+
+// Titles returns the number of titles found by the run.
+func (r *HistoryRun) Titles() int {
+	titles := 0
+	for _, count := range r.Counts {
+		titles += count.Titles
+	}
+	return titles
+}
+
+// ConfigHash returns a short hash of the configuration; runs with the same
+// hash searched for the same authors in the same catalog.  Only the catalog's
+// URL, the media type and the authors' names and media types are hashed, so
+// that changing the file's version or the notifiers doesn't change it.
+func ConfigHash(config Config) string {
+	searched := Config{URL: config.URL, Media: config.Media}
+	for _, author := range config.Authors {
+		author.Notify = nil
+		searched.Authors = append(searched.Authors, author)
+	}
+	contents, err := yaml.Marshal(searched)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:6])
+}
+
+// History is the database of the runs.  A nil *History has no runs.
+type History struct {
+	// Keep is the number of runs kept; the oldest runs are dropped as
+	// runs are recorded.  Zero keeps every run.
+	Keep int
+
+	db *bolt.DB
+}
+
+// HistoryPath returns the path of the database holding the history of the
+// runs.
+func HistoryPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFile), nil
+}
+
+// OpenHistory opens the history database, creating it and its directory
+// if necessary.  With readOnly, the database isn't created; nil is
+// returned, without an error, if it doesn't exist, e.g., before the first
+// run.
+func OpenHistory(fileName string, readOnly bool) (*History, error) {
+	if readOnly {
+		if _, err := os.Stat(fileName); os.IsNotExist(err) {
+			return nil, nil
+		}
+	} else if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(fileName, 0644, &bolt.Options{
+		Timeout:  historyTimeout,
+		ReadOnly: readOnly,
+	})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("unable to open history %s:  it's in use "+
+			"by another booklist process", fileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open history %s:  %s", fileName, err)
+	}
+	if !readOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{runsBucket, resultsBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to open history %s:  %s",
+				fileName, err)
+		}
+	}
+	return &History{Keep: DefaultHistoryRuns, db: db}, nil
+}
+
+// Close closes the database.
+func (h *History) Close() error {
+	if h == nil {
+		return nil
+	}
+	return h.db.Close()
+}
+
+// Record adds the run to the history and sets its ID, then drops the runs
+// beyond the number to keep.
+func (h *History) Record(run *HistoryRun) error {
+	summary, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	results, err := json.Marshal(run.Results)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := runKey(id)
+		if err := runs.Put(key, summary); err != nil {
+			return err
+		}
+		if err := tx.Bucket(resultsBucket).Put(key, results); err != nil {
+			return err
+		}
+		run.ID = id
+		if h.Keep > 0 && id > uint64(h.Keep) {
+			return dropRuns(tx, id-uint64(h.Keep))
+		}
+		return nil
+	})
+}
+
+// dropRuns deletes the runs with IDs up to and including last.
+func dropRuns(tx *bolt.Tx, last uint64) error {
+	for _, name := range [][]byte{runsBucket, resultsBucket} {
+		bucket := tx.Bucket(name)
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.First() {
+			if binary.BigEndian.Uint64(key) > last {
+				break
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs returns the runs in the history, without their results, newest
+// first.
+func (h *History) Runs() ([]*HistoryRun, error) {
+	var runs []*HistoryRun
+	if h == nil {
+		return runs, nil
+	}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			run, err := decodeRun(key, value)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// Run returns the run with the ID, with its results.  Returns
+// ErrRunNotFound if there's no such run.
+func (h *History) Run(id uint64) (*HistoryRun, error) {
+	if h == nil {
+		return nil, fmt.Errorf("%w %d", ErrRunNotFound, id)
+	}
+	var run *HistoryRun
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		key := runKey(id)
+		value := bucket.Get(key)
+		if value == nil {
+			return nil
+		}
+		var err error
+		if run, err = decodeRun(key, value); err != nil {
+			return err
+		}
+		results := tx.Bucket(resultsBucket).Get(key)
+		if results == nil {
+			return nil
+		}
+		if err := json.Unmarshal(results, &run.Results); err != nil {
+			return fmt.Errorf("unable to parse the results of run %d:  %s",
+				id, err)
+		}
+		return nil
+	})
+	if err == nil && run == nil {
+		err = fmt.Errorf("%w %d", ErrRunNotFound, id)
+	}
+	return run, err
+}
+
+// runKey returns the key of the run with the ID; keys sort in the order of
+// the IDs.
+func runKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// decodeRun returns the run stored under the key.
+func decodeRun(key, value []byte) (*HistoryRun, error) {
+	run := &HistoryRun{ID: binary.BigEndian.Uint64(key)}
+	if err := json.Unmarshal(value, run); err != nil {
+		return nil, fmt.Errorf("unable to parse run %d:  %s", run.ID, err)
+	}
+	return run, nil
+}
+
+// RunDiff is the difference between the results of two runs.  Added are the
+// titles found only by the newer run; Removed are those found only by the
+// older one.
+type RunDiff struct {
+	Added   []SearchResult
+	Removed []SearchResult
+}
+
+// DiffRuns returns the difference between the results of the older and
+// newer runs.  Only the authors and media types searched by both runs are
+// compared, so that the titles of an author left out of a run, because the
+// run failed first or the configuration changed, don't seem to have
+// disappeared.
+func DiffRuns(older, newer *HistoryRun) RunDiff {
+	searched := func(run *HistoryRun) map[string]bool {
+		keys := make(map[string]bool)
+		for _, result := range run.Results {
+			keys[result.Author+"\x00"+result.Media] = true
+		}
+		return keys
+	}
+	inOlder, inNewer := searched(older), searched(newer)
+	common := func(run *HistoryRun, other map[string]bool) *RunResults {
+		results := &RunResults{Time: run.Start}
+		for _, result := range run.Results {
+			if other[result.Author+"\x00"+result.Media] {
+				results.Results = append(results.Results, result)
+			}
+		}
+		return results
+	}
+	olderResults, newerResults := common(older, inNewer), common(newer, inOlder)
+	return RunDiff{
+		Added:   newerResults.NewSince(olderResults),
+		Removed: olderResults.NewSince(newerResults),
+	}
+}
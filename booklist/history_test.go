@@ -0,0 +1,206 @@
+// Unit tests related to the history of the runs. //
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestHistory returns a new history database in a temporary directory.
+func openTestHistory(t *testing.T) (*History, string) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "state", historyFile)
+	history, err := OpenHistory(fileName, false)
+	if err != nil {
+		t.Fatalf("Unable to open the history: %s.", err)
+	}
+	t.Cleanup(func() { history.Close() })
+	return history, fileName
+}
+
+func TestHistoryRecord(t *testing.T) {
+	t.Log("recorded runs are listed newest first, without their results.")
+	history, _ := openTestHistory(t)
+	config := Config{URL: serverLibrary,
+		Authors: []AuthorInfo{{Firstname: "Sue", Lastname: "Grafton"}}}
+	first := NewHistoryRun(config, previousRun.Time, previousRun, nil)
+	second := NewHistoryRun(config, currentRun.Time, currentRun,
+		errors.New("search failed"))
+	for _, run := range []*HistoryRun{first, second} {
+		if err := history.Record(run); err != nil {
+			t.Fatalf("Unable to record the run: %s.", err)
+		}
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Expected runs 1 and 2; got %d and %d.", first.ID,
+			second.ID)
+	}
+
+	runs, err := history.Runs()
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("Expected 2 runs; got %v, %v.", runs, err)
+	}
+	if runs[0].ID != 2 || !runs[0].Start.Equal(currentRun.Time) ||
+		runs[0].Error != "search failed" || runs[0].Titles() != 3 ||
+		runs[0].Results != nil {
+		t.Errorf("Unexpected newest run %+v.", runs[0])
+	}
+	expected := []AuthorCount{
+		{Author: "Grafton, Sue", Media: "Book", Titles: 2},
+		{Author: "King, Stephen", Media: "Book", Titles: 0},
+		{Author: "Patterson, James", Media: "Book", Titles: 1},
+	}
+	if !reflect.DeepEqual(runs[0].Counts, expected) {
+		t.Errorf("Expected counts %v; got %v.", expected, runs[0].Counts)
+	}
+	if runs[0].ConfigHash == "" || runs[0].ConfigHash != runs[1].ConfigHash {
+		t.Errorf("Expected the same config hash; got '%s' and '%s'.",
+			runs[0].ConfigHash, runs[1].ConfigHash)
+	}
+
+	t.Log("a run is returned with its results.")
+	run, err := history.Run(1)
+	if err != nil {
+		t.Fatalf("Unable to get run 1: %s.", err)
+	}
+	if !reflect.DeepEqual(run.Results, previousRun.Results) {
+		t.Errorf("Expected results %v; got %v.", previousRun.Results,
+			run.Results)
+	}
+	if _, err := history.Run(3); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Expected run 3 not to be found; got %v.", err)
+	}
+}
+
+func TestHistoryKeep(t *testing.T) {
+	t.Log("only the last runs are kept, with their results.")
+	history, _ := openTestHistory(t)
+	if history.Keep != DefaultHistoryRuns {
+		t.Errorf("Expected %d runs to be kept; got %d.", DefaultHistoryRuns,
+			history.Keep)
+	}
+	history.Keep = 3
+	for i := 0; i < 5; i++ {
+		run := NewHistoryRun(Config{}, time.Now(), currentRun, nil)
+		if err := history.Record(run); err != nil {
+			t.Fatalf("Unable to record the run: %s.", err)
+		}
+	}
+
+	runs, err := history.Runs()
+	if err != nil || len(runs) != 3 || runs[0].ID != 5 || runs[2].ID != 3 {
+		t.Fatalf("Expected runs 5 to 3; got %v, %v.", runs, err)
+	}
+	if _, err := history.Run(2); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Expected run 2 to be dropped; got %v.", err)
+	}
+	run, err := history.Run(3)
+	if err != nil || !reflect.DeepEqual(run.Results, currentRun.Results) {
+		t.Errorf("Expected run 3 with its results; got %+v, %v.", run, err)
+	}
+	err = history.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(resultsBucket).Stats().KeyN; n != 3 {
+			return fmt.Errorf("%d results", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected the results of 3 runs; got %s.", err)
+	}
+}
+
+func TestHistoryReadOnly(t *testing.T) {
+	t.Log("a history that doesn't exist has no runs.")
+	fileName := filepath.Join(t.TempDir(), historyFile)
+	history, err := OpenHistory(fileName, true)
+	if err != nil || history != nil {
+		t.Fatalf("Expected no history; got %v, %v.", history, err)
+	}
+	if runs, err := history.Runs(); err != nil || len(runs) != 0 {
+		t.Errorf("Expected no runs; got %v, %v.", runs, err)
+	}
+	if _, err := history.Run(1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Expected run 1 not to be found; got %v.", err)
+	}
+
+	t.Log("recorded runs are read back once the history is closed.")
+	history, fileName = openTestHistory(t)
+	if err := history.Record(NewHistoryRun(Config{}, time.Now(), currentRun, nil)); err != nil {
+		t.Fatalf("Unable to record the run: %s.", err)
+	}
+	history.Close()
+	history, err = OpenHistory(fileName, true)
+	if err != nil {
+		t.Fatalf("Unable to open the history: %s.", err)
+	}
+	defer history.Close()
+	if runs, err := history.Runs(); err != nil || len(runs) != 1 {
+		t.Errorf("Expected 1 run; got %v, %v.", runs, err)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	t.Log("the config hash changes with the authors.")
+	config := Config{URL: serverLibrary,
+		Authors: []AuthorInfo{{Firstname: "Sue", Lastname: "Grafton"}}}
+	hash := ConfigHash(config)
+	if len(hash) != 12 || hash != ConfigHash(config) {
+		t.Errorf("Expected a stable 12 digit hash; got '%s'.", hash)
+	}
+	config.Authors = append(config.Authors,
+		AuthorInfo{Firstname: "Stephen", Lastname: "King"})
+	if ConfigHash(config) == hash {
+		t.Errorf("Expected the hash to change with the authors.")
+	}
+
+	t.Log("the config hash doesn't change with the version or notifiers.")
+	hash = ConfigHash(config)
+	config.Version = 2
+	config.Notify = &NotifyConfig{Webhooks: []WebhookConfig{
+		{URL: "https://hooks.example.org/booklist"}}}
+	config.Authors[0].Notify = []string{"email"}
+	if ConfigHash(config) != hash {
+		t.Errorf("Expected the same hash without the searched keys " +
+			"changing.")
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	t.Log("the titles found by only one of the runs are added or removed.")
+	older := &HistoryRun{Results: currentRun.Results}
+	newer := &HistoryRun{Results: []SearchResult{
+		{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Book", Publication: "X"},
+			{Media: "Book", Publication: "Y"},
+		}},
+		{Author: "King, Stephen", Media: "Book"},
+	}}
+	diff := DiffRuns(older, newer)
+	expected := RunDiff{
+		Added: []SearchResult{
+			{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+				{Media: "Book", Publication: "Y"},
+			}},
+		},
+		Removed: []SearchResult{
+			{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+				{Media: "Large Print", Publication: "X"},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected diff %+v; got %+v.", expected, diff)
+	}
+
+	t.Log("the authors not searched by both runs aren't compared.")
+	if diff := DiffRuns(older, &HistoryRun{}); diff.Added != nil ||
+		diff.Removed != nil {
+		t.Errorf("Expected no changes from a failed run; got %+v.", diff)
+	}
+}
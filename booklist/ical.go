@@ -0,0 +1,198 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the export of expected future releases as an iCalendar
+(.ics) file, so that upcoming titles can be seen in a calendar app.  Titles
+not yet published are usually in the catalog without a known publication
+year, which is why a search for this year also searches for titles of an
+unknown year.  Some of their records give an expected publication date;
+each title with a date that's still to come, known at least to the month,
+gets an all-day calendar entry on that date, or on the first of the month.
+Titles with only a year are left out, as an entry on January 1 would be
+misleading.
+*/
+package booklist
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReleaseDateFields are the fields of a search result that may hold a
+// publication's date, in order of preference.  The catalog's search
+// results give 'publicationDate'; a catalog that reports the expected date
+// of titles on order in another field can be supported by adding the
+// field here.
+var ReleaseDateFields = []string{"publicationDate"}
+
+// releaseDateLayouts are the formats of the full dates recognized by
+// ParseReleaseDate; releaseMonthLayouts are those of the dates known only
+// to the month.
+var (
+	releaseDateLayouts = []string{"2006-01-02", "2006/01/02", "01/02/2006",
+		"1/2/2006", "January 2, 2006", "Jan 2, 2006", "2 January 2006",
+		"2 Jan 2006", "20060102"}
+	releaseMonthLayouts = []string{"2006-01", "January 2006", "Jan 2006",
+		"01/2006", "1/2006"}
+)
+
+// releaseDateTrim matches the decoration around a catalog's dates, e.g.,
+// the brackets and copyright sign in '[c2027.]'.
+var releaseDateTrim = regexp.MustCompile(`^[\[(\s]*(?:c|©|p)?\s*|[\])?.\s]*$`)
+
+// Release is a title expected to be released on Date.  If ByMonth is set,
+// only the month of the release is known.
+type Release struct {
+	Author      string
+	Media       string
+	Publication PublicationInfo
+	Date        time.Time
+	ByMonth     bool
+}
+
+// releaseDate returns the first of the ReleaseDateFields in a search
+// result, or an empty string if it has none.
+func releaseDate(resource resourceInfo) string {
+	for _, field := range ReleaseDateFields {
+		if date, ok := resource[field].(string); ok && date != "" {
+			return date
+		}
+	}
+	return ""
+}
+
+// ParseReleaseDate parses a publication date given by the catalog.  Returns
+// the date, whether it's known only to the month, and false if it's not a
+// date known at least to the month, e.g., a year or 'unknown'.
+func ParseReleaseDate(date string) (time.Time, bool, bool) {
+	date = releaseDateTrim.ReplaceAllString(date, "")
+	for _, layout := range releaseDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, false, true
+		}
+	}
+	for _, layout := range releaseMonthLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// ExpectedReleases returns the titles in the run expected to be released
+// on or after the given day, ordered by date.
+func ExpectedReleases(run *RunResults, from time.Time) []Release {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0,
+		time.UTC)
+	var releases []Release
+	for _, result := range run.Results {
+		for _, pub := range result.Publications {
+			date, byMonth, ok := ParseReleaseDate(pub.Date)
+			if !ok {
+				continue
+			}
+			last := date
+			if byMonth {
+				last = date.AddDate(0, 1, -1)
+			}
+			if last.Before(from) {
+				continue
+			}
+			releases = append(releases, Release{
+				Author:      result.Author,
+				Media:       result.Media,
+				Publication: pub,
+				Date:        date,
+				ByMonth:     byMonth,
+			})
+		}
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].Date.Before(releases[j].Date)
+	})
+	return releases
+}
+
+// WriteICS writes the releases as an iCalendar file with an all-day event
+// for each.  The events link to the publications' records in the catalog
+// with the given url.  Each event's UID is derived from the publication,
+// so a calendar that imports the file again updates the events rather
+// than adding them twice.
+func WriteICS(w io.Writer, releases []Release, catalogURL string, stamp time.Time) error {
+	var b strings.Builder
+	line := func(name, value string) {
+		foldICSLine(&b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//booklist//Expected releases//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", "Expected releases")
+	for _, release := range releases {
+		pub := release.Publication
+		sum := sha1.Sum([]byte(publicationKey(SearchResult{
+			Author: release.Author,
+			Media:  release.Media,
+		}, pub)))
+		expected := "Expected " + release.Date.Format("January 2, 2006")
+		if release.ByMonth {
+			expected = "Expected in " + release.Date.Format("January 2006")
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", hex.EncodeToString(sum[:])+"@booklist")
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE", release.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE", release.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escapeICS(fmt.Sprintf("%s (%s)", pub.Publication,
+			release.Author)))
+		line("DESCRIPTION", escapeICS(fmt.Sprintf("%s by %s. %s.",
+			pub.Media, release.Author, expected)))
+		line("CATEGORIES", escapeICS(pub.Media))
+		line("URL", RecordURL(catalogURL, pub.RecordID))
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteICSFile writes the releases as an iCalendar file, as by WriteICS,
+// replacing the named file in one step so that a calendar app never reads
+// it half written.
+func WriteICSFile(fileName string, releases []Release, catalogURL string, stamp time.Time) error {
+	var contents bytes.Buffer
+	if err := WriteICS(&contents, releases, catalogURL, stamp); err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, contents.Bytes(), 0644)
+}
+
+// escapeICS escapes the special characters in an iCalendar text value.
+var escapeICS = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`,
+	"\n", `\n`).Replace
+
+// foldICSLine writes a content line, folded to lines of at most 75 octets
+// as iCalendar requires, without splitting a UTF-8 character.
+func foldICSLine(b *strings.Builder, s string) {
+	const maxLine = 75
+	width := maxLine
+	for len(s) > width {
+		cut := width
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		width = maxLine - 1
+	}
+	b.WriteString(s + "\r\n")
+}
@@ -0,0 +1,112 @@
+// Unit tests related to the export of expected releases. //
+package booklist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReleaseDate(t *testing.T) {
+	t.Log("dates known at least to the month are recognized.")
+	for _, test := range []struct {
+		date     string
+		expected string
+		byMonth  bool
+		ok       bool
+	}{
+		{"2027-03-10", "2027-03-10", false, true},
+		{"March 10, 2027", "2027-03-10", false, true},
+		{"[Mar 10, 2027]", "2027-03-10", false, true},
+		{"03/10/2027", "2027-03-10", false, true},
+		{"March 2027.", "2027-03-01", true, true},
+		{"2027-03", "2027-03-01", true, true},
+		{"2027", "", false, false},
+		{"[c2027]", "", false, false},
+		{"unknown", "", false, false},
+		{"", "", false, false},
+	} {
+		date, byMonth, ok := ParseReleaseDate(test.date)
+		if ok != test.ok || byMonth != test.byMonth ||
+			(ok && date.Format("2006-01-02") != test.expected) {
+			t.Errorf("Expected '%s' to parse as %s, by month %t, %t; got "+
+				"%s, %t, %t.", test.date, test.expected, test.byMonth,
+				test.ok, date.Format("2006-01-02"), byMonth, ok)
+		}
+	}
+}
+
+func TestExpectedReleases(t *testing.T) {
+	t.Log("only releases still to come are exported, ordered by date.")
+	run := &RunResults{
+		Time: time.Date(2027, 3, 15, 8, 0, 0, 0, time.UTC),
+		Results: []SearchResult{
+			{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+				{Media: "Book", Publication: "Y is for yesterday", Date: "2027-08-22"},
+				{Media: "Book", Publication: "X", Date: "2027"},
+				{Media: "Book", Publication: "W is for wasted", Date: "2027-03-01"},
+			}},
+			{Author: "King, Stephen", Media: "Book", Publications: []PublicationInfo{
+				{Media: "Book on CD", Publication: "Later; a novel, unabridged",
+					RecordID: "42", Date: "March 2027"},
+			}},
+		},
+	}
+	releases := ExpectedReleases(run, run.Time)
+	if len(releases) != 2 ||
+		releases[0].Publication.Publication != "Later; a novel, unabridged" ||
+		!releases[0].ByMonth ||
+		releases[1].Publication.Publication != "Y is for yesterday" {
+		t.Fatalf("Expected releases in March and August; got %v.", releases)
+	}
+
+	var ics bytes.Buffer
+	err := WriteICS(&ics, releases, feedCatalogURL, run.Time)
+	if err != nil {
+		t.Fatalf("Unable to write iCalendar file: %s.", err)
+	}
+	contents := ics.String()
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"DTSTART;VALUE=DATE:20270301\r\nDTEND;VALUE=DATE:20270302\r\n",
+		`SUMMARY:Later\; a novel\, unabridged (King\, Stephen)`,
+		"DESCRIPTION:Book on CD by King\\, Stephen. Expected in March 2027.",
+		"DTSTART;VALUE=DATE:20270822\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(contents, expected) {
+			t.Errorf("Expected iCalendar file to contain %q; got:\n%s",
+				expected, contents)
+		}
+	}
+	for _, line := range strings.Split(contents, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets; got %q.", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(contents, "\r\n ", "")
+	if !strings.Contains(unfolded, "URL:"+feedCatalogURL+
+		"?section=resource&resourceid=42\r\n") {
+		t.Errorf("Expected a link to the record; got:\n%s", contents)
+	}
+
+	t.Log("the iCalendar file is written without a temporary file left.")
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "releases.ics")
+	err = WriteICSFile(fileName, releases, feedCatalogURL, run.Time)
+	if err != nil {
+		t.Fatalf("Unable to write iCalendar file: %s.", err)
+	}
+	written, err := ioutil.ReadFile(fileName)
+	if err != nil || string(written) != contents {
+		t.Errorf("Expected the file to contain:\n%s\ngot:\n%s", contents,
+			written)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected only the iCalendar file; got %d files.",
+			len(files))
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains functions for importing authors from the lists kept by
+other services, for adding to the configuration file.  The supported
+formats are:
+
+  - a Goodreads library export (CSV),
+  - a StoryGraph export (CSV),
+  - OPML, taking the name of each outline that has no children,
+  - plain text, with one name per line.
+
+The names are split into first and last names; see SplitName.
+*/
+package booklist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Import formats accepted by ImportAuthors.
+const (
+	FormatGoodreads  = "goodreads"
+	FormatStoryGraph = "storygraph"
+	FormatOPML       = "opml"
+	FormatText       = "text"
+)
+
+// ImportFormats lists the import formats.
+var ImportFormats = []string{FormatGoodreads, FormatStoryGraph, FormatOPML,
+	FormatText}
+
+// CompoundSurnames lists surnames of more than one word that can't be
+// recognized by a leading particle, such as 'van' or 'Le'.  The comparison
+// ignores case.
+var CompoundSurnames = []string{
+	"Bonham Carter",
+	"García Márquez",
+	"Garcia Marquez",
+	"Lloyd Webber",
+	"McCall Smith",
+	"Vargas Llosa",
+}
+
+// surnameParticles are words that begin a surname of more than one word,
+// e.g., 'Ursula K. Le Guin'.
+var surnameParticles = map[string]bool{
+	"da": true, "de": true, "del": true, "della": true, "der": true,
+	"di": true, "dos": true, "du": true, "la": true, "le": true,
+	"st.": true, "ten": true, "ter": true, "van": true, "von": true,
+}
+
+// nameSuffixes are words following a surname that aren't part of it.
+var nameSuffixes = map[string]bool{
+	"jr": true, "jr.": true, "sr": true, "sr.": true,
+	"ii": true, "iii": true, "iv": true, "phd": true, "ph.d.": true,
+}
+
+// SplitName splits an author's name into the first and last names.  The
+// name may be given as 'Lastname, Firstname' or as 'Firstname Lastname'.
+// In the latter case, the last name is the final word of the name,
+// extended to include a preceding particle, such as 'van', or a preceding
+// word of one of the CompoundSurnames.  Suffixes such as 'Jr.' are
+// dropped.  The first name is empty if the name is a single word.
+func SplitName(name string) (firstname, lastname string) {
+	name = strings.Join(strings.Fields(name), " ")
+	if i := strings.Index(name, ","); i != -1 {
+		lastname = strings.TrimSpace(name[:i])
+		firstname = strings.TrimSpace(name[i+1:])
+
+		// A comma may instead separate a suffix, e.g., 'Sammy Davis, Jr.'
+		if !nameSuffixes[strings.ToLower(firstname)] {
+			if j := strings.Index(firstname, ","); j != -1 {
+				firstname = strings.TrimSpace(firstname[:j])
+			}
+			return firstname, lastname
+		}
+		name = lastname
+	}
+
+	words := strings.Fields(name)
+	for len(words) > 1 && nameSuffixes[strings.ToLower(words[len(words)-1])] {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return "", ""
+	}
+
+	// Find the first word of the last name.
+	start := len(words) - 1
+	for _, surname := range CompoundSurnames {
+		n := len(strings.Fields(surname))
+		if n < len(words) && strings.EqualFold(
+			strings.Join(words[len(words)-n:], " "), surname) {
+			start = len(words) - n
+			break
+		}
+	}
+	for start > 1 && surnameParticles[strings.ToLower(words[start-1])] {
+		start--
+	}
+
+	return strings.Join(words[:start], " "), strings.Join(words[start:], " ")
+}
+
+// DetectImportFormat returns the import format of a file from its name and
+// the start of its contents.
+func DetectImportFormat(fileName string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".opml", ".xml":
+		return FormatOPML
+	}
+
+	firstLine := head
+	if i := bytes.IndexByte(head, '\n'); i != -1 {
+		firstLine = head[:i]
+	}
+	firstLine = bytes.TrimPrefix(firstLine, []byte("\ufeff"))
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(firstLine), []byte("<")):
+		return FormatOPML
+	case bytes.Contains(firstLine, []byte("Author l-f")):
+		return FormatGoodreads
+	case bytes.HasPrefix(firstLine, []byte("Title,Authors")):
+		return FormatStoryGraph
+	}
+	return FormatText
+}
+
+// ImportAuthors reads the authors from a file in the given format.  Each
+// author is returned once, in the order first seen.  The names that
+// couldn't be split into a first and last name are returned separately.
+func ImportAuthors(r io.Reader, format string) (authors []AuthorInfo, skipped []string, err error) {
+	var names []string
+	switch format {
+	case FormatGoodreads:
+		names, err = csvNames(r, "Author l-f", "Author", false)
+	case FormatStoryGraph:
+		names, err = csvNames(r, "Authors", "", true)
+	case FormatOPML:
+		names, err = opmlNames(r)
+	case FormatText:
+		names, err = textNames(r)
+	default:
+		err = fmt.Errorf("unsupported import format '%s'; must be one of %s",
+			format, strings.Join(ImportFormats, ", "))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		firstname, lastname := SplitName(name)
+		if firstname == "" || lastname == "" {
+			if strings.TrimSpace(name) != "" {
+				skipped = append(skipped, name)
+			}
+			continue
+		}
+		key := authorKey(firstname, lastname)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		authors = append(authors, AuthorInfo{
+			Firstname: firstname,
+			Lastname:  lastname,
+		})
+	}
+	return authors, skipped, nil
+}
+
+// csvNames returns the names in the column of a CSV file with a header
+// line.  If the column is missing or empty in a row, the alternate column
+// is used.  If split is true, the column holds a comma separated list of
+// names.
+func csvNames(r io.Reader, column, alternate string, split bool) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV header:  %s", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	col, ok := index[column]
+	alt, altOK := index[alternate]
+	altOK = altOK && alternate != ""
+	if !ok && !altOK {
+		return nil, fmt.Errorf("CSV file has no '%s' column", column)
+	}
+
+	var names []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CSV file:  %s", err)
+		}
+
+		var value string
+		if ok && col < len(record) {
+			value = strings.TrimSpace(record[col])
+		}
+		if value == "" && altOK && alt < len(record) {
+			value = strings.TrimSpace(record[alt])
+		}
+		if split {
+			names = append(names, strings.Split(value, ",")...)
+		} else {
+			names = append(names, value)
+		}
+	}
+	return names, nil
+}
+
+// opmlOutline is an outline element of an OPML file.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlNames returns the names of the outlines in an OPML file that have no
+// children.
+func opmlNames(r io.Reader) ([]string, error) {
+	var doc struct {
+		Outlines []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unable to parse OPML file:  %s", err)
+	}
+
+	var names []string
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			if len(outline.Outlines) != 0 {
+				walk(outline.Outlines)
+				continue
+			}
+			name := outline.Text
+			if name == "" {
+				name = outline.Title
+			}
+			names = append(names, name)
+		}
+	}
+	walk(doc.Outlines)
+	return names, nil
+}
+
+// textNames returns the names in a text file with one name per line.
+// Blank lines and lines beginning with '#' are ignored.
+func textNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// MergeAuthors adds the authors that aren't already listed to the end of
+// the authors list and returns those added.
+func (ed *ConfigEditor) MergeAuthors(authors []AuthorInfo) ([]AuthorInfo, error) {
+	var added []AuthorInfo
+	for _, author := range authors {
+		err := ed.AddAuthor(author)
+		if err == nil {
+			added = append(added, author)
+		} else if !errors.Is(err, ErrDuplicateAuthor) {
+			return added, err
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,147 @@
+// Unit tests related to importing authors. //
+package booklist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitName(t *testing.T) {
+	t.Log("names are split into first and last names.")
+	testCases := []struct {
+		name, firstname, lastname string
+	}{
+		{"Sue Grafton", "Sue", "Grafton"},
+		{"Grafton, Sue", "Sue", "Grafton"},
+		{"  Sue   Grafton ", "Sue", "Grafton"},
+		{"Alexander McCall Smith", "Alexander", "McCall Smith"},
+		{"McCall Smith, Alexander", "Alexander", "McCall Smith"},
+		{"Ursula K. Le Guin", "Ursula K.", "Le Guin"},
+		{"Ludwig van Beethoven", "Ludwig", "van Beethoven"},
+		{"J.R.R. Tolkien", "J.R.R.", "Tolkien"},
+		{"Martin Luther King Jr.", "Martin Luther", "King"},
+		{"Sammy Davis, Jr.", "Sammy", "Davis"},
+		{"Van Morrison", "Van", "Morrison"},
+		{"Homer", "", "Homer"},
+	}
+	for _, tc := range testCases {
+		firstname, lastname := SplitName(tc.name)
+		if firstname != tc.firstname || lastname != tc.lastname {
+			t.Errorf("Expected '%s' to split into '%s' and '%s'; got "+
+				"'%s' and '%s'.", tc.name, tc.firstname, tc.lastname,
+				firstname, lastname)
+		}
+	}
+}
+
+// importNames imports the authors and returns them as 'Lastname, Firstname'.
+func importNames(t *testing.T, contents, format string) ([]string, []string) {
+	authors, skipped, err := ImportAuthors(strings.NewReader(contents), format)
+	if err != nil {
+		t.Fatalf("Import failed: %s.", err)
+	}
+	var names []string
+	for _, author := range authors {
+		names = append(names, author.Lastname+", "+author.Firstname)
+	}
+	return names, skipped
+}
+
+func TestImportGoodreads(t *testing.T) {
+	t.Log("authors are imported from a Goodreads export.")
+	const export = `Book Id,Title,Author,Author l-f,Additional Authors,ISBN
+1,"A is for Alibi",Sue Grafton,"Grafton, Sue",,"=""0312938993"""
+2,"The No. 1 Ladies' Detective Agency",Alexander McCall Smith,"McCall Smith, Alexander",,
+3,"B is for Burglar",Sue Grafton,"Grafton, Sue",,
+4,"The Iliad",Homer,,"Robert Fagles",
+5,"The Shining",Stephen King,,,
+`
+	names, skipped := importNames(t, export, FormatGoodreads)
+	expected := "Grafton, Sue|McCall Smith, Alexander|King, Stephen"
+	if strings.Join(names, "|") != expected {
+		t.Errorf("Expected %s; got %v.", expected, names)
+	}
+	if len(skipped) != 1 || skipped[0] != "Homer" {
+		t.Errorf("Expected Homer to be skipped; got %v.", skipped)
+	}
+}
+
+func TestImportStoryGraph(t *testing.T) {
+	t.Log("authors are imported from a StoryGraph export.")
+	const export = `Title,Authors,Contributors,ISBN/UID,Format,Read Status
+Good Omens,"Terry Pratchett, Neil Gaiman",,9780060853983,paperback,read
+Coraline,Neil Gaiman,,9780380807345,hardcover,to-read
+`
+	names, _ := importNames(t, export, FormatStoryGraph)
+	expected := "Pratchett, Terry|Gaiman, Neil"
+	if strings.Join(names, "|") != expected {
+		t.Errorf("Expected %s; got %v.", expected, names)
+	}
+}
+
+func TestImportOPMLAndText(t *testing.T) {
+	t.Log("authors are imported from OPML and plain text files.")
+	const opml = `<?xml version="1.0"?>
+<opml version="2.0">
+  <head><title>Authors</title></head>
+  <body>
+    <outline text="Mysteries">
+      <outline text="Sue Grafton"/>
+      <outline title="Alexander McCall Smith"/>
+    </outline>
+    <outline text="King, Stephen"/>
+  </body>
+</opml>`
+	names, _ := importNames(t, opml, FormatOPML)
+	expected := "Grafton, Sue|McCall Smith, Alexander|King, Stephen"
+	if strings.Join(names, "|") != expected {
+		t.Errorf("Expected %s from OPML; got %v.", expected, names)
+	}
+
+	const text = "# Favorites\nSue Grafton\n\nKing, Stephen\nsue grafton\n"
+	names, _ = importNames(t, text, FormatText)
+	if strings.Join(names, "|") != "Grafton, Sue|King, Stephen" {
+		t.Errorf("Expected Grafton and King from text; got %v.", names)
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	t.Log("the import format is detected from the file.")
+	testCases := []struct {
+		fileName, head, format string
+	}{
+		{"goodreads_library_export.csv",
+			"Book Id,Title,Author,Author l-f,Additional Authors\n",
+			FormatGoodreads},
+		{"export.csv", "Title,Authors,Contributors,ISBN/UID\n",
+			FormatStoryGraph},
+		{"feeds.opml", "", FormatOPML},
+		{"authors", "<?xml version=\"1.0\"?>\n<opml>", FormatOPML},
+		{"authors.txt", "Sue Grafton\n", FormatText},
+	}
+	for _, tc := range testCases {
+		format := DetectImportFormat(tc.fileName, []byte(tc.head))
+		if format != tc.format {
+			t.Errorf("Expected %s to be detected as %s; got %s.",
+				tc.fileName, tc.format, format)
+		}
+	}
+}
+
+func TestMergeAuthors(t *testing.T) {
+	t.Log("merging authors skips those already listed.")
+	ed, err := NewConfigEditor([]byte(editConfig))
+	if err != nil {
+		t.Fatalf("Unable to parse config: %s.", err)
+	}
+	added, err := ed.MergeAuthors([]AuthorInfo{
+		{Firstname: "SUE", Lastname: "grafton"},
+		{Firstname: "Alexander", Lastname: "McCall Smith"},
+	})
+	if err != nil {
+		t.Fatalf("Merge failed: %s.", err)
+	}
+	if len(added) != 1 || added[0].Lastname != "McCall Smith" {
+		t.Errorf("Expected only McCall Smith to be added; got %v.", added)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the handling of configuration files that include other
+files, e.g., to share a list of authors between people who use different
+libraries:
+
+    include:
+        - shared-authors.yml
+    catalog-url: https://catalog.library.loudoun.gov/
+    authors:
+        - firstname: Sue
+          lastname: Grafton
+          media-type: ebook
+
+The value of 'include' is a file name or a list of file names, relative to
+the directory of the including file.  An included file can be in any of
+ConfigFormats, detected from its extension.  The included files are merged
+first, in order, then the including file's keys:  catalog-url and media-type
+replace those of the included files, while the authors are added to the
+authors of the included files.  An author listed more than once is kept at
+the position of the first listing, with the values of the last; this lets an
+including file change the media type of a shared author.  The notify key of
+the including file replaces that of the included files.
+
+Errors name the file, and where possible the line, that they originate in.
+*/
+package booklist
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// authorSource records where an author in the merged configuration came
+// from.  The node is the author's entry in the file; it's nil for authors
+// that came from an override.
+type authorSource struct {
+	origin Origin
+	node   *yaml.Node
+}
+
+// readFile merges the configuration file, and the files it includes, into
+// the configuration.  If the format is empty, it's detected from the file
+// name.  The format of each included file is detected from its name.
+func (loaded *LoadedConfig) readFile(configFileName, format string) error {
+	in, path, err := ReadConfig(configFileName)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = DetectConfigFormat(path)
+	}
+	loaded.Path = path
+	return loaded.mergeFile(path, format, in, nil)
+}
+
+// includeFile merges an included file.  The stack holds the paths of the
+// files including it, outermost first, and is used to detect cycles.
+func (loaded *LoadedConfig) includeFile(path string, line int, stack []string) error {
+	includer := stack[len(stack)-1]
+	for i, previous := range stack {
+		if previous == path {
+			cycle := append(append([]string{}, stack[i:]...), path)
+			return fmt.Errorf("%s:%d: include cycle: %s", includer, line,
+				strings.Join(cycle, " -> "))
+		}
+	}
+
+	in, _, err := ReadConfig(path)
+	if err != nil {
+		return fmt.Errorf("%s:%d: unable to include file:  %s",
+			includer, line, err)
+	}
+	return loaded.mergeFile(path, DetectConfigFormat(path), in, stack)
+}
+
+// mergeFile merges the files included by a configuration file followed by
+// the file's own keys.
+func (loaded *LoadedConfig) mergeFile(path, format string, in []byte, stack []string) error {
+	stack = append(stack, path)
+	loaded.Files = append(loaded.Files, path)
+	config, root, err := parseConfig(in, format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	top := documentNode(root)
+	if err := checkVersion(config); err != nil {
+		return fmt.Errorf("%s:%d: %w", path,
+			mappingValue(top, "version").Line, err)
+	}
+
+	// The version of the merged configuration is the including file's;
+	// each included file may have its own.
+	if len(stack) == 1 {
+		loaded.Version = config.Version
+	}
+
+	includes, err := includeNodes(top)
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	for _, include := range includes {
+		includePath := relativePath(path, include.Value)
+		if err := loaded.includeFile(includePath, include.Line, stack); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range ConfigKeys {
+		node := mappingValue(top, key)
+		if node == nil {
+			continue
+		}
+		origin := Origin{Source: SourceFile, Name: path, Line: node.Line}
+		switch key {
+		case "catalog-url":
+			loaded.URL = config.URL
+		case "media-type":
+			loaded.Media = config.Media
+		case "authors":
+			if node.Kind == yaml.SequenceNode {
+				for i, author := range config.Authors {
+					loaded.mergeAuthor(author, authorSource{
+						origin: Origin{
+							Source: SourceFile,
+							Name:   path,
+							Line:   node.Content[i].Line,
+						},
+						node: node.Content[i],
+					})
+				}
+			}
+		}
+		loaded.Origins[key] = origin
+	}
+
+	// The notifiers are configured by a single file, and the templates
+	// they name are relative to it.
+	if node := mappingValue(top, "notify"); node != nil {
+		loaded.Notify = config.Notify
+		if loaded.Notify != nil && loaded.Notify.Email != nil {
+			email := loaded.Notify.Email
+			email.HTMLTemplate = relativePath(path, email.HTMLTemplate)
+			email.TextTemplate = relativePath(path, email.TextTemplate)
+		}
+		loaded.Origins["notify"] = Origin{
+			Source: SourceFile,
+			Name:   path,
+			Line:   node.Line,
+		}
+	}
+	return nil
+}
+
+// relativePath returns the path of a file named in a configuration file,
+// relative to the configuration file's directory.
+func relativePath(configPath, name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(configPath), name)
+}
+
+// mergeAuthor adds an author to the merged configuration, or replaces the
+// author if already listed.
+func (loaded *LoadedConfig) mergeAuthor(author AuthorInfo, source authorSource) {
+	key := authorKey(author.Firstname, author.Lastname)
+	for i, existing := range loaded.Authors {
+		if authorKey(existing.Firstname, existing.Lastname) == key {
+			loaded.Authors[i] = author
+			loaded.authorSources[i] = source
+			return
+		}
+	}
+	loaded.Authors = append(loaded.Authors, author)
+	loaded.authorSources = append(loaded.authorSources, source)
+}
+
+// AuthorOrigin returns the origin of the i'th author, e.g., the included
+// file and line it's listed at.
+func (loaded *LoadedConfig) AuthorOrigin(i int) Origin {
+	if i < 0 || i >= len(loaded.authorSources) {
+		return loaded.Origins["authors"]
+	}
+	return loaded.authorSources[i].origin
+}
+
+// includeNodes returns the nodes naming the files to include; the value of
+// 'include' must be a file name or a list of them.
+func includeNodes(top *yaml.Node) ([]*yaml.Node, error) {
+	include := mappingValue(top, "include")
+	if include == nil {
+		return nil, nil
+	}
+
+	var nodes []*yaml.Node
+	switch include.Kind {
+	case yaml.ScalarNode:
+		nodes = []*yaml.Node{include}
+	case yaml.SequenceNode:
+		nodes = include.Content
+	}
+	for _, node := range nodes {
+		if node.Kind != yaml.ScalarNode || node.Value == "" {
+			nodes = nil
+			break
+		}
+	}
+	if nodes == nil {
+		return nil, fmt.Errorf("%d: include must be a file name or a list "+
+			"of file names", include.Line)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,129 @@
+// Unit tests related to configuration files that include other files. //
+package booklist
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sharedAuthors = `media-type: ebook
+authors:
+    - firstname: Sue
+      lastname: Grafton
+    - firstname: Stephen
+      lastname: King
+`
+
+func TestIncludeMergesAuthors(t *testing.T) {
+	t.Log("included authors are merged, and a repeated author replaced.")
+	home := setHome(t)
+	writeFile(t, filepath.Join(home, "shared", "authors.yml"), sharedAuthors)
+	configFileName := filepath.Join(home, "config.yml")
+	writeFile(t, configFileName, `include: shared/authors.yml
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Stephen
+      lastname: King
+      media-type: large print
+    - firstname: James
+      lastname: Patterson
+`)
+
+	loaded, err := LoadConfig(configFileName, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	var names []string
+	for _, author := range loaded.Authors {
+		names = append(names, author.Lastname+":"+author.Media)
+	}
+	expected := "Grafton::King:Large Print:Patterson:"
+	if got := strings.Join(names, ":"); got != expected {
+		t.Errorf("Expected authors %s; got %s.", expected, got)
+	}
+	if loaded.Media != "eBook" {
+		t.Errorf("Expected included media type eBook; got %s.", loaded.Media)
+	}
+	if got := loaded.Origins["media-type"].Name; got !=
+		filepath.Join(home, "shared", "authors.yml") {
+		t.Errorf("Expected media type to come from the included file; "+
+			"got %s.", got)
+	}
+	files := []string{configFileName, filepath.Join(home, "shared", "authors.yml")}
+	if strings.Join(loaded.Files, ",") != strings.Join(files, ",") {
+		t.Errorf("Expected files %v; got %v.", files, loaded.Files)
+	}
+}
+
+func TestIncludeRelativeToIncludingFile(t *testing.T) {
+	t.Log("nested includes are relative to the file including them.")
+	home := setHome(t)
+	writeFile(t, filepath.Join(home, "a", "config.yml"),
+		"include: ../b/url.yml\nauthors:\n    - firstname: Sue\n"+
+			"      lastname: Grafton\n")
+	writeFile(t, filepath.Join(home, "b", "url.yml"),
+		"include:\n    - c/media.yml\n"+
+			"catalog-url: https://catalog.library.loudoun.gov/\n")
+	writeFile(t, filepath.Join(home, "b", "c", "media.yml"),
+		"media-type: large print\n")
+
+	loaded, err := LoadConfig(filepath.Join(home, "a", "config.yml"), nil)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if loaded.URL != "https://catalog.library.loudoun.gov/" ||
+		loaded.Media != "Large Print" {
+		t.Errorf("Unexpected merged config: %v.", loaded.Config)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	t.Log("an include cycle is reported with the files in the cycle.")
+	home := setHome(t)
+	first := filepath.Join(home, "first.yml")
+	second := filepath.Join(home, "second.yml")
+	writeFile(t, first, "include: second.yml\n")
+	writeFile(t, second, "catalog-url: https://example.com/\ninclude: first.yml\n")
+
+	_, err := LoadConfig(first, nil)
+	expected := second + ":2: include cycle: " + first + " -> " + second +
+		" -> " + first
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error '%s'; got: %v.", expected, err)
+	}
+}
+
+func TestIncludeErrorsNameFile(t *testing.T) {
+	t.Log("errors in an included file name that file.")
+	home := setHome(t)
+	configFileName := filepath.Join(home, "config.yml")
+	included := filepath.Join(home, "authors.yml")
+	writeFile(t, configFileName, "include: [authors.yml]\n"+
+		"catalog-url: https://catalog.library.loudoun.gov/\n")
+
+	tests := []struct {
+		contents string
+		expected string
+	}{
+		{"authors:\n    - firstname: Sue\n      lastname: ''\n",
+			included + ":3"},
+		{"authors: [\n", included + ": "},
+		{"include: {a: b}\n", included + ":1: include must be"},
+	}
+	for _, test := range tests {
+		writeFile(t, included, test.contents)
+		_, err := LoadConfig(configFileName, nil)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected error containing '%s'; got: %v.",
+				test.expected, err)
+		}
+	}
+
+	writeFile(t, configFileName, "include: missing.yml\n")
+	_, err := LoadConfig(configFileName, nil)
+	if err == nil || !strings.HasPrefix(err.Error(),
+		configFileName+":1: unable to include file") {
+		t.Errorf("Expected error naming the including file; got: %v.", err)
+	}
+}
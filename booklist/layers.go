@@ -0,0 +1,250 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the layered configuration loader.  The value of each
+configuration key is taken from the last of the following layers that sets
+it:
+
+  - the defaults, i.e., a media-type of 'Book',
+  - the configuration file,
+  - environment variables, e.g., BOOKLIST_URL for catalog-url,
+  - overrides given on the command line.
+
+Only the keys in ConfigKeys can be set by environment variables and
+overrides; the version, include and notify keys can only be set in the
+configuration file.  A configuration file isn't required if the other
+layers set the required keys.  The layer each value came from is recorded as its Origin.  See
+include.go for the merging of files included by the configuration file.
+*/
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ConfigKeys lists the configuration keys in the order they're shown.
+var ConfigKeys = []string{"catalog-url", "media-type", "authors"}
+
+// ConfigEnvVars maps each configuration key to the environment variable
+// that overrides it.
+var ConfigEnvVars = map[string]string{
+	"catalog-url": "BOOKLIST_URL",
+	"media-type":  "BOOKLIST_MEDIA",
+	"authors":     "BOOKLIST_AUTHORS",
+}
+
+// Sources of configuration values.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Origin describes where a configuration value came from.  Name is the
+// file's path, the environment variable or the flag; Line is the line in
+// the file, if known.
+type Origin struct {
+	Source string
+	Name   string
+	Line   int
+}
+
+// Stringer function for Origin struct.
+func (o Origin) String() string {
+	switch o.Source {
+	case SourceFile:
+		if o.Line != 0 {
+			return fmt.Sprintf("%s:%d", o.Name, o.Line)
+		}
+		return o.Name
+	case SourceEnv:
+		return "$" + o.Name
+	case SourceFlag:
+		return "-" + o.Name
+	}
+	return o.Source
+}
+
+// Override sets a configuration key from a source other than the file.
+// The authors are given as for ParseAuthors.
+type Override struct {
+	Key    string
+	Value  string
+	Origin Origin
+}
+
+// LoadedConfig is a configuration merged from its layers.  Path is the
+// configuration file read, if any, and Files lists it and the files it
+// includes.  Origins maps each key that's set to the origin of its value.
+type LoadedConfig struct {
+	Config
+	Path    string
+	Files   []string
+	Origins map[string]Origin
+
+	// authorSources records where each of the authors came from, to
+	// locate errors.
+	authorSources []authorSource
+}
+
+// EnvOverrides returns the overrides set by the environment variables in
+// ConfigEnvVars, using getenv to look up each variable.
+func EnvOverrides(getenv func(string) string) []Override {
+	var overrides []Override
+	for _, key := range ConfigKeys {
+		name := ConfigEnvVars[key]
+		if value := getenv(name); value != "" {
+			overrides = append(overrides, Override{
+				Key:    key,
+				Value:  value,
+				Origin: Origin{Source: SourceEnv, Name: name},
+			})
+		}
+	}
+	return overrides
+}
+
+// ParseAuthors parses a list of authors separated by semicolons.  Each is
+// given as 'Lastname, Firstname', optionally followed by a colon and a
+// media type, e.g., 'Grafton, Sue: ebook; King, Stephen'.
+func ParseAuthors(s string) ([]AuthorInfo, error) {
+	var authors []AuthorInfo
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		var author AuthorInfo
+		name := entry
+		if i := strings.Index(entry, ":"); i != -1 {
+			name = entry[:i]
+			author.Media = strings.TrimSpace(entry[i+1:])
+		}
+		names := strings.SplitN(name, ",", 2)
+		if len(names) == 2 {
+			author.Lastname = strings.TrimSpace(names[0])
+			author.Firstname = strings.TrimSpace(names[1])
+		}
+		if author.Firstname == "" || author.Lastname == "" {
+			return nil, fmt.Errorf("author '%s' must be given as "+
+				"'Lastname, Firstname'", strings.TrimSpace(entry))
+		}
+		authors = append(authors, author)
+	}
+	return authors, nil
+}
+
+// LoadConfig merges the configuration layers, applying the overrides in
+// order, and validates the result.  If the configuration file name is
+// empty, the file is found with FindConfig; it's not an error if there is
+// none.  The file's format is detected from its name.
+func LoadConfig(configFileName string, overrides []Override) (*LoadedConfig, error) {
+	return LoadConfigFormat(configFileName, "", overrides)
+}
+
+// LoadConfigFormat is LoadConfig for a configuration file in the given
+// format, one of ConfigFormats.  If the format is empty, it's detected
+// from the file name.
+func LoadConfigFormat(configFileName, format string, overrides []Override) (*LoadedConfig, error) {
+	loaded := &LoadedConfig{
+		Config:  Config{Media: DefaultMediaType},
+		Origins: map[string]Origin{"media-type": {Source: SourceDefault}},
+	}
+
+	if configFileName == "" {
+		path, err := FindConfig()
+		if err != nil && !errors.Is(err, ErrNoConfig) {
+			return nil, err
+		}
+		configFileName = path
+	}
+	if configFileName != "" {
+		if err := loaded.readFile(configFileName, format); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, override := range overrides {
+		if err := loaded.apply(override); err != nil {
+			return nil, err
+		}
+	}
+
+	// Report missing keys with the ways they can be set rather than
+	// leaving it to the schema validation.
+	for _, key := range []string{"catalog-url", "authors"} {
+		if _, ok := loaded.Origins[key]; !ok {
+			return nil, fmt.Errorf("%s is not set; set it in the config "+
+				"file, with $%s or with -%s", key, ConfigEnvVars[key], key)
+		}
+	}
+
+	config, err := validateConfig(loaded.Config, nil, loaded.locate)
+	if err != nil {
+		return nil, err
+	}
+	loaded.Config = config
+	if err := loaded.checkRoutes(); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// apply sets a key from an override.
+func (loaded *LoadedConfig) apply(override Override) error {
+	switch override.Key {
+	case "catalog-url":
+		loaded.URL = override.Value
+	case "media-type":
+		loaded.Media = override.Value
+	case "authors":
+		authors, err := ParseAuthors(override.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", override.Origin, err)
+		}
+		loaded.Authors = authors
+		loaded.authorSources = nil
+		for range authors {
+			loaded.authorSources = append(loaded.authorSources,
+				authorSource{origin: override.Origin})
+		}
+	default:
+		return fmt.Errorf("%s: unknown config key '%s'", override.Origin,
+			override.Key)
+	}
+	loaded.Origins[override.Key] = override.Origin
+	return nil
+}
+
+// locate describes where the value in error came from:  the file and line
+// for a value from a file, or else the value's origin.
+func (loaded *LoadedConfig) locate(resultErr gojsonschema.ResultError) string {
+	parts := strings.SplitN(resultErr.Field(), ".", 3)
+
+	// Errors in an author are located within the author's entry.
+	if parts[0] == "Authors" && len(parts) > 1 {
+		index, err := strconv.Atoi(parts[1])
+		if err == nil && index < len(loaded.authorSources) {
+			source := loaded.authorSources[index]
+			if source.node != nil && len(parts) == 3 {
+				source.origin.Line = nodeAt(source.node, parts[2]).Line
+			}
+			return source.origin.String()
+		}
+	}
+
+	origin, ok := loaded.Origins[configKeys[parts[0]]]
+	if !ok {
+		if loaded.Path != "" {
+			return loaded.Path
+		}
+		return "config"
+	}
+	return origin.String()
+}
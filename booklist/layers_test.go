@@ -0,0 +1,120 @@
+// Unit tests related to the layered configuration loader. //
+package booklist
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const layersConfig = `catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname: Grafton
+      media-type: ebook
+`
+
+func TestLoadConfigLayers(t *testing.T) {
+	t.Log("each layer overrides the ones before it.")
+	home := setHome(t)
+	configFileName := filepath.Join(home, "config.yml")
+	writeFile(t, configFileName, layersConfig)
+
+	env := map[string]string{
+		"BOOKLIST_MEDIA":   "large print",
+		"BOOKLIST_AUTHORS": "King, Stephen",
+	}
+	overrides := append(EnvOverrides(func(name string) string {
+		return env[name]
+	}), Override{
+		Key:    "authors",
+		Value:  "Patterson, James: book on cd; McCall Smith, Alexander",
+		Origin: Origin{Source: SourceFlag, Name: "authors"},
+	})
+
+	loaded, err := LoadConfig(configFileName, overrides)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if loaded.Path != configFileName {
+		t.Errorf("Expected path %s; got %s.", configFileName, loaded.Path)
+	}
+	if loaded.URL != "https://catalog.library.loudoun.gov/" ||
+		loaded.Media != "Large Print" || len(loaded.Authors) != 2 ||
+		loaded.Authors[0].Media != "Book on CD" ||
+		loaded.Authors[1].Lastname != "McCall Smith" {
+		t.Errorf("Unexpected merged config: %v.", loaded.Config)
+	}
+
+	for key, expected := range map[string]string{
+		"catalog-url": configFileName + ":1",
+		"media-type":  "$BOOKLIST_MEDIA",
+		"authors":     "-authors",
+	} {
+		if got := loaded.Origins[key].String(); got != expected {
+			t.Errorf("Expected %s to come from %s; got %s.",
+				key, expected, got)
+		}
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	t.Log("a config file isn't needed if the required keys are set.")
+	setHome(t)
+
+	_, err := LoadConfig("", nil)
+	if err == nil || !strings.Contains(err.Error(), "catalog-url is not set") {
+		t.Errorf("Expected catalog-url to be reported missing; got %v.", err)
+	}
+
+	loaded, err := LoadConfig("", EnvOverrides(func(name string) string {
+		return map[string]string{
+			"BOOKLIST_URL":     "https://catalog.library.loudoun.gov",
+			"BOOKLIST_AUTHORS": "Grafton, Sue",
+		}[name]
+	}))
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if loaded.Path != "" || loaded.Media != DefaultMediaType ||
+		loaded.Origins["media-type"].Source != SourceDefault {
+		t.Errorf("Expected the default media type and no file; got %v.",
+			loaded)
+	}
+	if loaded.URL != "https://catalog.library.loudoun.gov/" {
+		t.Errorf("Expected a trailing slash to be added; got %s.", loaded.URL)
+	}
+}
+
+func TestLoadConfigErrorOrigin(t *testing.T) {
+	t.Log("validation errors name the origin of the value.")
+	home := setHome(t)
+	configFileName := filepath.Join(home, "config.yml")
+	writeFile(t, configFileName, layersConfig+"media-type: vinyl\n")
+
+	_, err := LoadConfig(configFileName, nil)
+	if err == nil || !strings.Contains(err.Error(), configFileName+":6") {
+		t.Errorf("Expected an error on line 6 of the file; got %v.", err)
+	}
+
+	_, err = LoadConfig(configFileName, []Override{{
+		Key:    "media-type",
+		Value:  "cassette",
+		Origin: Origin{Source: SourceEnv, Name: "BOOKLIST_MEDIA"},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "$BOOKLIST_MEDIA") {
+		t.Errorf("Expected an error from $BOOKLIST_MEDIA; got %v.", err)
+	}
+}
+
+func TestParseAuthors(t *testing.T) {
+	t.Log("authors are parsed from a semicolon separated list.")
+	authors, err := ParseAuthors("Grafton, Sue: ebook ; King, Stephen;")
+	if err != nil || len(authors) != 2 || authors[0].Media != "ebook" ||
+		authors[1].Firstname != "Stephen" {
+		t.Errorf("Unexpected authors: %v (%v).", authors, err)
+	}
+	if _, err := ParseAuthors("Sue Grafton"); err == nil {
+		t.Errorf("Expected an error for a name without a comma.")
+	}
+}
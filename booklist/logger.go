@@ -0,0 +1,201 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the logging of the searches.  Messages are logged to a
+Logger at one of five levels, from LevelError to LevelTrace, with fields
+describing them, e.g., the author searched for and the catalog endpoint
+requested.  WriterLogger writes them as lines of text or as JSON objects,
+one per line, for a log collector.  Logger has a single method so that a
+program using the package can adapt its own logging library to it; if no
+Logger is given, the messages are discarded.
+*/
+package booklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the importance of a logged message; the lower, the more
+// important.
+type Level int
+
+// The levels of the logged messages.  LevelDebug describes what the
+// searches do; LevelTrace adds the requests sent to the catalog.
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+// levelNames are the names of the levels, for ParseLevel and the logs.
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+// LevelNames returns the names of the levels, most important first.
+func LevelNames() []string {
+	return append([]string(nil), levelNames...)
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name, in any case; 'warning'
+// is accepted for 'warn'.
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(name)
+	if name == "warning" {
+		return LevelWarn, nil
+	}
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s'; the levels are %s", name,
+		strings.Join(levelNames, ", "))
+}
+
+// Fields are named values describing a logged message, e.g., "author"
+// for the author searched for.
+type Fields map[string]interface{}
+
+// Logger logs the messages of the searches.  The fields may be nil.
+type Logger interface {
+	Log(level Level, message string, fields Fields)
+}
+
+// NopLogger discards the messages; it's used where no Logger is given.
+var NopLogger Logger = nopLogger{}
+
+// nopLogger is the type of NopLogger.
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, Fields) {}
+
+// orNop returns the logger, or NopLogger if it's nil.
+func orNop(log Logger) Logger {
+	if log == nil {
+		return NopLogger
+	}
+	return log
+}
+
+// Formats of the logs written by WriterLogger.
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// LogFormats are the formats of the logs written by WriterLogger.
+var LogFormats = []string{LogText, LogJSON}
+
+// WriterLogger writes the messages at its level or more important to a
+// writer, in one of the LogFormats.  In text, a message is written as its
+// time, level and message followed by its fields, sorted by name, e.g.,
+//
+//     14:02:17 DEBUG Catalog request author="Grafton, Sue" endpoint=search
+//
+// In JSON, a message is an object with its 'time', 'level', 'message' and
+// fields, with durations in seconds.  It's safe for concurrent use.
+type WriterLogger struct {
+	Level Level
+
+	w      io.Writer
+	format string
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// NewWriterLogger returns a logger writing the messages at the level or
+// more important to w in the given format.
+func NewWriterLogger(w io.Writer, level Level, format string) (*WriterLogger, error) {
+	if !containsString(LogFormats, format) {
+		return nil, fmt.Errorf("unknown log format '%s'; the formats are %s",
+			format, strings.Join(LogFormats, ", "))
+	}
+	return &WriterLogger{Level: level, w: w, format: format, now: time.Now}, nil
+}
+
+// Log writes the message if its level is enabled.
+func (l *WriterLogger) Log(level Level, message string, fields Fields) {
+	if level > l.Level {
+		return
+	}
+	now := l.now()
+	var line []byte
+	if l.format == LogJSON {
+		line = jsonLogLine(now, level, message, fields)
+	} else {
+		line = textLogLine(now, level, message, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+// textLogLine formats a message as a line of text.
+func textLogLine(now time.Time, level Level, message string, fields Fields) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", now.Format("15:04:05"),
+		strings.ToUpper(level.String()), message)
+	for _, name := range fieldNames(fields) {
+		value := fmt.Sprint(fields[name])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", name, value)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// jsonLogLine formats a message as a JSON object on a line.
+func jsonLogLine(now time.Time, level Level, message string, fields Fields) []byte {
+	object := make(map[string]interface{}, len(fields)+3)
+	for name, value := range fields {
+		switch value := value.(type) {
+		case time.Duration:
+			object[name] = value.Seconds()
+		case error:
+			object[name] = value.Error()
+		default:
+			object[name] = value
+		}
+	}
+	object["time"] = now.Format(time.RFC3339Nano)
+	object["level"] = level.String()
+	object["message"] = message
+	line, err := json.Marshal(object)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{
+			"time":    now.Format(time.RFC3339Nano),
+			"level":   level.String(),
+			"message": fmt.Sprintf("%s (unable to log the fields:  %s)", message, err),
+		})
+	}
+	return append(line, '\n')
+}
+
+// fieldNames returns the names of the fields, sorted.
+func fieldNames(fields Fields) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,200 @@
+// Unit tests related to logging. //
+package booklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logEntry is a message logged to a recordingLogger.
+type logEntry struct {
+	level   Level
+	message string
+	fields  Fields
+}
+
+// recordingLogger records the messages logged to it.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Log(level Level, message string, fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, message, fields})
+}
+
+// testWriterLogger returns a logger writing to a buffer at a fixed time.
+func testWriterLogger(t *testing.T, level Level, format string) (*WriterLogger, *bytes.Buffer) {
+	t.Helper()
+	var b bytes.Buffer
+	log, err := NewWriterLogger(&b, level, format)
+	if err != nil {
+		t.Fatalf("Unable to create the logger: %s.", err)
+	}
+	log.now = func() time.Time {
+		return time.Date(2015, 6, 2, 14, 2, 17, 0, time.UTC)
+	}
+	return log, &b
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Log("levels are parsed by name, in any case.")
+	for name, expected := range map[string]Level{
+		"error":   LevelError,
+		"WARN":    LevelWarn,
+		"warning": LevelWarn,
+		"Info":    LevelInfo,
+		"debug":   LevelDebug,
+		"trace":   LevelTrace,
+	} {
+		level, err := ParseLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("Expected level %s for '%s'; got %s, %v.", expected,
+				name, level, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil ||
+		!strings.Contains(err.Error(), "error, warn, info, debug, trace") {
+		t.Errorf("Expected an error listing the levels; got %v.", err)
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	t.Log("messages are written as text with their fields, sorted.")
+	log, b := testWriterLogger(t, LevelDebug, LogText)
+	log.Log(LevelDebug, "Catalog response", Fields{
+		"endpoint": "search",
+		"author":   "Grafton, Sue",
+		"duration": 1500 * time.Millisecond,
+		"empty":    "",
+	})
+	log.Log(LevelWarn, "Retrying", nil)
+	expected := "14:02:17 DEBUG Catalog response author=\"Grafton, Sue\" " +
+		"duration=1.5s empty=\"\" endpoint=search\n" +
+		"14:02:17 WARN  Retrying\n"
+	if b.String() != expected {
+		t.Errorf("Expected log:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	t.Log("messages less important than the level aren't written.")
+	b.Reset()
+	log.Log(LevelTrace, "Catalog request", nil)
+	if b.Len() != 0 {
+		t.Errorf("Expected no trace messages; got %s.", b.String())
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	t.Log("messages are written as JSON objects, one per line.")
+	log, b := testWriterLogger(t, LevelInfo, LogJSON)
+	log.Log(LevelError, "Catalog request failed", Fields{
+		"author":   "Grafton, Sue",
+		"attempt":  2,
+		"duration": 250 * time.Millisecond,
+		"error":    errors.New("timeout"),
+	})
+	log.Log(LevelDebug, "Catalog response", nil)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line; got %d.", len(lines))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Log line isn't JSON: %s.", err)
+	}
+	for name, expected := range map[string]interface{}{
+		"time":     "2015-06-02T14:02:17Z",
+		"level":    "error",
+		"message":  "Catalog request failed",
+		"author":   "Grafton, Sue",
+		"attempt":  2.0,
+		"duration": 0.25,
+		"error":    "timeout",
+	} {
+		if entry[name] != expected {
+			t.Errorf("Expected %s to be %v; got %v.", name, expected,
+				entry[name])
+		}
+	}
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	t.Log("an unknown log format is an error.")
+	if _, err := NewWriterLogger(&bytes.Buffer{}, LevelWarn, "xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format.")
+	}
+}
+
+func TestSearchLogFields(t *testing.T) {
+	t.Log("the search's messages have the author, media, year and endpoint.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X", "format": "Book"}
+		]}`))
+	defer ts.Close()
+
+	log := new(recordingLogger)
+	c := testCatalog(ts.URL)
+	c.Log = log
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+
+	endpoints := make(map[string]bool)
+	for _, entry := range log.entries {
+		if entry.fields["author"] != "Grafton, Sue" ||
+			entry.fields["media"] != "Book" || entry.fields["year"] != "2015" {
+			t.Errorf("Expected the search's fields in '%s'; got %v.",
+				entry.message, entry.fields)
+		}
+		if entry.message == "Catalog response" {
+			endpoints[entry.fields["endpoint"].(string)] = true
+			if _, ok := entry.fields["duration"].(time.Duration); !ok {
+				t.Errorf("Expected the duration of the request; got %v.",
+					entry.fields)
+			}
+		}
+	}
+	if !endpoints["search/count"] || !endpoints["search"] {
+		t.Errorf("Expected the responses of both endpoints; got %v.",
+			endpoints)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	t.Log("a search without a logger logs nothing rather than panicking.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X", "format": "Book"}
+		]}`))
+	defer ts.Close()
+
+	c := CatalogInfo{
+		URL:    ts.URL + "/",
+		Author: "Grafton, Sue",
+		Media:  "Book",
+		Year:   "2015",
+	}
+	pubs, err := c.PublicationSearch()
+	if err != nil || len(pubs) != 1 {
+		t.Errorf("Expected 1 publication; got %v, %v.", pubs, err)
+	}
+
+	t.Log("a webhook without a logger retries without logging.")
+	server, requests := webhookServer(t, 500)
+	notifier, _ := newTestWebhook(t, WebhookConfig{Name: "hook",
+		URL: server.URL})
+	if err := notifier.Notify(NewDigest(currentRun, nil)); err != nil ||
+		len(*requests) != 2 {
+		t.Errorf("Expected success after 2 requests; got %d: %v.",
+			len(*requests), err)
+	}
+}
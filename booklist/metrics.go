@@ -0,0 +1,239 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the Prometheus metrics of the searches and of the
+catalog's health:  the requests to each of the catalog's endpoints, by
+HTTP status code, and their latencies; the retries of the notifiers; the
+titles found for each author; the resources missing expected fields (see
+DriftStats); and the time of the last successful run.  When booklist runs
+as a service, the metrics are served for Prometheus to scrape; when it's
+run by cron, they're written to a file for the node exporter's textfile
+collector.  A nil *Metrics ignores the observations, so the metrics are
+optional wherever they're used.
+*/
+package booklist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricsNamespace prefixes the names of the metrics.
+const metricsNamespace = "booklist"
+
+// lastSuccessMetric is the name of the metric holding the time of the last
+// successful run.
+const lastSuccessMetric = metricsNamespace + "_last_success_timestamp_seconds"
+
+// Metrics are the Prometheus metrics of the searches.  It's safe for
+// concurrent use.
+type Metrics struct {
+	// Registry holds the metrics, along with the Go runtime's and the
+	// process's.
+	Registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	retries         *prometheus.CounterVec
+	runs            *prometheus.CounterVec
+	titles          *prometheus.GaugeVec
+	driftResources  prometheus.Counter
+	driftMissing    *prometheus.CounterVec
+	driftRate       prometheus.Gauge
+	lastSuccess     prometheus.Gauge
+	lastRunDuration prometheus.Gauge
+
+	// lastSuccessKnown is set once a run succeeds.
+	mu               sync.Mutex
+	lastSuccessKnown bool
+}
+
+// NewMetrics returns the metrics, registered with a new registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "catalog_requests_total",
+			Help:      "Requests to the catalog, by endpoint and HTTP status code; the code is 'error' if there was no response.",
+		}, []string{"endpoint", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "catalog_request_duration_seconds",
+			Help:      "Latency of the requests to the catalog, by endpoint.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"endpoint"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifier_retries_total",
+			Help:      "Retries of the notifiers, by notifier.",
+		}, []string{"notifier"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runs_total",
+			Help:      "Runs of the searches, by result:  'success' or 'failure'.",
+		}, []string{"result"}),
+		titles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "author_titles",
+			Help:      "Titles found for each author by the last successful run.",
+		}, []string{"author", "media"}),
+		driftResources: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "drift_resources_total",
+			Help:      "Resources returned by the catalog and checked for the expected fields.",
+		}),
+		driftMissing: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "drift_missing_fields_total",
+			Help:      "Resources returned by the catalog missing an expected field, by field.",
+		}, []string{"field"}),
+		driftRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "drift_rate",
+			Help:      "Fraction of the resources missing an expected field in the last run.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Time of the last successful run, in seconds since the epoch.",
+		}),
+		lastRunDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_run_duration_seconds",
+			Help:      "Duration of the last run.",
+		}),
+	}
+	m.Registry.MustRegister(m.requests, m.requestDuration, m.retries,
+		m.runs, m.titles, m.driftResources, m.driftMissing, m.driftRate,
+		m.lastSuccess, m.lastRunDuration,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	for _, field := range ExpectedFields {
+		m.driftMissing.WithLabelValues(field)
+	}
+	return m
+}
+
+// ObserveRequest records a request to an endpoint of the catalog, with
+// the HTTP status code of its response, or zero if there was none, and
+// how long it took.
+func (m *Metrics) ObserveRequest(endpoint string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	m.requests.WithLabelValues(endpoint, code).Inc()
+	m.requestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
+
+// ObserveRetry records a retry of the named notifier.
+func (m *Metrics) ObserveRetry(notifier string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(notifier).Inc()
+}
+
+// ObserveRun records a run that started at the given time, with its
+// results, the resources missing expected fields, and its error, if it
+// failed.  The titles found are only replaced by a successful run.
+func (m *Metrics) ObserveRun(start time.Time, run *RunResults, drift *DriftStats, err error) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	m.lastRunDuration.Set(now.Sub(start).Seconds())
+	if drift != nil {
+		m.driftResources.Add(float64(drift.Resources()))
+		for _, field := range ExpectedFields {
+			m.driftMissing.WithLabelValues(field).Add(
+				float64(drift.Missing(field)))
+		}
+		m.driftRate.Set(drift.Rate())
+	}
+	if err != nil || run == nil {
+		m.runs.WithLabelValues("failure").Inc()
+		return
+	}
+
+	m.runs.WithLabelValues("success").Inc()
+	m.lastSuccess.Set(float64(now.Unix()))
+	m.mu.Lock()
+	m.lastSuccessKnown = true
+	m.mu.Unlock()
+	m.titles.Reset()
+	for _, result := range run.Results {
+		m.titles.WithLabelValues(result.Author, result.Media).Set(
+			float64(len(result.Publications)))
+	}
+}
+
+// Handler returns the handler serving the metrics to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// WriteTextfile writes the metrics to the named file in the format read by
+// the node exporter's textfile collector, replacing the file in one step
+// so that the collector never reads it half written.  The Go runtime's and
+// the process's metrics are left out, as they're of a process that's gone
+// by the time they're collected.
+//
+// If there's been no successful run, the time of the last successful run
+// is kept from the file, so that it's still known after a failed run.
+func (m *Metrics) WriteTextfile(fileName string) error {
+	m.mu.Lock()
+	known := m.lastSuccessKnown
+	m.mu.Unlock()
+	if !known {
+		if last, ok := textfileValue(fileName, lastSuccessMetric); ok {
+			m.lastSuccess.Set(last)
+		}
+	}
+
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return err
+	}
+	var contents bytes.Buffer
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), metricsNamespace+"_") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(&contents, family); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(fileName, contents.Bytes(), 0644)
+}
+
+// textfileValue returns the value of the named metric, without labels, in
+// a file written by WriteTextfile, and false if the file or metric doesn't
+// exist or the value is zero.
+func textfileValue(fileName, name string) (float64, bool) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(line[len(name):]), 64)
+		return value, err == nil && value != 0
+	}
+	return 0, false
+}
@@ -0,0 +1,185 @@
+// Unit tests related to the Prometheus metrics. //
+package booklist
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsRequests(t *testing.T) {
+	t.Log("the requests to the catalog are counted by endpoint and status.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [
+		    {"shortAuthor": "Grafton, Sue", "shortTitle": "X", "format": "Book"}
+		]}`))
+	defer ts.Close()
+
+	metrics := NewMetrics()
+	c := testCatalog(ts.URL)
+	c.Metrics = metrics
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+	for _, endpoint := range []string{"search/count", "search"} {
+		got := testutil.ToFloat64(
+			metrics.requests.WithLabelValues(endpoint, "200"))
+		if got != 1 {
+			t.Errorf("Expected 1 request to %s; got %v.", endpoint, got)
+		}
+	}
+	if count := testutil.CollectAndCount(metrics.requestDuration); count != 2 {
+		t.Errorf("Expected the latencies of 2 endpoints; got %d.", count)
+	}
+
+	t.Log("a failed request is counted with its status, or as an error.")
+	ts.Close()
+	ts = newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}, replyWith(`{"resources": []}`))
+	c.URL = ts.URL + "/"
+	if _, err := c.PublicationSearch(); err == nil {
+		t.Errorf("Expected the search to fail.")
+	}
+	ts.Close()
+	if _, err := c.PublicationSearch(); err == nil {
+		t.Errorf("Expected the search to fail.")
+	}
+	for code, expected := range map[string]float64{"503": 1, "error": 1} {
+		got := testutil.ToFloat64(
+			metrics.requests.WithLabelValues("search/count", code))
+		if got != expected {
+			t.Errorf("Expected %v requests with code %s; got %v.",
+				expected, code, got)
+		}
+	}
+}
+
+func TestMetricsRun(t *testing.T) {
+	t.Log("a successful run sets the titles for each author and the time.")
+	metrics := NewMetrics()
+	drift := new(DriftStats)
+	drift.add(nil)
+	drift.add([]string{"format"})
+	metrics.ObserveRun(time.Now(), currentRun, drift, nil)
+
+	if got := testutil.ToFloat64(
+		metrics.titles.WithLabelValues("Grafton, Sue", "Book")); got != 2 {
+		t.Errorf("Expected 2 titles for Grafton; got %v.", got)
+	}
+	if got := testutil.ToFloat64(
+		metrics.titles.WithLabelValues("King, Stephen", "Book")); got != 0 {
+		t.Errorf("Expected no titles for King; got %v.", got)
+	}
+	if got := testutil.ToFloat64(metrics.lastSuccess); got < float64(time.Now().Unix()-60) {
+		t.Errorf("Expected the time of the last success; got %v.", got)
+	}
+	if got := testutil.ToFloat64(metrics.driftMissing.WithLabelValues("format")); got != 1 {
+		t.Errorf("Expected 1 resource missing format; got %v.", got)
+	}
+	if got := testutil.ToFloat64(metrics.driftRate); got != 0.5 {
+		t.Errorf("Expected drift rate of 0.5; got %v.", got)
+	}
+
+	t.Log("a failed run is counted but keeps the last titles and time.")
+	last := testutil.ToFloat64(metrics.lastSuccess)
+	metrics.ObserveRun(time.Now(), nil, new(DriftStats), errors.New("failed"))
+	if got := testutil.ToFloat64(metrics.runs.WithLabelValues("failure")); got != 1 {
+		t.Errorf("Expected 1 failed run; got %v.", got)
+	}
+	if got := testutil.ToFloat64(metrics.runs.WithLabelValues("success")); got != 1 {
+		t.Errorf("Expected 1 successful run; got %v.", got)
+	}
+	if testutil.ToFloat64(metrics.lastSuccess) != last ||
+		testutil.CollectAndCount(metrics.titles) != 3 {
+		t.Errorf("Expected the failed run not to change the last success.")
+	}
+}
+
+func TestMetricsRetries(t *testing.T) {
+	t.Log("the retries of a webhook are counted.")
+	server, _ := webhookServer(t, 500, 502)
+	notifier, _ := newTestWebhook(t, WebhookConfig{Name: "hook",
+		URL: server.URL})
+	notifier.Metrics = NewMetrics()
+	if err := notifier.Notify(NewDigest(currentRun, nil)); err != nil {
+		t.Fatalf("Notify failed: %s.", err)
+	}
+	if got := testutil.ToFloat64(
+		notifier.Metrics.retries.WithLabelValues("hook")); got != 2 {
+		t.Errorf("Expected 2 retries; got %v.", got)
+	}
+}
+
+func TestMetricsTextfile(t *testing.T) {
+	t.Log("the textfile has booklist's metrics only.")
+	fileName := filepath.Join(t.TempDir(), "booklist.prom")
+	metrics := NewMetrics()
+	metrics.ObserveRequest("search", http.StatusOK, time.Second)
+	metrics.ObserveRun(time.Now(), currentRun, nil, nil)
+	if err := metrics.WriteTextfile(fileName); err != nil {
+		t.Fatalf("Unable to write the textfile: %s.", err)
+	}
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read the textfile: %s.", err)
+	}
+	for _, expected := range []string{
+		`booklist_catalog_requests_total{code="200",endpoint="search"} 1`,
+		`booklist_author_titles{author="Patterson, James",media="Book"} 1`,
+		`booklist_runs_total{result="success"} 1`,
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected the textfile to contain '%s'.", expected)
+		}
+	}
+	if strings.Contains(string(contents), "go_goroutines") {
+		t.Errorf("Expected the textfile without the Go runtime's metrics.")
+	}
+	last, ok := textfileValue(fileName, lastSuccessMetric)
+	if !ok || last != testutil.ToFloat64(metrics.lastSuccess) {
+		t.Errorf("Expected the time of the last success in the textfile; "+
+			"got %v.", last)
+	}
+
+	t.Log("a failed run keeps the time of the last success from the file.")
+	failed := NewMetrics()
+	failed.ObserveRun(time.Now(), nil, nil, errors.New("failed"))
+	if err := failed.WriteTextfile(fileName); err != nil {
+		t.Fatalf("Unable to write the textfile: %s.", err)
+	}
+	if got, _ := textfileValue(fileName, lastSuccessMetric); got != last {
+		t.Errorf("Expected the last success %v to be kept; got %v.",
+			last, got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Log("the metrics are served by the server at /metrics.")
+	s := newTestServer()
+	s.Metrics = NewMetrics()
+	s.Metrics.ObserveRun(time.Now(), currentRun, nil, nil)
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK ||
+		!strings.Contains(body, "booklist_last_success_timestamp_seconds") ||
+		!strings.Contains(body, "go_goroutines") {
+		t.Errorf("Expected the metrics; got %d: %s.", recorder.Code, body)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	t.Log("nil metrics ignore the observations.")
+	var metrics *Metrics
+	metrics.ObserveRequest("search", http.StatusOK, time.Second)
+	metrics.ObserveRetry("hook")
+	metrics.ObserveRun(time.Now(), currentRun, nil, nil)
+}
@@ -0,0 +1,108 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the functions to upgrade a configuration file to the
+current version of its schema.  Each version of the schema has a migration
+that upgrades a file from that version to the next; a file is upgraded by
+applying the migrations in turn, from its version to ConfigVersion.
+
+Version 1 is the original file, which had no version key.  Version 2 adds
+the version key so that files written for later schemas, e.g., with
+multiple catalogs, can be recognized and upgraded.
+
+As for the editing of the list of authors, the file is upgraded as a tree
+of YAML nodes so that the comments are preserved.  Only YAML files can be
+upgraded.
+*/
+package booklist
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is the current version of the configuration file schema.
+const ConfigVersion = 2
+
+// versionComment is the comment added above the version key by the
+// migration to version 2.
+const versionComment = "The version of this file's format; upgrade the " +
+	"file with\n'booklist config migrate' when a new version is released."
+
+// migrations maps each version of the configuration file to the function
+// that upgrades the file's top level mapping to the next version.  The
+// version key is updated afterwards.
+var migrations = map[int]func(top *yaml.Node) error{
+	1: migrateVersion1,
+}
+
+// SchemaVersion returns the version of the configuration file's schema.
+func (c Config) SchemaVersion() int {
+	if c.Version == 0 {
+		return 1
+	}
+	return c.Version
+}
+
+// checkVersion returns an error if the configuration's version isn't
+// supported.
+func checkVersion(config Config) error {
+	if _, ok := schemas[config.SchemaVersion()]; !ok {
+		return fmt.Errorf("unsupported config version %d; this booklist "+
+			"supports versions 1 to %d", config.Version, ConfigVersion)
+	}
+	return nil
+}
+
+// MigrateConfig upgrades the YAML file contents to ConfigVersion and
+// returns the upgraded contents along with the version upgraded from.  The
+// contents are returned unchanged if they're already at ConfigVersion.
+func MigrateConfig(in []byte) ([]byte, int, error) {
+	config, _, err := parseConfig(in, ConfigYAML)
+	if err != nil {
+		return nil, 0, err
+	}
+	from := config.SchemaVersion()
+	if err := checkVersion(config); err != nil {
+		return nil, from, err
+	}
+	if from == ConfigVersion {
+		return in, from, nil
+	}
+
+	ed, err := NewConfigEditor(in)
+	if err != nil {
+		return nil, from, err
+	}
+	top := documentNode(ed.root)
+	for version := from; version < ConfigVersion; version++ {
+		if err := migrations[version](top); err != nil {
+			return nil, from, fmt.Errorf("unable to upgrade config from "+
+				"version %d to %d:  %s", version, version+1, err)
+		}
+		setMappingValue(top, "version", strconv.Itoa(version+1))
+		mappingValue(top, "version").Tag = "!!int"
+	}
+
+	out, err := ed.Bytes()
+	if err != nil {
+		return nil, from, err
+	}
+	return out, from, nil
+}
+
+// migrateVersion1 adds the version key, which is then set by
+// MigrateConfig, as the first key in the file.
+func migrateVersion1(top *yaml.Node) error {
+	key := &yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Tag:         "!!str",
+		Value:       "version",
+		HeadComment: versionComment,
+	}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: "1"}
+	top.Content = append([]*yaml.Node{key, value}, top.Content...)
+	return nil
+}
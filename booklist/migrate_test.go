@@ -0,0 +1,83 @@
+// Unit tests related to upgrading the configuration file. //
+package booklist
+
+import (
+	"strings"
+	"testing"
+)
+
+const version1Config = `# Authors to look for.
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    # Read everything by her.
+    - firstname: Sue
+      lastname: Grafton
+`
+
+func TestMigrateConfig(t *testing.T) {
+	t.Log("a version 1 file is upgraded and its comments are kept.")
+	out, from, err := MigrateConfig([]byte(version1Config))
+	if err != nil {
+		t.Fatalf("Migration failed: %s.", err)
+	}
+	if from != 1 {
+		t.Errorf("Expected to migrate from version 1; got %d.", from)
+	}
+	for _, expected := range []string{"\nversion: 2\n",
+		"# Authors to look for.", "# Read everything by her."} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("Expected migrated file to contain '%s'; got:\n%s",
+				expected, out)
+		}
+	}
+
+	config, err := ValidateConfig(out)
+	if err != nil {
+		t.Fatalf("Migrated file is invalid: %s.", err)
+	}
+	if config.Version != ConfigVersion {
+		t.Errorf("Expected version %d; got %d.", ConfigVersion,
+			config.Version)
+	}
+
+	again, from, err := MigrateConfig(out)
+	if err != nil || from != ConfigVersion || string(again) != string(out) {
+		t.Errorf("Expected current file to be unchanged; got version %d, "+
+			"%v.", from, err)
+	}
+}
+
+func TestConfigVersions(t *testing.T) {
+	t.Log("each version is validated against its own schema.")
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"", ""},
+		{"version: 1\n", ""},
+		{"version: 2\n", ""},
+		{"version: 3\n", "unsupported config version 3"},
+		{"version: -1\n", "unsupported config version -1"},
+		{"version: two\n", "unable to parse YAML config file"},
+	}
+	for _, test := range tests {
+		_, err := ValidateConfig([]byte(test.version + version1Config))
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("Expected '%s' to be valid; got: %s.", test.version, err)
+		case test.expected != "" && (err == nil ||
+			!strings.Contains(err.Error(), test.expected)):
+			t.Errorf("Expected error containing '%s'; got: %v.",
+				test.expected, err)
+		}
+	}
+
+	problems := CheckConfig([]byte("version: 3\n" + version1Config))
+	if len(problems) != 1 || problems[0].Line != 1 {
+		t.Errorf("Expected unsupported version on line 1; got %v.", problems)
+	}
+	if _, _, err := MigrateConfig([]byte("version: 3\n" +
+		version1Config)); err == nil {
+		t.Errorf("Expected error migrating an unsupported version.")
+	}
+}
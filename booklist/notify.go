@@ -0,0 +1,185 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the notifiers, which send the results of a run somewhere
+other than the terminal, e.g., by email.  They're configured by the
+'notify' key of the configuration file:
+
+    notify:
+        email:
+            server: smtp.example.com
+            port: 587
+            starttls: true
+            username: me@example.com
+            password-env: BOOKLIST_SMTP_PASSWORD
+            from: booklist@example.com
+            to: [me@example.com]
+            only-new: true
+        webhooks:
+            - name: family-chat
+              url: https://hooks.slack.com/services/T000/B000/XXXX
+              format: slack
+              only-new: true
+
+Each notifier is sent a Digest of the run, holding all of the results as
+well as the titles that are new since the previous run.  An author can be
+routed to some of the notifiers by naming them in the author's 'notify'
+key, e.g., 'notify: [family-chat]'; the author's results are then left out
+of the digests sent to the others.  The email notifier is named 'email' and
+each webhook is named by its 'name' key.
+*/
+package booklist
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EmailNotifierName is the name of the email notifier, used to route
+// authors to it.
+const EmailNotifierName = "email"
+
+// NotifyConfig configures the notifiers; a notifier that isn't configured
+// isn't used.
+type NotifyConfig struct {
+	Email    *EmailConfig    `yaml:"email,omitempty"`
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
+}
+
+// Names returns the names of the configured notifiers.
+func (c *NotifyConfig) Names() []string {
+	var names []string
+	if c == nil {
+		return names
+	}
+	if c.Email != nil {
+		names = append(names, EmailNotifierName)
+	}
+	for _, webhook := range c.Webhooks {
+		names = append(names, webhook.Name)
+	}
+	return names
+}
+
+// Digest is the results of a run sent by the notifiers.  New holds only
+// the titles that weren't found by the previous run.
+type Digest struct {
+	Time    time.Time
+	Results []SearchResult
+	New     []SearchResult
+}
+
+// Notifier sends the digest of a run.  Payload returns what Notify would
+// send, without sending it, or nil if nothing would be sent.
+type Notifier interface {
+	Name() string
+	Notify(digest Digest) error
+	Payload(digest Digest) ([]byte, error)
+}
+
+// NewDigest returns the digest of a run, given the results of the previous
+// run, if any.
+func NewDigest(run, previous *RunResults) Digest {
+	return Digest{
+		Time:    run.Time,
+		Results: run.Results,
+		New:     run.NewSince(previous),
+	}
+}
+
+// Route returns the digest sent to the named notifier:  the results of the
+// authors that aren't routed to particular notifiers, plus those routed to
+// this one.
+func (d Digest) Route(name string) Digest {
+	routed := func(results []SearchResult) []SearchResult {
+		var kept []SearchResult
+		for _, result := range results {
+			if len(result.Notify) == 0 ||
+				containsString(result.Notify, name) {
+				kept = append(kept, result)
+			}
+		}
+		return kept
+	}
+	return Digest{Time: d.Time, Results: routed(d.Results), New: routed(d.New)}
+}
+
+// Shown returns the results a notifier shows:  all of them, or with
+// onlyNew, only the new titles.
+func (d Digest) Shown(onlyNew bool) []SearchResult {
+	if onlyNew {
+		return d.New
+	}
+	return d.Results
+}
+
+// NewNotifiers returns the notifiers configured by the notify key, in the
+// order they're described in the configuration file's documentation.
+func NewNotifiers(config *NotifyConfig) ([]Notifier, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	var notifiers []Notifier
+	if config.Email != nil {
+		email, err := NewEmailNotifier(*config.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, email)
+	}
+	for _, webhookConfig := range config.Webhooks {
+		webhook, err := NewWebhookNotifier(webhookConfig)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	return notifiers, nil
+}
+
+// unknownNotifier returns the first of the names that isn't a configured
+// notifier, or an empty string if they all are.
+func unknownNotifier(config *NotifyConfig, names []string) string {
+	configured := config.Names()
+	for _, name := range names {
+		if !containsString(configured, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkRoutes checks that the authors are routed only to configured
+// notifiers.
+func (loaded *LoadedConfig) checkRoutes() error {
+	for i, author := range loaded.Authors {
+		if name := unknownNotifier(loaded.Notify, author.Notify); name != "" {
+			return fmt.Errorf("%s: author '%s %s' is routed to notifier "+
+				"'%s', which isn't configured; the notifiers are %s",
+				loaded.AuthorOrigin(i), author.Firstname, author.Lastname,
+				name, notifierList(loaded.Notify))
+		}
+	}
+	return nil
+}
+
+// notifierList returns the names of the configured notifiers for an error
+// message.
+func notifierList(config *NotifyConfig) string {
+	names := config.Names()
+	if len(names) == 0 {
+		return "none; configure them with the notify key"
+	}
+	return strings.Join(names, ", ")
+}
+
+// countPublications returns the number of publications in the results.
+func countPublications(results []SearchResult) int {
+	count := 0
+	for _, result := range results {
+		count += len(result.Publications)
+	}
+	return count
+}
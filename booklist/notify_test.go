@@ -0,0 +1,73 @@
+// Unit tests related to the notifiers and routing authors to them. //
+package booklist
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDigestRoute(t *testing.T) {
+	t.Log("authors routed to notifiers are left out of the others' digests.")
+	run := &RunResults{Results: []SearchResult{
+		{Author: "Grafton, Sue", Notify: []string{"family-chat"}},
+		{Author: "King, Stephen"},
+		{Author: "Patterson, James", Notify: []string{"email", "team"}},
+	}}
+	digest := NewDigest(run, nil)
+	for _, test := range []struct {
+		name     string
+		expected []string
+	}{
+		{"family-chat", []string{"Grafton, Sue", "King, Stephen"}},
+		{"email", []string{"King, Stephen", "Patterson, James"}},
+		{"other", []string{"King, Stephen"}},
+	} {
+		var authors []string
+		for _, result := range digest.Route(test.name).Results {
+			authors = append(authors, result.Author)
+		}
+		if strings.Join(authors, "; ") != strings.Join(test.expected, "; ") {
+			t.Errorf("Expected %s to get %v; got %v.", test.name,
+				test.expected, authors)
+		}
+	}
+}
+
+const routedConfig = `version: 2
+catalog-url: https://catalog.library.loudoun.gov/
+authors:
+    - firstname: Sue
+      lastname: Grafton
+      notify: [family-chat]
+    - firstname: James
+      lastname: Patterson
+      notify: [famly-chat]
+notify:
+    webhooks:
+        - name: family-chat
+          url: https://hooks.slack.com/services/T000/B000/XXXX
+          format: slack
+        - name: family-chat
+          url: https://example.com/hook
+`
+
+func TestCheckRoutes(t *testing.T) {
+	t.Log("unknown notifier names and duplicate webhook names are reported.")
+	problems := CheckConfig([]byte(routedConfig))
+	if len(problems) != 2 || problems[0].Line != 9 ||
+		!strings.Contains(problems[0].Message, "'famly-chat' isn't configured") ||
+		problems[1].Line != 15 {
+		t.Errorf("Expected errors on lines 9 and 15; got %v.", problems)
+	}
+
+	home := setHome(t)
+	configFileName := filepath.Join(home, "config.yml")
+	writeFile(t, configFileName, routedConfig)
+	_, err := LoadConfig(configFileName, nil)
+	expected := configFileName + ":7: author 'James Patterson' is routed to " +
+		"notifier 'famly-chat'"
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("Expected error '%s'; got: %v.", expected, err)
+	}
+}
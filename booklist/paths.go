@@ -0,0 +1,111 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains functions for finding the configuration file and the
+directories for booklist's state and cache files.  The default locations
+follow the XDG Base Directory Specification.
+
+If no configuration file is named, the first of the following that is set
+or exists is used:
+
+  - the file named by the BOOKLIST_CONFIG environment variable,
+  - $XDG_CONFIG_HOME/booklist/config.yml, where XDG_CONFIG_HOME defaults
+    to ~/.config,
+  - ~/.booklist.yml.
+
+State files, such as the results of previous searches, are kept in
+$XDG_STATE_HOME/booklist, where XDG_STATE_HOME defaults to ~/.local/state.
+Cache files, which can be deleted at any time, are kept in
+$XDG_CACHE_HOME/booklist, where XDG_CACHE_HOME defaults to ~/.cache.
+*/
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ConfigEnv is the environment variable naming the configuration
+	// file to use if none is given.
+	ConfigEnv = "BOOKLIST_CONFIG"
+
+	// appName is the name of booklist's directory within the XDG base
+	// directories.
+	appName = "booklist"
+)
+
+// ErrNoConfig is returned when no configuration file is named and none is
+// found in the default locations.
+var ErrNoConfig = errors.New("no config file found")
+
+// ConfigPaths returns the locations searched for the configuration file if
+// none is named, in order.
+func ConfigPaths() []string {
+	var paths []string
+	if path := os.Getenv(ConfigEnv); path != "" {
+		paths = append(paths, path)
+	}
+	if dir, err := xdgDir("XDG_CONFIG_HOME", ".config"); err == nil {
+		paths = append(paths, filepath.Join(dir, appName, "config.yml"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".booklist.yml"))
+	}
+	return paths
+}
+
+// FindConfig returns the path of the configuration file to use if none is
+// named.  If BOOKLIST_CONFIG is set, the file it names is used whether or
+// not it exists; otherwise, the first of ConfigPaths that exists is used.
+func FindConfig() (string, error) {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path, nil
+	}
+
+	paths := ConfigPaths()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w; looked for %s", ErrNoConfig,
+		strings.Join(paths, ", "))
+}
+
+// StateDir returns the directory for booklist's state files.  The
+// directory isn't created.
+func StateDir() (string, error) {
+	dir, err := xdgDir("XDG_STATE_HOME", ".local", "state")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// CacheDir returns the directory for booklist's cache files.  The
+// directory isn't created.
+func CacheDir() (string, error) {
+	dir, err := xdgDir("XDG_CACHE_HOME", ".cache")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// xdgDir returns the base directory named by the XDG environment variable
+// or, if it isn't set to an absolute path, its default, the directory with
+// the given path within the home directory.
+func xdgDir(variable string, homePath ...string) (string, error) {
+	if dir := os.Getenv(variable); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{home}, homePath...)...), nil
+}
@@ -0,0 +1,115 @@
+// Unit tests related to the default file locations. //
+package booklist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setHome points the home and XDG directories at a temporary directory
+// for the duration of the test.
+func setHome(t *testing.T) string {
+	home, err := ioutil.TempDir("", "booklist_home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+
+	t.Setenv("HOME", home)
+	t.Setenv(ConfigEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	return home
+}
+
+// writeFile creates the file, and its directory, with the contents.
+func writeFile(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	t.Log("the config file is found in the default locations, in order.")
+	home := setHome(t)
+
+	_, err := FindConfig()
+	if !errors.Is(err, ErrNoConfig) {
+		t.Errorf("Expected ErrNoConfig; got %v.", err)
+	}
+
+	dotFile := filepath.Join(home, ".booklist.yml")
+	writeFile(t, dotFile, "dot")
+	if path, err := FindConfig(); err != nil || path != dotFile {
+		t.Errorf("Expected %s; got %s (%v).", dotFile, path, err)
+	}
+
+	defaultFile := filepath.Join(home, ".config", "booklist", "config.yml")
+	writeFile(t, defaultFile, "default")
+	if path, err := FindConfig(); err != nil || path != defaultFile {
+		t.Errorf("Expected %s; got %s (%v).", defaultFile, path, err)
+	}
+
+	xdgFile := filepath.Join(home, "xdg", "booklist", "config.yml")
+	writeFile(t, xdgFile, "xdg")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	if path, err := FindConfig(); err != nil || path != xdgFile {
+		t.Errorf("Expected %s; got %s (%v).", xdgFile, path, err)
+	}
+
+	envFile := filepath.Join(home, "env.yml")
+	t.Setenv(ConfigEnv, envFile)
+	if path, err := FindConfig(); err != nil || path != envFile {
+		t.Errorf("Expected %s even though it doesn't exist; got %s (%v).",
+			envFile, path, err)
+	}
+}
+
+func TestReadConfigPath(t *testing.T) {
+	t.Log("ReadConfig reports the path of the file it read.")
+	home := setHome(t)
+	dotFile := filepath.Join(home, ".booklist.yml")
+	writeFile(t, dotFile, "dot")
+
+	contents, path, err := ReadConfig("")
+	if err != nil || path != dotFile || string(contents) != "dot" {
+		t.Errorf("Expected to read %s; got %s, '%s' (%v).",
+			dotFile, path, contents, err)
+	}
+
+	_, path, err = ReadConfig("config.go")
+	if err != nil || !filepath.IsAbs(path) ||
+		filepath.Base(path) != "config.go" {
+		t.Errorf("Expected the absolute path of config.go; got %s (%v).",
+			path, err)
+	}
+}
+
+func TestStateAndCacheDirs(t *testing.T) {
+	t.Log("state and cache directories follow the XDG variables.")
+	home := setHome(t)
+
+	for _, tc := range []struct {
+		dirFunc  func() (string, error)
+		variable string
+		fallback string
+	}{
+		{StateDir, "XDG_STATE_HOME", filepath.Join(home, ".local", "state")},
+		{CacheDir, "XDG_CACHE_HOME", filepath.Join(home, ".cache")},
+	} {
+		if dir, _ := tc.dirFunc(); dir != filepath.Join(tc.fallback, "booklist") {
+			t.Errorf("Expected the %s default; got %s.", tc.variable, dir)
+		}
+		t.Setenv(tc.variable, "/xdg")
+		if dir, _ := tc.dirFunc(); dir != "/xdg/booklist" {
+			t.Errorf("Expected %s to be used; got %s.", tc.variable, dir)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains an HTTP transport that records the exchanges with a
+CARL.X catalog to a fixture file and another that replays them, so a
+search can be repeated without a connection to the library's website.
+
+A fixture file is a JSON document containing the list of interactions in
+the order they occurred.  For example:
+
+	{
+	  "interactions": [
+	    {
+	      "request": {
+	        "method": "POST",
+	        "url": "https://catalog.library.loudoun.gov/search/count",
+	        "body": {"searchTerm": "Grafton, Sue", ...}
+	      },
+	      "response": {
+	        "status": 200,
+	        "body": {"success": true, "totalHits": 8}
+	      }
+	    }
+	  ]
+	}
+
+The 'cache buster' parameter is removed from recorded URLs as it differs
+on every request.  Bodies that aren't JSON are recorded as text.
+*/
+package booklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// ErrNoRecording indicates a replayed request has no matching interaction
+// remaining in the fixture.
+var ErrNoRecording = errors.New("no recorded response for request")
+
+// Fixture is the content of a fixture file.
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request and the response it received.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the recorded form of an HTTP request.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Text   string          `json:"text,omitempty"`
+}
+
+// RecordedResponse is the recorded form of an HTTP response.
+type RecordedResponse struct {
+	StatusCode int             `json:"status"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+// LoadFixture reads a fixture file.
+func LoadFixture(fileName string) (*Fixture, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := new(Fixture)
+	if err := json.Unmarshal(content, fixture); err != nil {
+		return nil, fmt.Errorf("unable to parse fixture file %s: %s",
+			fileName, err)
+	}
+	return fixture, nil
+}
+
+// Save writes the fixture to the given file.
+func (f *Fixture) Save(fileName string) error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(content, '\n'), 0644)
+}
+
+// Recorder is an http.RoundTripper that records each exchange it passes
+// on to the underlying transport.
+type Recorder struct {
+	// Transport issues the requests; http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mu      sync.Mutex
+	fixture Fixture
+}
+
+// NewRecorder returns a Recorder that issues requests using the given
+// transport.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport}
+}
+
+// RoundTrip issues the request and records it along with its response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var interaction Interaction
+	interaction.Request = RecordedRequest{
+		Method: req.Method,
+		URL:    recordedURL(req.URL),
+		Header: req.Header.Clone(),
+	}
+	interaction.Request.Body, interaction.Request.Text = splitBody(reqBody)
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	interaction.Response = RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     header,
+	}
+	interaction.Response.Body, interaction.Response.Text = splitBody(respBody)
+
+	r.mu.Lock()
+	r.fixture.Interactions = append(r.fixture.Interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// Save writes the exchanges recorded so far to the given file.
+func (r *Recorder) Save(fileName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fixture.Save(fileName)
+}
+
+// Replayer is an http.RoundTripper that answers requests using the
+// interactions in a fixture rather than a network connection.
+//
+// A request is matched on its method, URL (ignoring the 'cache buster')
+// and JSON body.  Identical requests are answered in the order they were
+// recorded.
+type Replayer struct {
+	mu      sync.Mutex
+	used    []bool
+	fixture *Fixture
+}
+
+// NewReplayer returns a Replayer for the given fixture.
+func NewReplayer(fixture *Fixture) *Replayer {
+	return &Replayer{
+		used:    make([]bool, len(fixture.Interactions)),
+		fixture: fixture,
+	}
+}
+
+// RoundTrip returns the recorded response for the request.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	key := requestKey(req.Method, recordedURL(req.URL), reqBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.fixture.Interactions {
+		recorded := interaction.Request
+		body := joinBody(recorded.Body, recorded.Text)
+		if r.used[i] || requestKey(recorded.Method, recorded.URL, body) != key {
+			continue
+		}
+		r.used[i] = true
+		return interaction.Response.response(req), nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoRecording, req.Method,
+		recordedURL(req.URL))
+}
+
+// response returns the recorded response as the response to the request.
+func (r RecordedResponse) response(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	body := joinBody(r.Body, r.Text)
+	return &http.Response{
+		Status: fmt.Sprintf("%d %s", r.StatusCode,
+			http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// readBody reads and replaces the given body so it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	content, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(content))
+	return content, nil
+}
+
+// splitBody returns the body as JSON if it's valid JSON, otherwise as text.
+func splitBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		compacted := new(bytes.Buffer)
+		if err := json.Compact(compacted, body); err == nil {
+			return compacted.Bytes(), ""
+		}
+	}
+	return nil, string(body)
+}
+
+// joinBody returns the recorded body regardless of how it was recorded.
+func joinBody(body json.RawMessage, text string) []byte {
+	if len(body) != 0 {
+		return body
+	}
+	return []byte(text)
+}
+
+// recordedURL returns the URL without the 'cache buster' parameter.
+func recordedURL(u *url.URL) string {
+	stripped := *u
+	params := stripped.Query()
+	params.Del("_")
+	stripped.RawQuery = params.Encode()
+	return stripped.String()
+}
+
+// requestKey returns the string used to match a request to a recording.
+// JSON bodies are re-encoded so that spacing and key order don't matter.
+func requestKey(method, url string, body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+	return method + " " + url + " " + string(body)
+}
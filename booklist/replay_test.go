@@ -0,0 +1,128 @@
+// Unit tests related to recording and replaying catalog exchanges. //
+package booklist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Log("search recorded against a server replays without it.")
+	requests := 0
+	ts := newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"success": true, "totalHits": 1}`)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"resources": [{"shortAuthor": "Grafton, Sue",
+		    "shortTitle": "X", "format": "Book"}]}`)
+	})
+	defer ts.Close()
+
+	recorder := NewRecorder(nil)
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: recorder}
+	recorded, err := c.PublicationSearch()
+	if err != nil {
+		t.Fatalf("Recorded search failed: %s.", err)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "fixture.json")
+	if err := recorder.Save(fileName); err != nil {
+		t.Fatalf("Unable to save fixture: %s.", err)
+	}
+	ts.Close()
+
+	fixture, err := LoadFixture(fileName)
+	if err != nil {
+		t.Fatalf("Unable to load fixture: %s.", err)
+	}
+	if len(fixture.Interactions) != requests {
+		t.Errorf("Expected %d interactions to be recorded, got %d.",
+			requests, len(fixture.Interactions))
+	}
+
+	c.Client = &http.Client{Transport: NewReplayer(fixture)}
+	replayed, err := c.PublicationSearch()
+	if err != nil {
+		t.Fatalf("Replayed search failed: %s.", err)
+	}
+	if len(replayed) != 1 || replayed[0] != recorded[0] {
+		t.Errorf("Expected replayed results %v, got %v.", recorded, replayed)
+	}
+}
+
+func TestReplayNonJSONBody(t *testing.T) {
+	t.Log("non-JSON responses are recorded as text and replayed.")
+	ts := newErrorServer(replyWith("<html>not json</html>"),
+		replyWith(""))
+	defer ts.Close()
+
+	recorder := NewRecorder(nil)
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: recorder}
+	_, recordedErr := c.PublicationSearch()
+
+	fileName := filepath.Join(t.TempDir(), "fixture.json")
+	if err := recorder.Save(fileName); err != nil {
+		t.Fatalf("Unable to save fixture: %s.", err)
+	}
+	fixture, err := LoadFixture(fileName)
+	if err != nil {
+		t.Fatalf("Unable to load fixture: %s.", err)
+	}
+	if text := fixture.Interactions[0].Response.Text; text != "<html>not json</html>" {
+		t.Errorf("Expected response to be recorded as text; got %q.", text)
+	}
+
+	c.Client = &http.Client{Transport: NewReplayer(fixture)}
+	_, replayedErr := c.PublicationSearch()
+
+	var decodeErr *DecodeError
+	if !errors.As(recordedErr, &decodeErr) || !errors.As(replayedErr, &decodeErr) {
+		t.Errorf("Expected DecodeError from both searches; got %v and %v.",
+			recordedErr, replayedErr)
+	}
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	t.Log("request missing from the fixture is an error.")
+	fixture, err := LoadFixture("testdata/grafton_2015.json")
+	if err != nil {
+		t.Fatalf("Unable to load fixture: %s.", err)
+	}
+
+	c := CatalogInfo{
+		URL:    "https://catalog.library.loudoun.gov/",
+		Author: "King, Stephen",
+		Media:  "Book",
+		Year:   "2015",
+		Log:    testLog,
+		Client: &http.Client{Transport: NewReplayer(fixture)},
+	}
+	_, err = c.PublicationSearch()
+	if !errors.Is(err, ErrNoRecording) {
+		t.Errorf("Expected ErrNoRecording; got %v.", err)
+	}
+}
+
+func TestBadFixture(t *testing.T) {
+	t.Log("fixture that isn't JSON is rejected.")
+	_, err := LoadFixture("config.go")
+	if err == nil {
+		t.Error("Expected error loading config.go as a fixture.")
+	}
+}
+
+func TestRecordedURLStripsCacheBuster(t *testing.T) {
+	t.Log("cache buster parameter is removed from recorded URLs.")
+	req := httptest.NewRequest("POST",
+		"https://catalog.example.org/search?_=1502345678901", nil)
+	if got := recordedURL(req.URL); got != "https://catalog.example.org/search" {
+		t.Errorf("Expected cache buster to be removed; got %s.", got)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the results of a run, i.e., of the searches for the
+authors in the configuration file, and the state kept between runs so that
+the titles found since the previous run can be picked out.  The results of
+the last run are saved as JSON in the state directory; see StateDir.
+*/
+package booklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// resultsFile is the name of the file, in the state directory, holding the
+// results of the last run.
+const resultsFile = "last-run.json"
+
+// SearchResult is the result of the search for an author's publications.
+// Library is the url of the catalog searched.  Notify names the notifiers
+// the result is routed to, if not all of them; see AuthorInfo.
+type SearchResult struct {
+	Author       string
+	Media        string
+	Library      string `json:",omitempty"`
+	Publications []PublicationInfo
+	Notify       []string `json:",omitempty"`
+}
+
+// RunResults are the results of the searches for each of the authors.
+type RunResults struct {
+	Time    time.Time
+	Results []SearchResult
+}
+
+// ResultsPath returns the path of the file holding the results of the last
+// run.
+func ResultsPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, resultsFile), nil
+}
+
+// LoadResults reads the results of a run saved by SaveResults.  Returns
+// nil, without an error, if the file doesn't exist, e.g., before the first
+// run.
+func LoadResults(fileName string) (*RunResults, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	run := new(RunResults)
+	if err := json.Unmarshal(contents, run); err != nil {
+		return nil, fmt.Errorf("unable to parse results file %s:  %s",
+			fileName, err)
+	}
+	return run, nil
+}
+
+// SaveResults writes the results of a run, creating the file's directory
+// if necessary.
+func SaveResults(fileName string, run *RunResults) error {
+	contents, err := json.MarshalIndent(run, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, append(contents, '\n'), 0644)
+}
+
+// NewSince returns the results with only the publications that weren't
+// found by the previous run for the same author and media type; authors
+// without new publications are left out.  If there's no previous run, all
+// of the results are new.
+func (r *RunResults) NewSince(previous *RunResults) []SearchResult {
+	seen := make(map[string]bool)
+	if previous != nil {
+		for _, result := range previous.Results {
+			for _, pub := range result.Publications {
+				seen[publicationKey(result, pub)] = true
+			}
+		}
+	}
+
+	var newResults []SearchResult
+	for _, result := range r.Results {
+		newResult := SearchResult{
+			Author:  result.Author,
+			Media:   result.Media,
+			Library: result.Library,
+			Notify:  result.Notify,
+		}
+		for _, pub := range result.Publications {
+			if !seen[publicationKey(result, pub)] {
+				newResult.Publications = append(newResult.Publications, pub)
+			}
+		}
+		if len(newResult.Publications) != 0 {
+			newResults = append(newResults, newResult)
+		}
+	}
+	return newResults
+}
+
+// publicationKey identifies a publication found by a search.
+func publicationKey(result SearchResult, pub PublicationInfo) string {
+	return result.Author + "\x00" + result.Media + "\x00" + pub.Media +
+		"\x00" + pub.Publication
+}
@@ -0,0 +1,82 @@
+// Unit tests related to the results of a run. //
+package booklist
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var previousRun = &RunResults{
+	Time: time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC),
+	Results: []SearchResult{
+		{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Book", Publication: "X"},
+		}},
+		{Author: "King, Stephen", Media: "Book"},
+	},
+}
+
+var currentRun = &RunResults{
+	Time: time.Date(2015, 6, 2, 8, 0, 0, 0, time.UTC),
+	Results: []SearchResult{
+		{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Book", Publication: "X"},
+			{Media: "Large Print", Publication: "X"},
+		}},
+		{Author: "King, Stephen", Media: "Book"},
+		{Author: "Patterson, James", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Book", Publication: "Alert"},
+		}},
+	},
+}
+
+func TestNewSince(t *testing.T) {
+	t.Log("only the publications not found by the previous run are new.")
+	expected := []SearchResult{
+		{Author: "Grafton, Sue", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Large Print", Publication: "X"},
+		}},
+		{Author: "Patterson, James", Media: "Book", Publications: []PublicationInfo{
+			{Media: "Book", Publication: "Alert"},
+		}},
+	}
+	if got := currentRun.NewSince(previousRun); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected new results %v; got %v.", expected, got)
+	}
+
+	got := currentRun.NewSince(nil)
+	if len(got) != 2 || countPublications(got) != 3 {
+		t.Errorf("Expected all 3 publications to be new without a previous "+
+			"run; got %v.", got)
+	}
+}
+
+func TestSaveAndLoadResults(t *testing.T) {
+	t.Log("saved results are loaded unchanged.")
+	fileName := filepath.Join(t.TempDir(), "state", resultsFile)
+
+	run, err := LoadResults(fileName)
+	if err != nil || run != nil {
+		t.Errorf("Expected no results before the first run; got %v, %v.",
+			run, err)
+	}
+
+	if err := SaveResults(fileName, currentRun); err != nil {
+		t.Fatalf("Save failed: %s.", err)
+	}
+	run, err = LoadResults(fileName)
+	if err != nil {
+		t.Fatalf("Load failed: %s.", err)
+	}
+	if !run.Time.Equal(currentRun.Time) ||
+		!reflect.DeepEqual(run.Results, currentRun.Results) {
+		t.Errorf("Expected results %v; got %v.", currentRun, run)
+	}
+
+	writeFile(t, fileName, "{")
+	if _, err := LoadResults(fileName); err == nil {
+		t.Errorf("Expected error loading a corrupt results file.")
+	}
+}
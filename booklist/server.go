@@ -0,0 +1,535 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the HTTP server for browsing the results of the searches
+without a terminal:  a JSON API and a small HTML dashboard.  The API is
+
+    GET  /api/authors    the authors in the configuration
+    GET  /api/results    the results of the last run; the 'author',
+                         'media' and 'library' parameters filter them and
+                         'new=true' keeps only the titles new since the
+                         run before
+    GET  /api/runs       the runs of the searches, newest first
+    POST /api/search     an ad-hoc search of the configured catalog, given
+                         as a JSON object with the 'author' and,
+                         optionally, the 'media' and 'year' to search
+
+Only one ad-hoc search runs at a time; a request made while one is in
+progress is refused with 429 Too Many Requests.  The API has no
+authentication, so the server should listen on a loopback address.
+
+The dashboard, at /, lists the new titles for each author, or all of them,
+and can be filtered by media type and library.  Its template is part of
+the binary, so there are no files to install.  If there are metrics, they're
+served at /metrics for Prometheus.
+*/
+package booklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxSearchRequest is the largest body accepted for an ad-hoc search.
+const maxSearchRequest = 1 << 16
+
+// searchYearPattern matches a valid year for an ad-hoc search.
+var searchYearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// RunSummary describes a run of the searches; Error is set if it failed.
+type RunSummary struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Authors int       `json:"authors"`
+	Titles  int       `json:"titles"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// APIAuthor is an author in the configuration, as returned by the API.
+type APIAuthor struct {
+	Author string   `json:"author"`
+	Media  string   `json:"media"`
+	Notify []string `json:"notify,omitempty"`
+}
+
+// APIPublication is a title found by a search, as returned by the API.
+// New is set if the title wasn't found by the run before.
+type APIPublication struct {
+	Media    string `json:"media"`
+	Title    string `json:"title"`
+	Date     string `json:"date,omitempty"`
+	RecordID string `json:"recordId,omitempty"`
+	Link     string `json:"link"`
+	New      bool   `json:"new"`
+}
+
+// APIResult is the result of the search for an author, as returned by the
+// API.
+type APIResult struct {
+	Author       string           `json:"author"`
+	Media        string           `json:"media"`
+	Library      string           `json:"library"`
+	Year         string           `json:"year,omitempty"`
+	Publications []APIPublication `json:"publications"`
+}
+
+// APIResults are the results of a run, as returned by the API; Time is
+// zero if there's been no run yet.
+type APIResults struct {
+	Time    time.Time   `json:"time"`
+	Results []APIResult `json:"results"`
+}
+
+// APISearch is the request for an ad-hoc search.  The media type and year
+// default to the configuration's media type and the current year.  The
+// catalog searched is always the configuration's, so that the server can't
+// be made to send requests to other hosts.
+type APISearch struct {
+	Author string `json:"author"`
+	Media  string `json:"media,omitempty"`
+	Year   string `json:"year,omitempty"`
+}
+
+// apiError is the body of an error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Server serves the results of the searches over HTTP.
+//
+// Config returns the current configuration, Results the results of the
+// last run and of the run before, and Runs the runs made so far, newest
+// first; Runs may be nil.  The last run is nil if there's been none; the
+// run before is nil if it isn't known, in which case no title is new.
+// Ad-hoc searches are logged to Log and use Client, as for CatalogInfo,
+// and their requests are recorded by Metrics, which may be nil.  The error
+// of a failed ad-hoc search is logged rather than returned to the client,
+// as it may describe the network the server runs in.  Only one ad-hoc
+// search runs at a time, so that the API can't be used to flood the
+// library's website.
+type Server struct {
+	Config  func() Config
+	Results func() (run, previous *RunResults)
+	Runs    func() []RunSummary
+	Log     Logger
+	Client  *http.Client
+	Metrics *Metrics
+
+	// searching is 1 while an ad-hoc search is in progress.
+	searching int32
+}
+
+// Handler returns the handler for the API and the dashboard.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/authors", s.get(s.authors))
+	mux.HandleFunc("/api/results", s.get(s.results))
+	mux.HandleFunc("/api/runs", s.get(s.runs))
+	mux.HandleFunc("/api/search", s.search)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path)
+	})
+	if s.Metrics != nil {
+		mux.Handle("/metrics", s.Metrics.Handler())
+	}
+	mux.HandleFunc("/", s.dashboard)
+	return mux
+}
+
+// get returns a handler for a GET endpoint of the API, which replies with
+// the value returned by f as JSON.
+func (s *Server) get(f func(query url.Values) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed,
+				"method "+r.Method+" not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, f(r.URL.Query()))
+	}
+}
+
+// authors returns the authors in the configuration, with their media
+// types.
+func (s *Server) authors(url.Values) interface{} {
+	config := s.Config()
+	defaultMedia := DefaultMediaType
+	if config.Media != "" {
+		defaultMedia = config.Media
+	}
+	authors := []APIAuthor{}
+	for _, author := range config.Authors {
+		media := defaultMedia
+		if author.Media != "" {
+			media = author.Media
+		}
+		authors = append(authors, APIAuthor{
+			Author: fmt.Sprintf("%s, %s", author.Lastname, author.Firstname),
+			Media:  media,
+			Notify: author.Notify,
+		})
+	}
+	return authors
+}
+
+// results returns the results of the last run, filtered by the query.
+func (s *Server) results(query url.Values) interface{} {
+	run, previous := s.Results()
+	results := s.apiResults(run, previous)
+	filter := resultsFilter{
+		author:  query.Get("author"),
+		media:   query.Get("media"),
+		library: query.Get("library"),
+		onlyNew: query.Get("new") == "true",
+	}
+	results.Results = filter.apply(results.Results)
+	return results
+}
+
+// runs returns the runs made so far.
+func (s *Server) runs(url.Values) interface{} {
+	runs := []RunSummary{}
+	if s.Runs != nil {
+		runs = append(runs, s.Runs()...)
+	}
+	return runs
+}
+
+// search runs an ad-hoc search and replies with its result.
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed,
+			"method "+r.Method+" not allowed")
+		return
+	}
+
+	var request APISearch
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxSearchRequest))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid search request:  %s", err))
+		return
+	}
+	c, err := s.catalogInfo(request)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&s.searching, 0, 1) {
+		w.Header().Set("Retry-After", "1")
+		writeAPIError(w, http.StatusTooManyRequests,
+			"another ad-hoc search is in progress")
+		return
+	}
+	pubs, err := c.PublicationSearch()
+	atomic.StoreInt32(&s.searching, 0)
+	if err != nil {
+		orNop(s.Log).Log(LevelError, "Ad-hoc search failed", Fields{
+			"author": c.Author,
+			"media":  c.Media,
+			"year":   c.Year,
+			"error":  err,
+		})
+		writeAPIError(w, http.StatusBadGateway,
+			"search failed; the library's catalog didn't respond as "+
+				"expected")
+		return
+	}
+	result := SearchResult{
+		Author:       c.Author,
+		Media:        c.Media,
+		Library:      c.URL,
+		Publications: pubs,
+	}
+	apiResult := newAPIResult(result, nil)
+	apiResult.Year = c.Year
+	writeJSON(w, http.StatusOK, apiResult)
+}
+
+// catalogInfo returns the search for an ad-hoc search request, filling in
+// the defaults.
+func (s *Server) catalogInfo(request APISearch) (CatalogInfo, error) {
+	config := s.Config()
+	c := CatalogInfo{
+		URL:     config.URL,
+		Author:  strings.TrimSpace(request.Author),
+		Media:   DefaultMediaType,
+		Year:    request.Year,
+		Log:     s.Log,
+		Client:  s.Client,
+		Metrics: s.Metrics,
+	}
+	if c.Author == "" {
+		return c, fmt.Errorf("the search request has no author")
+	}
+	if c.URL == "" {
+		return c, fmt.Errorf("no catalog url is configured")
+	}
+	if c.Year == "" {
+		c.Year = ThisYear()
+	}
+	if !searchYearPattern.MatchString(c.Year) {
+		return c, fmt.Errorf("invalid year '%s'", c.Year)
+	}
+	if config.Media != "" {
+		c.Media = config.Media
+	}
+	if request.Media != "" {
+		media, err := LookupMediaType(request.Media)
+		if err != nil {
+			return c, err
+		}
+		c.Media = media
+	}
+	return c, nil
+}
+
+// apiResults returns the results of the run as returned by the API,
+// marking the titles not found by the previous run as new.
+func (s *Server) apiResults(run, previous *RunResults) APIResults {
+	results := APIResults{Results: []APIResult{}}
+	if run == nil {
+		return results
+	}
+	results.Time = run.Time
+	if previous == nil {
+		previous = run
+	}
+	newResults := run.NewSince(previous)
+	for _, result := range run.Results {
+		results.Results = append(results.Results,
+			newAPIResult(result, newResults))
+	}
+	return results
+}
+
+// newAPIResult returns the result as returned by the API, marking the
+// publications among the new results as new.
+func newAPIResult(result SearchResult, newResults []SearchResult) APIResult {
+	isNew := make(map[string]bool)
+	for _, newResult := range newResults {
+		for _, pub := range newResult.Publications {
+			isNew[publicationKey(newResult, pub)] = true
+		}
+	}
+
+	apiResult := APIResult{
+		Author:       result.Author,
+		Media:        result.Media,
+		Library:      result.Library,
+		Publications: []APIPublication{},
+	}
+	for _, pub := range result.Publications {
+		apiResult.Publications = append(apiResult.Publications,
+			APIPublication{
+				Media:    pub.Media,
+				Title:    pub.Publication,
+				Date:     pub.Date,
+				RecordID: pub.RecordID,
+				Link:     RecordURL(result.Library, pub.RecordID),
+				New:      isNew[publicationKey(result, pub)],
+			})
+	}
+	return apiResult
+}
+
+// resultsFilter selects the results for an author, media type and library,
+// ignoring the criteria that are empty, and, if onlyNew is set, only the
+// new titles.  The author and media type are matched regardless of case.
+type resultsFilter struct {
+	author, media, library string
+	onlyNew                bool
+}
+
+// apply returns the results selected by the filter.  With onlyNew, the
+// results without new titles are left out.
+func (f resultsFilter) apply(results []APIResult) []APIResult {
+	if media, err := LookupMediaType(f.media); err == nil {
+		f.media = media
+	}
+	selected := []APIResult{}
+	for _, result := range results {
+		if f.author != "" && !strings.EqualFold(result.Author, f.author) ||
+			f.media != "" && !strings.EqualFold(result.Media, f.media) ||
+			f.library != "" && result.Library != f.library {
+			continue
+		}
+		if f.onlyNew {
+			pubs := []APIPublication{}
+			for _, pub := range result.Publications {
+				if pub.New {
+					pubs = append(pubs, pub)
+				}
+			}
+			if len(pubs) == 0 {
+				continue
+			}
+			result.Publications = pubs
+		}
+		selected = append(selected, result)
+	}
+	return selected
+}
+
+// dashboardData is the data of the dashboard's template.
+type dashboardData struct {
+	Time      time.Time
+	Results   []APIResult
+	Media     []string
+	Libraries []string
+	Filter    struct {
+		Media, Library string
+		All            bool
+	}
+	Run *RunSummary
+}
+
+// dashboard serves the HTML dashboard, listing the titles found for each
+// author.
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	run, previous := s.Results()
+	results := s.apiResults(run, previous)
+	data := dashboardData{Time: results.Time}
+	query := r.URL.Query()
+	data.Filter.Media = query.Get("media")
+	data.Filter.Library = query.Get("library")
+	data.Filter.All = query.Get("all") == "true"
+	data.Media, data.Libraries = resultChoices(results.Results)
+	data.Results = resultsFilter{
+		media:   data.Filter.Media,
+		library: data.Filter.Library,
+		onlyNew: !data.Filter.All,
+	}.apply(results.Results)
+	if s.Runs != nil {
+		if runs := s.Runs(); len(runs) != 0 {
+			data.Run = &runs[0]
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// resultChoices returns the media types and libraries of the results, to
+// choose from in the dashboard's filters.
+func resultChoices(results []APIResult) ([]string, []string) {
+	media := make(map[string]bool)
+	libraries := make(map[string]bool)
+	for _, result := range results {
+		media[result.Media] = true
+		if result.Library != "" {
+			libraries[result.Library] = true
+		}
+	}
+	return sortedKeys(media), sortedKeys(libraries)
+}
+
+// sortedKeys returns the keys of the set, sorted.
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeJSON writes the value as the JSON body of a response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(v)
+}
+
+// writeAPIError writes an error response of the API.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// dashboardTemplate is the template of the HTML dashboard.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>booklist</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 50em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.1em; margin-bottom: 0.3em; }
+form { margin: 1em 0; }
+ul { margin-top: 0; }
+.media, .date, .meta { color: #666; }
+.new { color: #080; font-weight: bold; font-size: 0.8em; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>booklist</h1>
+<p class="meta">
+{{- if .Time.IsZero}}No searches have been run yet.
+{{- else}}Results of the search at {{.Time.Format "Mon Jan 2 15:04 MST"}}.{{end}}
+{{- with .Run}}{{if .Error}} <span class="error">The last search, at {{.Start.Format "Mon Jan 2 15:04 MST"}}, failed:  {{.Error}}</span>{{end}}{{end}}
+</p>
+<form method="get" action="/">
+<label>Media
+<select name="media">
+<option value="">All</option>
+{{- range .Media}}
+<option{{if eq . $.Filter.Media}} selected{{end}}>{{.}}</option>
+{{- end}}
+</select></label>
+<label>Library
+<select name="library">
+<option value="">All</option>
+{{- range .Libraries}}
+<option{{if eq . $.Filter.Library}} selected{{end}}>{{.}}</option>
+{{- end}}
+</select></label>
+<label><input type="checkbox" name="all" value="true"{{if .Filter.All}} checked{{end}}> All titles, not only new ones</label>
+<button type="submit">Show</button>
+</form>
+{{- range .Results}}
+<h2>{{.Author}} <span class="media">&mdash; {{.Media}}s</span></h2>
+<ul>
+{{- range .Publications}}
+<li><a href="{{.Link}}">{{.Title}}</a> <span class="media">[{{.Media}}]</span>
+{{- if .Date}} <span class="date">{{.Date}}</span>{{end}}
+{{- if .New}} <span class="new">new</span>{{end}}</li>
+{{- else}}
+<li class="meta">No titles found.</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>{{if .Filter.All}}No titles found.{{else}}No new titles.{{end}}</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,328 @@
+// Unit tests related to the HTTP API and dashboard. //
+package booklist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+const serverLibrary = "https://catalog.example.org/"
+
+// newTestServer returns a server of the current and previous runs, from
+// a library, for a configuration with two authors.
+func newTestServer() *Server {
+	run := &RunResults{Time: currentRun.Time}
+	for _, result := range currentRun.Results {
+		result.Library = serverLibrary
+		run.Results = append(run.Results, result)
+	}
+	return &Server{
+		Config: func() Config {
+			return Config{
+				URL:   serverLibrary,
+				Media: "eBook",
+				Authors: []AuthorInfo{
+					{Firstname: "Sue", Lastname: "Grafton"},
+					{Firstname: "Stephen", Lastname: "King", Media: "Book",
+						Notify: []string{"email"}},
+				},
+			}
+		},
+		Results: func() (*RunResults, *RunResults) {
+			return run, previousRun
+		},
+		Log: testLog,
+	}
+}
+
+// apiRequest issues a request to the server's handler and decodes the JSON
+// response into v.  Returns the status code.
+func apiRequest(t *testing.T, s *Server, method, target, body string, v interface{}) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	s.Handler().ServeHTTP(recorder, request)
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON response to %s; got %s.", target,
+			contentType)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("Unable to decode the response to %s: %s.", target, err)
+	}
+	return recorder.Code
+}
+
+func TestAPIAuthors(t *testing.T) {
+	t.Log("the authors are listed with their media types.")
+	var authors []APIAuthor
+	status := apiRequest(t, newTestServer(), "GET", "/api/authors", "",
+		&authors)
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200; got %d.", status)
+	}
+	if len(authors) != 2 ||
+		authors[0].Author != "Grafton, Sue" || authors[0].Media != "eBook" ||
+		authors[1].Author != "King, Stephen" || authors[1].Media != "Book" ||
+		len(authors[1].Notify) != 1 {
+		t.Errorf("Unexpected authors %+v.", authors)
+	}
+}
+
+func TestAPIResults(t *testing.T) {
+	t.Log("the results mark the titles not found by the previous run as new.")
+	var results APIResults
+	apiRequest(t, newTestServer(), "GET", "/api/results", "", &results)
+	if !results.Time.Equal(currentRun.Time) || len(results.Results) != 3 {
+		t.Fatalf("Unexpected results %+v.", results)
+	}
+	grafton := results.Results[0]
+	if grafton.Library != serverLibrary || len(grafton.Publications) != 2 ||
+		grafton.Publications[0].New || !grafton.Publications[1].New {
+		t.Errorf("Expected the large print title only to be new; got %+v.",
+			grafton)
+	}
+	if link := grafton.Publications[0].Link; link != serverLibrary {
+		t.Errorf("Expected a title without a record to link to the "+
+			"catalog; got %s.", link)
+	}
+	if pubs := results.Results[1].Publications; pubs == nil || len(pubs) != 0 {
+		t.Errorf("Expected an empty list of titles; got %v.", pubs)
+	}
+
+	t.Log("the results are filtered by author, media, library and newness.")
+	tests := []struct {
+		query   string
+		authors []string
+	}{
+		{"author=grafton,+sue", []string{"Grafton, Sue"}},
+		{"media=book", []string{"Grafton, Sue", "King, Stephen",
+			"Patterson, James"}},
+		{"media=ebook", nil},
+		{"library=https://other.example.org/", nil},
+		{"new=true", []string{"Grafton, Sue", "Patterson, James"}},
+	}
+	for _, test := range tests {
+		results = APIResults{}
+		apiRequest(t, newTestServer(), "GET", "/api/results?"+test.query,
+			"", &results)
+		var authors []string
+		for _, result := range results.Results {
+			authors = append(authors, result.Author)
+		}
+		if strings.Join(authors, "; ") != strings.Join(test.authors, "; ") {
+			t.Errorf("Expected authors %v for %s; got %v.", test.authors,
+				test.query, authors)
+		}
+	}
+	if len(results.Results[0].Publications) != 1 {
+		t.Errorf("Expected only the new title with new=true; got %+v.",
+			results.Results[0])
+	}
+
+	t.Log("without a run, the results are empty.")
+	s := newTestServer()
+	s.Results = func() (*RunResults, *RunResults) { return nil, nil }
+	results = APIResults{}
+	apiRequest(t, s, "GET", "/api/results", "", &results)
+	if !results.Time.IsZero() || results.Results == nil ||
+		len(results.Results) != 0 {
+		t.Errorf("Expected no results; got %+v.", results)
+	}
+}
+
+func TestAPIRuns(t *testing.T) {
+	t.Log("the runs are listed, or an empty list if there are none.")
+	var runs []RunSummary
+	apiRequest(t, newTestServer(), "GET", "/api/runs", "", &runs)
+	if runs == nil || len(runs) != 0 {
+		t.Errorf("Expected an empty list of runs; got %v.", runs)
+	}
+
+	s := newTestServer()
+	start := time.Date(2015, 6, 2, 8, 0, 0, 0, time.UTC)
+	s.Runs = func() []RunSummary {
+		return []RunSummary{{Start: start, End: start.Add(time.Minute),
+			Authors: 3, Error: "search failed"}}
+	}
+	apiRequest(t, s, "GET", "/api/runs", "", &runs)
+	if len(runs) != 1 || !runs[0].Start.Equal(start) ||
+		runs[0].Authors != 3 || runs[0].Error != "search failed" {
+		t.Errorf("Unexpected runs %+v.", runs)
+	}
+}
+
+func TestAPISearch(t *testing.T) {
+	t.Log("an ad-hoc search returns the titles found.")
+	catalog := booklisttest.NewServer(
+		booklisttest.Publication{Author: "Grafton, Sue", Title: "X",
+			Format: "eBook", Year: "2015"},
+		booklisttest.Publication{Author: "Grafton, Sue", Title: "W",
+			Format: "Book", Year: "2013"},
+	)
+	defer catalog.Close()
+
+	s := newTestServer()
+	config := s.Config()
+	config.URL = catalog.URL
+	s.Config = func() Config { return config }
+	var result APIResult
+	status := apiRequest(t, s, "POST", "/api/search",
+		`{"author": "Grafton, Sue", "year": "2015"}`, &result)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d.", status)
+	}
+	if result.Author != "Grafton, Sue" || result.Media != "eBook" ||
+		result.Year != "2015" || result.Library != catalog.URL ||
+		len(result.Publications) != 1 || result.Publications[0].Title != "X" {
+		t.Errorf("Unexpected result %+v.", result)
+	}
+
+	t.Log("an invalid ad-hoc search is rejected.")
+	tests := []struct {
+		body, message string
+	}{
+		{`{"author": "Grafton, Sue"`, "invalid search request"},
+		{`{"author": "Grafton, Sue", "title": "X"}`, "unknown field"},
+		{`{"author": "Grafton, Sue", "url": "http://127.0.0.1:1/"}`,
+			"unknown field"},
+		{`{"media": "ebook"}`, "no author"},
+		{`{"author": "Grafton, Sue", "year": "15"}`, "invalid year"},
+		{`{"author": "Grafton, Sue", "media": "scroll"}`,
+			"unsupported media type"},
+	}
+	for _, test := range tests {
+		var apiErr apiError
+		status := apiRequest(t, s, "POST", "/api/search", test.body, &apiErr)
+		if status != http.StatusBadRequest ||
+			!strings.Contains(apiErr.Error, test.message) {
+			t.Errorf("Expected status 400 with '%s' for %s; got %d, %s.",
+				test.message, test.body, status, apiErr.Error)
+		}
+	}
+
+	t.Log("an ad-hoc search is refused while another is in progress.")
+	s.searching = 1
+	var busy apiError
+	status = apiRequest(t, s, "POST", "/api/search",
+		`{"author": "Grafton, Sue"}`, &busy)
+	if status != http.StatusTooManyRequests ||
+		!strings.Contains(busy.Error, "in progress") {
+		t.Errorf("Expected status 429; got %d, %s.", status, busy.Error)
+	}
+	s.searching = 0
+
+	t.Log("a failed ad-hoc search is reported as a bad gateway, " +
+		"without the error.")
+	catalog.Inject(booklisttest.Fault{Status: http.StatusInternalServerError})
+	log := new(recordingLogger)
+	s.Log = log
+	var apiErr apiError
+	status = apiRequest(t, s, "POST", "/api/search",
+		`{"author": "Grafton, Sue"}`, &apiErr)
+	if status != http.StatusBadGateway ||
+		!strings.HasPrefix(apiErr.Error, "search failed") ||
+		strings.Contains(apiErr.Error, "127.0.0.1") {
+		t.Errorf("Expected status 502; got %d, %s.", status, apiErr.Error)
+	}
+	if n := len(log.entries); n == 0 ||
+		log.entries[n-1].message != "Ad-hoc search failed" {
+		t.Errorf("Expected the failure to be logged; got %v.", log.entries)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	t.Log("the wrong method and unknown endpoints are errors.")
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{"POST", "/api/results", http.StatusMethodNotAllowed},
+		{"GET", "/api/search", http.StatusMethodNotAllowed},
+		{"GET", "/api/titles", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		var apiErr apiError
+		status := apiRequest(t, newTestServer(), test.method, test.target, "",
+			&apiErr)
+		if status != test.status || apiErr.Error == "" {
+			t.Errorf("Expected status %d with an error for %s %s; got %d.",
+				test.status, test.method, test.target, status)
+		}
+	}
+}
+
+// dashboard returns the dashboard for the query.
+func dashboard(t *testing.T, s *Server, query string) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/"+query, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the dashboard; got %d.",
+			recorder.Code)
+	}
+	contents, _ := ioutil.ReadAll(recorder.Body)
+	return string(contents)
+}
+
+func TestDashboard(t *testing.T) {
+	t.Log("the dashboard lists the new titles for each author.")
+	page := dashboard(t, newTestServer(), "")
+	for _, expected := range []string{"Grafton, Sue", "Patterson, James",
+		"Alert", "[Large Print]"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected the dashboard to contain '%s'.", expected)
+		}
+	}
+	if strings.Contains(page, "King, Stephen") ||
+		strings.Contains(page, `>X</a> <span class="media">[Book]`) {
+		t.Errorf("Expected only the authors with new titles.")
+	}
+
+	t.Log("the dashboard lists all of the titles if asked.")
+	page = dashboard(t, newTestServer(), "?all=true")
+	if !strings.Contains(page, "King, Stephen") ||
+		!strings.Contains(page, "No titles found.") {
+		t.Errorf("Expected every author with all=true.")
+	}
+
+	t.Log("the dashboard is filtered by media and library.")
+	page = dashboard(t, newTestServer(), "?media=eBook")
+	if !strings.Contains(page, "No new titles.") {
+		t.Errorf("Expected no titles for another media type.")
+	}
+	page = dashboard(t, newTestServer(), "?library="+serverLibrary)
+	if !strings.Contains(page, "Alert") ||
+		!strings.Contains(page, "<option selected>"+serverLibrary+"</option>") {
+		t.Errorf("Expected the titles from the selected library.")
+	}
+
+	t.Log("the titles are escaped.")
+	s := newTestServer()
+	s.Results = func() (*RunResults, *RunResults) {
+		return &RunResults{Time: currentRun.Time, Results: []SearchResult{
+			{Author: "Grafton, Sue", Media: "Book",
+				Publications: []PublicationInfo{
+					{Media: "Book", Publication: "<script>X</script>"},
+				}},
+		}}, new(RunResults)
+	}
+	page = dashboard(t, s, "")
+	if strings.Contains(page, "<script>") ||
+		!strings.Contains(page, "&lt;script&gt;X&lt;/script&gt;") {
+		t.Errorf("Expected the title to be escaped.")
+	}
+
+	t.Log("pages other than the dashboard aren't found.")
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/other", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404; got %d.", recorder.Code)
+	}
+}
@@ -0,0 +1,389 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains an HTTP transport that traces the exchanges with a
+CARL.X catalog, to help diagnose changes in a library's configuration.
+Each request (URL, headers and body) and its response (status, headers,
+body and the time taken) is written either to its own JSON file in a
+directory or, when finished, to a single HTTP Archive (HAR) file that
+can be loaded into a browser's developer tools.
+
+Patron credentials are redacted from the trace:  the user information of
+URLs, the values of the Authorization, Cookie and Set-Cookie headers and of
+any query parameter or JSON field whose name suggests a credential, e.g.,
+'pin', 'password' or 'patronId'.
+*/
+package booklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces the value of a credential in a trace.
+const redacted = "REDACTED"
+
+// redactedHeaders are the headers whose values are removed from a trace.
+var redactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// redactedFields are the lower case names of query parameters and JSON
+// fields whose values are removed from a trace.
+var redactedFields = map[string]bool{
+	"barcode":  true,
+	"password": true,
+	"patronid": true,
+	"pin":      true,
+	"secret":   true,
+	"token":    true,
+	"username": true,
+}
+
+// TraceEntry is a traced request and its response.  Error is the error
+// returned by the transport, in which case there is no response.
+type TraceEntry struct {
+	Started  time.Time        `json:"started"`
+	Duration time.Duration    `json:"duration"`
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// Tracer is an http.RoundTripper that traces each exchange it passes on
+// to the underlying transport.  A trace that can't be written doesn't fail
+// the request; the error is returned by Err instead.
+type Tracer struct {
+	// Transport issues the requests; http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	// Dir, if not empty, is the directory each entry is written to as
+	// soon as the exchange completes.
+	Dir string
+
+	mu      sync.Mutex
+	entries []TraceEntry
+
+	// writeErr is the first error writing an entry to Dir.
+	writeErr error
+}
+
+// NewTracer returns a Tracer that issues requests using the given
+// transport.  If dir isn't empty, it's created if needed.
+func NewTracer(transport http.RoundTripper, dir string) (*Tracer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Tracer{Transport: transport, Dir: dir}, nil
+}
+
+// RoundTrip issues the request and traces it along with its response.
+func (t *Tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry TraceEntry
+	entry.Request = RecordedRequest{
+		Method: req.Method,
+		URL:    redactURL(req.URL),
+		Header: redactHeader(req.Header),
+	}
+	entry.Request.Body, entry.Request.Text = splitBody(redactBody(reqBody))
+
+	entry.Started = time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		entry.Duration = time.Since(entry.Started)
+		entry.Error = err.Error()
+		t.add(entry)
+		return nil, err
+	}
+
+	respBody, err := readBody(&resp.Body)
+	entry.Duration = time.Since(entry.Started)
+	if err != nil {
+		entry.Error = err.Error()
+		t.add(entry)
+		return nil, err
+	}
+
+	entry.Response = RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     redactHeader(resp.Header),
+	}
+	entry.Response.Body, entry.Response.Text = splitBody(redactBody(respBody))
+
+	t.add(entry)
+	return resp, nil
+}
+
+// Entries returns the exchanges traced so far.
+func (t *Tracer) Entries() []TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEntry(nil), t.entries...)
+}
+
+// Err returns the first error writing an entry to Dir, or nil if every
+// entry was written.
+func (t *Tracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writeErr
+}
+
+// add saves the entry and, if tracing to a directory, writes it.  A
+// failure to write it is kept for Err.
+func (t *Tracer) add(entry TraceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+	if t.Dir == "" {
+		return
+	}
+
+	endpoint := strings.Trim(entry.Request.URL, "/")
+	if u, parseErr := url.Parse(entry.Request.URL); parseErr == nil {
+		endpoint = strings.Trim(u.Path, "/")
+	}
+	fileName := filepath.Join(t.Dir, fmt.Sprintf("%04d-%s.json",
+		len(t.entries), strings.Replace(endpoint, "/", "-", -1)))
+
+	content, marshalErr := json.MarshalIndent(entry, "", "  ")
+	if marshalErr == nil {
+		marshalErr = os.WriteFile(fileName, append(content, '\n'), 0644)
+	}
+	if marshalErr != nil && t.writeErr == nil {
+		t.writeErr = fmt.Errorf("unable to write trace file %s: %s",
+			fileName, marshalErr)
+	}
+}
+
+// WriteHAR writes the exchanges traced so far to the given file in
+// HTTP Archive format.
+func (t *Tracer) WriteHAR(fileName string) error {
+	type harHeader struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	type harRequest struct {
+		Method      string       `json:"method"`
+		URL         string       `json:"url"`
+		HTTPVersion string       `json:"httpVersion"`
+		Headers     []harHeader  `json:"headers"`
+		QueryString []harHeader  `json:"queryString"`
+		Cookies     []harHeader  `json:"cookies"`
+		PostData    *harPostData `json:"postData,omitempty"`
+		HeadersSize int          `json:"headersSize"`
+		BodySize    int          `json:"bodySize"`
+	}
+	type harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	type harResponse struct {
+		Status      int         `json:"status"`
+		StatusText  string      `json:"statusText"`
+		HTTPVersion string      `json:"httpVersion"`
+		Headers     []harHeader `json:"headers"`
+		Cookies     []harHeader `json:"cookies"`
+		Content     harContent  `json:"content"`
+		RedirectURL string      `json:"redirectURL"`
+		HeadersSize int         `json:"headersSize"`
+		BodySize    int         `json:"bodySize"`
+	}
+	type harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+	type harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+	type harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	type harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+
+	headers := func(header http.Header) []harHeader {
+		list := []harHeader{}
+		for name, values := range header {
+			for _, value := range values {
+				list = append(list, harHeader{name, value})
+			}
+		}
+		return list
+	}
+
+	entries := []harEntry{}
+	for _, entry := range t.Entries() {
+		ms := float64(entry.Duration) / float64(time.Millisecond)
+
+		request := harRequest{
+			Method:      entry.Request.Method,
+			URL:         entry.Request.URL,
+			HTTPVersion: "HTTP/1.1",
+			Headers:     headers(entry.Request.Header),
+			QueryString: []harHeader{},
+			Cookies:     []harHeader{},
+			HeadersSize: -1,
+		}
+		if u, err := url.Parse(entry.Request.URL); err == nil {
+			for name, values := range u.Query() {
+				for _, value := range values {
+					request.QueryString = append(request.QueryString,
+						harHeader{name, value})
+				}
+			}
+		}
+		body := joinBody(entry.Request.Body, entry.Request.Text)
+		request.BodySize = len(body)
+		if len(body) != 0 {
+			request.PostData = &harPostData{
+				MimeType: entry.Request.Header.Get("Content-Type"),
+				Text:     string(body),
+			}
+		}
+
+		body = joinBody(entry.Response.Body, entry.Response.Text)
+		response := harResponse{
+			Status:      entry.Response.StatusCode,
+			StatusText:  http.StatusText(entry.Response.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     headers(entry.Response.Header),
+			Cookies:     []harHeader{},
+			Content: harContent{
+				Size:     len(body),
+				MimeType: entry.Response.Header.Get("Content-Type"),
+				Text:     string(body),
+			},
+			HeadersSize: -1,
+			BodySize:    len(body),
+		}
+
+		entries = append(entries, harEntry{
+			StartedDateTime: entry.Started.Format(time.RFC3339Nano),
+			Time:            ms,
+			Request:         request,
+			Response:        response,
+			Timings:         harTimings{Send: 0, Wait: ms, Receive: 0},
+			Comment:         entry.Error,
+		})
+	}
+
+	har := struct {
+		Log harLog `json:"log"`
+	}{harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "booklist", Version: "1.0"},
+		Entries: entries,
+	}}
+	content, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(content, '\n'), 0644)
+}
+
+// redactHeader returns a copy of the header with credentials redacted.
+func redactHeader(header http.Header) http.Header {
+	clone := header.Clone()
+	for _, name := range redactedHeaders {
+		if clone.Get(name) != "" {
+			clone.Set(name, redacted)
+		}
+	}
+	return clone
+}
+
+// redactURL returns the URL with credentials in its user information or
+// query redacted.
+func redactURL(u *url.URL) string {
+	clone := *u
+	if clone.User != nil {
+		clone.User = url.User(redacted)
+	}
+	params := clone.Query()
+	for name := range params {
+		if redactedFields[strings.ToLower(name)] {
+			params.Set(name, redacted)
+		}
+	}
+	clone.RawQuery = params.Encode()
+	return clone.String()
+}
+
+// redactBody returns the body with credentials redacted if it's JSON.
+func redactBody(body []byte) []byte {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return body
+	}
+	if !redactValue(decoded) {
+		return body
+	}
+	content, err := json.Marshal(decoded)
+	if err != nil {
+		return body
+	}
+	return content
+}
+
+// redactValue redacts credentials found anywhere in a decoded JSON value;
+// it returns whether anything was redacted.
+func redactValue(value interface{}) bool {
+	found := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if redactedFields[strings.ToLower(name)] {
+				v[name] = redacted
+				found = true
+			} else if redactValue(field) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if redactValue(item) {
+				found = true
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,175 @@
+// Unit tests related to tracing catalog exchanges. //
+package booklist
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceDirectory(t *testing.T) {
+	t.Log("each exchange is written to the trace directory.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [{"shortAuthor": "Grafton, Sue",
+		    "shortTitle": "X", "format": "Book"}]}`))
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "trace")
+	tracer, err := NewTracer(nil, dir)
+	if err != nil {
+		t.Fatalf("Unable to create tracer: %s.", err)
+	}
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: tracer}
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 trace files; got %v (%v).", files, err)
+	}
+	if !strings.HasSuffix(files[0], "0001-search-count.json") ||
+		!strings.HasSuffix(files[1], "0002-search.json") {
+		t.Errorf("Unexpected trace file names: %v.", files)
+	}
+
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Unable to read trace file: %s.", err)
+	}
+	var entry TraceEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		t.Fatalf("Unable to parse trace file: %s.", err)
+	}
+	if entry.Response.StatusCode != http.StatusOK {
+		t.Errorf("Expected traced status 200; got %d.",
+			entry.Response.StatusCode)
+	}
+	if !strings.Contains(string(entry.Request.Body), "Grafton, Sue") {
+		t.Errorf("Expected traced request body to contain the author; "+
+			"got %s.", entry.Request.Body)
+	}
+}
+
+func TestTraceWriteError(t *testing.T) {
+	t.Log("a trace file that can't be written doesn't fail the search.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 1}`),
+		replyWith(`{"resources": [{"shortAuthor": "Grafton, Sue",
+		    "shortTitle": "X", "format": "Book"}]}`))
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "trace")
+	tracer, err := NewTracer(nil, dir)
+	if err != nil {
+		t.Fatalf("Unable to create tracer: %s.", err)
+	}
+	if err := os.Remove(dir); err != nil {
+		t.Fatalf("Unable to remove the trace directory: %s.", err)
+	}
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: tracer}
+	if pubs, err := c.PublicationSearch(); err != nil || len(pubs) != 1 {
+		t.Errorf("Expected the search to succeed; got %v, %v.", pubs, err)
+	}
+	if err := tracer.Err(); err == nil ||
+		!strings.Contains(err.Error(), "unable to write trace file") {
+		t.Errorf("Expected the write error to be kept; got %v.", err)
+	}
+	if len(tracer.Entries()) != 2 {
+		t.Errorf("Expected 2 entries; got %d.", len(tracer.Entries()))
+	}
+}
+
+func TestTraceHAR(t *testing.T) {
+	t.Log("traced exchanges are written as a HAR file.")
+	ts := newErrorServer(replyWith(`{"success": true, "totalHits": 0}`),
+		replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	tracer, err := NewTracer(nil, "")
+	if err != nil {
+		t.Fatalf("Unable to create tracer: %s.", err)
+	}
+	c := testCatalog(ts.URL)
+	c.Client = &http.Client{Transport: tracer}
+	if _, err := c.PublicationSearch(); err != nil {
+		t.Fatalf("Search failed: %s.", err)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "trace.har")
+	if err := tracer.WriteHAR(fileName); err != nil {
+		t.Fatalf("Unable to write HAR file: %s.", err)
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read HAR file: %s.", err)
+	}
+	var har struct {
+		Log struct {
+			Version string
+			Entries []struct {
+				Request struct {
+					Method   string
+					PostData struct{ Text string }
+				}
+				Response struct{ Status int }
+			}
+		}
+	}
+	if err := json.Unmarshal(content, &har); err != nil {
+		t.Fatalf("Unable to parse HAR file: %s.", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 1 {
+		t.Fatalf("Expected HAR 1.2 with one entry; got %s with %d.",
+			har.Log.Version, len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Response.Status != 200 ||
+		!strings.Contains(entry.Request.PostData.Text, "Grafton, Sue") {
+		t.Errorf("Unexpected HAR entry: %+v.", entry)
+	}
+}
+
+func TestTraceRedaction(t *testing.T) {
+	t.Log("credentials are redacted from the trace.")
+	ts := newErrorServer(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret"})
+		w.Write([]byte(`{"success": true, "totalHits": 0,
+		    "patron": {"patronId": "21234000123456", "pin": "secretpin"}}`))
+	}, replyWith(`{"resources": []}`))
+	defer ts.Close()
+
+	tracer, err := NewTracer(nil, "")
+	if err != nil {
+		t.Fatalf("Unable to create tracer: %s.", err)
+	}
+	withUser := strings.Replace(ts.URL, "://", "://cardholder:letmein@", 1)
+	req, err := http.NewRequest("POST", withUser+"/search/count?pin=secretpin",
+		strings.NewReader(`{"searchTerm": "x", "password": "hunter2"}`))
+	if err != nil {
+		t.Fatalf("Unable to create request: %s.", err)
+	}
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	resp, err := (&http.Client{Transport: tracer}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s.", err)
+	}
+	resp.Body.Close()
+
+	content, err := json.Marshal(tracer.Entries())
+	if err != nil {
+		t.Fatalf("Unable to marshal entries: %s.", err)
+	}
+	for _, secret := range []string{"secretpin", "dXNlcjpwYXNz", "hunter2",
+		"21234000123456", "s3cret", "cardholder", "letmein"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("Expected %q to be redacted from trace: %s.",
+				secret, content)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+/*
+Package booklist provides functions for searching a library's catalog website.
+
+This file contains the webhook notifier, which posts the digest of a run to
+a URL, e.g., to send new titles to a chat room.  The payload is one of
+WebhookFormats:
+
+    generic    a JSON object with the run's time, the number of titles
+               and the results for each author; see WebhookPayload
+    slack      a Slack message with a section for each author, for an
+               incoming webhook URL
+    discord    a Discord message with an embed for each author, for a
+               channel's webhook URL
+    matrix     a Matrix m.notice message with plain text and HTML bodies;
+               the URL is the room's send endpoint, e.g.,
+               https://matrix.example.org/_matrix/client/v3/rooms/ROOM/send/m.room.message
+               and an access token is needed; see token-env
+
+The chat formats list only the authors with titles found.  A request that
+fails with a network error, a 5xx status or 429 Too Many Requests is
+retried, after waiting for a second, then two, and so on, or for as long as
+the Retry-After header asks.
+*/
+package booklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload formats of the webhook notifier.
+const (
+	WebhookGeneric = "generic"
+	WebhookSlack   = "slack"
+	WebhookDiscord = "discord"
+	WebhookMatrix  = "matrix"
+)
+
+// WebhookFormats lists the payload formats of the webhook notifier.
+var WebhookFormats = []string{WebhookGeneric, WebhookSlack, WebhookDiscord,
+	WebhookMatrix}
+
+const (
+	// DefaultWebhookRetries is the number of times a failed request is
+	// retried, unless configured otherwise.
+	DefaultWebhookRetries = 3
+
+	// Timeout in seconds for each request to a webhook.
+	webhookTimeout = 30
+
+	// Longest wait in seconds before retrying a request, whatever the
+	// Retry-After header asks for.
+	maxRetryWait = 60
+
+	// Limits of the chat services on the size of a message.
+	slackMaxSections = 48
+	slackMaxText     = 3000
+	discordMaxEmbeds = 10
+	discordMaxTitle  = 256
+	discordMaxText   = 4096
+)
+
+// WebhookConfig configures a webhook notifier.  Name is used to route
+// authors to the webhook; see AuthorInfo.  The access token, if any, is
+// read from the environment variable named by TokenEnv and sent as a bearer
+// token.  If OnlyNew is set, only the titles that are new since the
+// previous run are posted, and nothing is posted if there are none.
+// Retries defaults to DefaultWebhookRetries.
+type WebhookConfig struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`
+	Format   string `yaml:"format,omitempty"`
+	TokenEnv string `yaml:"token-env,omitempty"`
+	OnlyNew  bool   `yaml:"only-new,omitempty"`
+	Retries  *int   `yaml:"retries,omitempty"`
+}
+
+// WebhookPayload is the payload of the generic webhook format.
+type WebhookPayload struct {
+	Time    time.Time       `json:"time"`
+	OnlyNew bool            `json:"onlyNew"`
+	Count   int             `json:"count"`
+	Authors []WebhookAuthor `json:"authors"`
+}
+
+// WebhookAuthor is the results for an author in the generic webhook format.
+type WebhookAuthor struct {
+	Author       string           `json:"author"`
+	Media        string           `json:"media"`
+	Publications []WebhookRelease `json:"publications"`
+}
+
+// WebhookRelease is a publication in the generic webhook format.
+type WebhookRelease struct {
+	Media string `json:"media"`
+	Title string `json:"title"`
+}
+
+// WebhookNotifier posts the digest of a run to a webhook.  Client defaults
+// to a client with a timeout, Getenv to os.Getenv and Sleep, used to wait
+// before retrying, to time.Sleep.  Metrics, if not nil, records the
+// retries and Log, if not nil, logs them.
+type WebhookNotifier struct {
+	Config  WebhookConfig
+	Client  *http.Client
+	Getenv  func(string) string
+	Sleep   func(time.Duration)
+	Metrics *Metrics
+	Log     Logger
+}
+
+// NewWebhookNotifier returns a webhook notifier.
+func NewWebhookNotifier(config WebhookConfig) (*WebhookNotifier, error) {
+	if config.Format == "" {
+		config.Format = WebhookGeneric
+	}
+	if !containsString(WebhookFormats, config.Format) {
+		return nil, fmt.Errorf("webhook %s: unknown format '%s'; the "+
+			"formats are %s", config.Name, config.Format,
+			strings.Join(WebhookFormats, ", "))
+	}
+	return &WebhookNotifier{
+		Config: config,
+		Client: &http.Client{Timeout: webhookTimeout * time.Second},
+		Getenv: os.Getenv,
+		Sleep:  time.Sleep,
+	}, nil
+}
+
+// Name returns the name of the webhook.
+func (n *WebhookNotifier) Name() string {
+	return n.Config.Name
+}
+
+// Notify posts the digest to the webhook, retrying if the request fails.
+// With OnlyNew, nothing is posted if there are no new titles.
+func (n *WebhookNotifier) Notify(digest Digest) error {
+	payload, err := n.Payload(digest)
+	if err != nil || payload == nil {
+		return err
+	}
+
+	retries := DefaultWebhookRetries
+	if n.Config.Retries != nil {
+		retries = *n.Config.Retries
+	}
+	method, url := http.MethodPost, n.Config.URL
+	if n.Config.Format == WebhookMatrix {
+		// Matrix messages are sent with PUT to a transaction ID, which
+		// is the same for each attempt so that a retried message isn't
+		// posted twice.
+		method = http.MethodPut
+		url = strings.TrimSuffix(url, "/") + "/booklist-" +
+			strconv.FormatInt(digest.Time.UnixNano(), 10)
+	}
+
+	wait := time.Second
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := n.post(method, url, payload)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt == retries {
+			return fmt.Errorf("unable to notify webhook %s:  %s",
+				n.Config.Name, err)
+		}
+		if retryAfter == 0 {
+			retryAfter = wait
+			wait *= 2
+		}
+		orNop(n.Log).Log(LevelWarn, "Retrying the webhook", Fields{
+			"notifier": n.Config.Name,
+			"attempt":  attempt + 1,
+			"wait":     retryAfter,
+			"error":    err,
+		})
+		n.Sleep(retryAfter)
+		n.Metrics.ObserveRetry(n.Config.Name)
+	}
+}
+
+// post sends the payload.  If the request failed, it returns how long to
+// wait before retrying:  zero if the server didn't say, or a negative
+// duration if the request shouldn't be retried.
+func (n *WebhookNotifier) post(method, url string, payload []byte) (time.Duration, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Config.TokenEnv != "" {
+		token := n.Getenv(n.Config.TokenEnv)
+		if token == "" {
+			return -1, fmt.Errorf("$%s, named by token-env, is not set",
+				n.Config.TokenEnv)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode < 500 {
+		return -1, err
+	}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		if seconds > maxRetryWait {
+			seconds = maxRetryWait
+		}
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, err
+}
+
+// Payload returns the JSON payload posted for the digest, or nil if nothing
+// would be posted, e.g., if no authors are routed to the webhook.
+func (n *WebhookNotifier) Payload(digest Digest) ([]byte, error) {
+	if len(digest.Results) == 0 || n.Config.OnlyNew && len(digest.New) == 0 {
+		return nil, nil
+	}
+	authors := digest.Shown(n.Config.OnlyNew)
+	summary := digestSummary(countPublications(authors), n.Config.OnlyNew)
+
+	var payload interface{}
+	switch n.Config.Format {
+	case WebhookSlack:
+		payload = slackPayload(summary, withTitles(authors))
+	case WebhookDiscord:
+		payload = discordPayload(summary, withTitles(authors))
+	case WebhookMatrix:
+		payload = matrixPayload(summary, withTitles(authors))
+	default:
+		generic := WebhookPayload{
+			Time:    digest.Time,
+			OnlyNew: n.Config.OnlyNew,
+			Count:   countPublications(authors),
+			Authors: []WebhookAuthor{},
+		}
+		for _, result := range authors {
+			author := WebhookAuthor{
+				Author:       result.Author,
+				Media:        result.Media,
+				Publications: []WebhookRelease{},
+			}
+			for _, pub := range result.Publications {
+				author.Publications = append(author.Publications,
+					WebhookRelease{Media: pub.Media, Title: pub.Publication})
+			}
+			generic.Authors = append(generic.Authors, author)
+		}
+		payload = generic
+	}
+	return json.Marshal(payload)
+}
+
+// withTitles returns the results of the authors with titles found.
+func withTitles(results []SearchResult) []SearchResult {
+	var found []SearchResult
+	for _, result := range results {
+		if len(result.Publications) != 0 {
+			found = append(found, result)
+		}
+	}
+	return found
+}
+
+// digestSummary returns a one line summary of the titles in a digest.
+func digestSummary(count int, onlyNew bool) string {
+	if count == 0 {
+		return "No titles were found by booklist"
+	}
+	if onlyNew {
+		return fmt.Sprintf("%d new titles from booklist", count)
+	}
+	return fmt.Sprintf("%d titles from booklist", count)
+}
+
+// slackPayload returns a Slack message with a section for each author.
+func slackPayload(summary string, authors []SearchResult) interface{} {
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type block struct {
+		Type     string `json:"type"`
+		Text     *text  `json:"text,omitempty"`
+		Elements []text `json:"elements,omitempty"`
+	}
+
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	blocks := []block{{
+		Type: "header",
+		Text: &text{Type: "plain_text", Text: summary},
+	}}
+	for i, result := range authors {
+		if i == slackMaxSections {
+			blocks = append(blocks, block{
+				Type: "context",
+				Elements: []text{{Type: "mrkdwn", Text: fmt.Sprintf(
+					"and %d more authors", len(authors)-i)}},
+			})
+			break
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%s* (%ss)", escape.Replace(result.Author),
+			escape.Replace(result.Media))
+		for _, pub := range result.Publications {
+			fmt.Fprintf(&b, "\n• [%s] %s", escape.Replace(pub.Media),
+				escape.Replace(pub.Publication))
+		}
+		blocks = append(blocks, block{
+			Type: "section",
+			Text: &text{Type: "mrkdwn", Text: truncate(b.String(), slackMaxText)},
+		})
+	}
+	return struct {
+		Text   string  `json:"text"`
+		Blocks []block `json:"blocks"`
+	}{summary, blocks}
+}
+
+// discordPayload returns a Discord message with an embed for each author.
+func discordPayload(summary string, authors []SearchResult) interface{} {
+	type embed struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	content := summary
+	if len(authors) > discordMaxEmbeds {
+		content += fmt.Sprintf(" (showing %d of %d authors)",
+			discordMaxEmbeds, len(authors))
+		authors = authors[:discordMaxEmbeds]
+	}
+	embeds := []embed{}
+	for _, result := range authors {
+		var lines []string
+		for _, pub := range result.Publications {
+			lines = append(lines, fmt.Sprintf("[%s] %s", pub.Media,
+				pub.Publication))
+		}
+		embeds = append(embeds, embed{
+			Title: truncate(fmt.Sprintf("%s (%ss)", result.Author,
+				result.Media), discordMaxTitle),
+			Description: truncate(strings.Join(lines, "\n"), discordMaxText),
+		})
+	}
+	return struct {
+		Content string  `json:"content"`
+		Embeds  []embed `json:"embeds"`
+	}{content, embeds}
+}
+
+// matrixPayload returns a Matrix message listing the titles for each
+// author, in plain text and HTML.
+func matrixPayload(summary string, authors []SearchResult) interface{} {
+	var text, formatted strings.Builder
+	text.WriteString(summary)
+	fmt.Fprintf(&formatted, "<p>%s</p>", html.EscapeString(summary))
+	for _, result := range authors {
+		fmt.Fprintf(&text, "\n\n%s -- %ss:", result.Author, result.Media)
+		fmt.Fprintf(&formatted, "<h4>%s &mdash; %ss</h4><ul>",
+			html.EscapeString(result.Author), html.EscapeString(result.Media))
+		for _, pub := range result.Publications {
+			fmt.Fprintf(&text, "\n  [%s]  %s", pub.Media, pub.Publication)
+			fmt.Fprintf(&formatted, "<li>[%s] %s</li>",
+				html.EscapeString(pub.Media),
+				html.EscapeString(pub.Publication))
+		}
+		formatted.WriteString("</ul>")
+	}
+	return struct {
+		MsgType       string `json:"msgtype"`
+		Body          string `json:"body"`
+		Format        string `json:"format"`
+		FormattedBody string `json:"formatted_body"`
+	}{"m.notice", text.String(), "org.matrix.custom.html", formatted.String()}
+}
+
+// truncate shortens the string to at most max characters, ending it with
+// an ellipsis if shortened.
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
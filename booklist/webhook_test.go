@@ -0,0 +1,179 @@
+// Unit tests related to the webhook notifier. //
+package booklist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a request received by the test webhook server.
+type webhookRequest struct {
+	method, path, auth string
+	body               map[string]interface{}
+}
+
+// webhookServer returns a server recording the requests it receives and
+// replying with the given status codes in turn, then 204 No Content.
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, *[]webhookRequest) {
+	var requests []webhookRequest
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			contents, _ := ioutil.ReadAll(r.Body)
+			request := webhookRequest{
+				method: r.Method,
+				path:   r.URL.Path,
+				auth:   r.Header.Get("Authorization"),
+			}
+			if err := json.Unmarshal(contents, &request.body); err != nil {
+				t.Errorf("Payload isn't JSON: %s.", err)
+			}
+			requests = append(requests, request)
+			if len(statuses) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			status := statuses[0]
+			statuses = statuses[1:]
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "7")
+			}
+			http.Error(w, "failed", status)
+		}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newTestWebhook returns a webhook notifier for the server that records
+// its waits instead of sleeping.
+func newTestWebhook(t *testing.T, config WebhookConfig) (*WebhookNotifier, *[]time.Duration) {
+	notifier, err := NewWebhookNotifier(config)
+	if err != nil {
+		t.Fatalf("Unable to create notifier: %s.", err)
+	}
+	var waits []time.Duration
+	notifier.Sleep = func(d time.Duration) { waits = append(waits, d) }
+	return notifier, &waits
+}
+
+func TestWebhookFormats(t *testing.T) {
+	t.Log("each format posts the expected payload shape.")
+	for _, test := range []struct {
+		format, method, expected string
+	}{
+		{"", "POST", `"title":"Alert"`},
+		{WebhookSlack, "POST", `"text":"*Patterson, James* (Books)\n• [Book] Alert"`},
+		{WebhookDiscord, "POST", `"description":"[Book] Alert","title":"Patterson, James (Books)"`},
+		{WebhookMatrix, "PUT", `"msgtype":"m.notice"`},
+	} {
+		server, requests := webhookServer(t)
+		notifier, _ := newTestWebhook(t, WebhookConfig{
+			Name:    "chat",
+			URL:     server.URL + "/hook",
+			Format:  test.format,
+			OnlyNew: true,
+		})
+		if err := notifier.Notify(NewDigest(currentRun, previousRun)); err != nil {
+			t.Errorf("Notify failed for format '%s': %s.", test.format, err)
+			continue
+		}
+		if len(*requests) != 1 {
+			t.Errorf("Expected 1 request for format '%s'; got %d.",
+				test.format, len(*requests))
+			continue
+		}
+		request := (*requests)[0]
+		payload, _ := json.Marshal(request.body)
+		if request.method != test.method ||
+			!strings.Contains(string(payload), test.expected) {
+			t.Errorf("Expected %s with '%s' for format '%s'; got %s "+
+				"with %s.", test.method, test.expected, test.format,
+				request.method, payload)
+		}
+		if test.format == WebhookMatrix &&
+			!strings.HasPrefix(request.path, "/hook/booklist-") {
+			t.Errorf("Expected a transaction ID in the Matrix URL; got %s.",
+				request.path)
+		}
+		if strings.Contains(string(payload), "King") {
+			t.Errorf("Expected authors without new titles to be left "+
+				"out for format '%s'; got %s.", test.format, payload)
+		}
+	}
+}
+
+func TestWebhookGenericPayload(t *testing.T) {
+	t.Log("the generic payload lists every author's results.")
+	notifier, _ := newTestWebhook(t, WebhookConfig{Name: "hook", URL: "x"})
+	payload, err := notifier.Payload(NewDigest(currentRun, previousRun))
+	if err != nil {
+		t.Fatalf("Payload failed: %s.", err)
+	}
+	var generic WebhookPayload
+	if err := json.Unmarshal(payload, &generic); err != nil {
+		t.Fatalf("Unable to parse payload: %s.", err)
+	}
+	if generic.Count != 3 || len(generic.Authors) != 3 ||
+		!generic.Time.Equal(currentRun.Time) ||
+		generic.Authors[1].Author != "King, Stephen" ||
+		generic.Authors[1].Publications == nil {
+		t.Errorf("Unexpected payload: %s.", payload)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	t.Log("requests are retried after server errors but not client errors.")
+	server, requests := webhookServer(t, 500, 429, 502)
+	notifier, waits := newTestWebhook(t, WebhookConfig{
+		Name:     "hook",
+		URL:      server.URL,
+		TokenEnv: "HOOK_TOKEN",
+	})
+	notifier.Getenv = func(string) string { return "abc" }
+	if err := notifier.Notify(NewDigest(currentRun, nil)); err != nil {
+		t.Fatalf("Notify failed: %s.", err)
+	}
+	expected := []time.Duration{time.Second, 7 * time.Second, 2 * time.Second}
+	if len(*requests) != 4 || len(*waits) != 3 || (*waits)[0] != expected[0] ||
+		(*waits)[1] != expected[1] || (*waits)[2] != expected[2] {
+		t.Errorf("Expected 4 requests after waiting %v; got %d after %v.",
+			expected, len(*requests), *waits)
+	}
+	if (*requests)[0].auth != "Bearer abc" {
+		t.Errorf("Expected bearer token; got '%s'.", (*requests)[0].auth)
+	}
+
+	server, requests = webhookServer(t, 500, 500)
+	retries := 1
+	notifier, _ = newTestWebhook(t, WebhookConfig{
+		Name:    "hook",
+		URL:     server.URL,
+		Retries: &retries,
+	})
+	err := notifier.Notify(NewDigest(currentRun, nil))
+	if err == nil || len(*requests) != 2 {
+		t.Errorf("Expected failure after 2 requests; got %d: %v.",
+			len(*requests), err)
+	}
+
+	server, requests = webhookServer(t, 404)
+	notifier, _ = newTestWebhook(t, WebhookConfig{Name: "hook", URL: server.URL})
+	err = notifier.Notify(NewDigest(currentRun, nil))
+	if err == nil || !strings.Contains(err.Error(), "404") ||
+		len(*requests) != 1 {
+		t.Errorf("Expected failure without retrying; got %d requests: %v.",
+			len(*requests), err)
+	}
+}
+
+func TestWebhookUnknownFormat(t *testing.T) {
+	t.Log("an unknown payload format is an error.")
+	_, err := NewWebhookNotifier(WebhookConfig{Name: "hook", Format: "irc"})
+	if err == nil || !strings.Contains(err.Error(), "unknown format 'irc'") {
+		t.Errorf("Expected unknown format error; got: %v.", err)
+	}
+}
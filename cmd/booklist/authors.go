@@ -0,0 +1,224 @@
+// The 'authors' command and its subcommands; manage the list of authors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// authorsCommand returns the 'authors' command.
+func authorsCommand() *command {
+	return &command{
+		name:     "authors",
+		synopsis: "List or change the authors in a config file",
+		description: `
+List or change the authors in a config file.  The commands that change the
+file preserve its comments and the order of its keys, though the file is
+reformatted.  The changed file is validated before it's written and the
+previous contents are saved to a file with '` + booklist.BackupSuffix + `' appended to its name.
+
+An author is given as 'Lastname, Firstname', e.g., "Grafton, Sue"; case
+is ignored when matching the authors in the file.`,
+		subcommands: []*command{
+			authorsListCommand(),
+			authorsAddCommand(),
+			authorsRemoveCommand(),
+			authorsSetMediaCommand(),
+		},
+	}
+}
+
+// parseAuthorName splits an author given as 'Lastname, Firstname' into
+// the first and last names.
+func parseAuthorName(name string) (firstname, lastname string, err error) {
+	names := strings.SplitN(name, ",", 2)
+	if len(names) == 2 {
+		lastname = strings.TrimSpace(names[0])
+		firstname = strings.TrimSpace(names[1])
+	}
+	if firstname == "" || lastname == "" {
+		return "", "", errUsage(fmt.Sprintf("author '%s' must be given as "+
+			"'Lastname, Firstname'", name))
+	}
+	return firstname, lastname, nil
+}
+
+// editAuthors applies the edit to the config file named by the arguments
+// and writes the result.  Returns the path of the config file.
+func editAuthors(e *env, args []string, edit func(ed *booklist.ConfigEditor) error) (string, error) {
+	out, configFileName, err := applyEdit(e, args, edit)
+	if err != nil {
+		return "", err
+	}
+	return configFileName, booklist.WriteConfig(configFileName, out)
+}
+
+// requireYAML returns an error if the config file isn't YAML.  Only YAML
+// files are edited, as the comments and layout of the other formats can't
+// be preserved.
+func (e *env) requireYAML(configFileName string) error {
+	if format := e.format(configFileName); format != booklist.ConfigYAML {
+		return fmt.Errorf("%s: only YAML config files can be edited, "+
+			"not %s", configFileName, strings.ToUpper(format))
+	}
+	return nil
+}
+
+// applyEdit applies the edit to the config file named by the arguments and
+// returns the validated result, without writing it, and the path of the
+// config file.
+func applyEdit(e *env, args []string, edit func(ed *booklist.ConfigEditor) error) ([]byte, string, error) {
+	configBytes, configFileName, err := e.readConfig(args)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := e.requireYAML(configFileName); err != nil {
+		return nil, "", err
+	}
+	ed, err := booklist.NewConfigEditor(configBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := edit(ed); err != nil {
+		return nil, "", err
+	}
+	out, err := ed.Bytes()
+	return out, configFileName, err
+}
+
+// authorsListCommand returns the 'authors list' command.
+func authorsListCommand() *command {
+	return &command{
+		name:     "list",
+		args:     "[config_file]",
+		synopsis: "List the authors and their media types",
+		run: func(e *env, args []string) error {
+			config, err := e.config(args)
+			if err != nil {
+				return err
+			}
+
+			defaultMedia := config.Media
+			if defaultMedia == "" {
+				defaultMedia = booklist.DefaultMediaType
+			}
+			for _, author := range config.Authors {
+				media := author.Media
+				if media == "" {
+					media = defaultMedia
+				}
+				fmt.Fprintf(e.stdout, "%s, %s -- %s\n",
+					author.Lastname, author.Firstname, media)
+			}
+			return nil
+		},
+	}
+}
+
+// authorsAddCommand returns the 'authors add' command.
+func authorsAddCommand() *command {
+	var media string
+	return &command{
+		name:     "add",
+		args:     "author [config_file]",
+		synopsis: "Add an author to the end of the list",
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&media, "media", "",
+				"Media type for the author; by default, the config "+
+					"file's media type is used")
+		},
+		run: func(e *env, args []string) error {
+			if len(args) == 0 {
+				return errUsage("an author is required")
+			}
+			firstname, lastname, err := parseAuthorName(args[0])
+			if err != nil {
+				return err
+			}
+
+			configFileName, err := editAuthors(e, args[1:],
+				func(ed *booklist.ConfigEditor) error {
+					return ed.AddAuthor(booklist.AuthorInfo{
+						Firstname: firstname,
+						Lastname:  lastname,
+						Media:     media,
+					})
+				})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Added %s, %s to %s\n",
+				lastname, firstname, configFileName)
+			return nil
+		},
+	}
+}
+
+// authorsRemoveCommand returns the 'authors remove' command.
+func authorsRemoveCommand() *command {
+	return &command{
+		name:     "remove",
+		args:     "author [config_file]",
+		synopsis: "Remove an author from the list",
+		run: func(e *env, args []string) error {
+			if len(args) == 0 {
+				return errUsage("an author is required")
+			}
+			firstname, lastname, err := parseAuthorName(args[0])
+			if err != nil {
+				return err
+			}
+
+			configFileName, err := editAuthors(e, args[1:],
+				func(ed *booklist.ConfigEditor) error {
+					return ed.RemoveAuthor(firstname, lastname)
+				})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Removed %s, %s from %s\n",
+				lastname, firstname, configFileName)
+			return nil
+		},
+	}
+}
+
+// authorsSetMediaCommand returns the 'authors set-media' command.
+func authorsSetMediaCommand() *command {
+	return &command{
+		name:     "set-media",
+		args:     "author media_type [config_file]",
+		synopsis: "Set the media type of an author",
+		description: `
+Set the media type searched for the author.  A media type of 'default'
+removes the author's media type so that the config file's media type is
+used.`,
+		run: func(e *env, args []string) error {
+			if len(args) < 2 {
+				return errUsage("an author and media type are required")
+			}
+			firstname, lastname, err := parseAuthorName(args[0])
+			if err != nil {
+				return err
+			}
+			media := args[1]
+			if media == "default" {
+				media = ""
+			}
+
+			configFileName, err := editAuthors(e, args[2:],
+				func(ed *booklist.ConfigEditor) error {
+					return ed.SetAuthorMedia(firstname, lastname, media)
+				})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Set the media type of %s, %s to %s "+
+				"in %s\n", lastname, firstname, args[1], configFileName)
+			return nil
+		},
+	}
+}
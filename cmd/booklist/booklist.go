@@ -4,8 +4,8 @@ Main package for booklist; lists author publications in current year.
 Automates the search of a public library website to retrieve publications
 for a configured list of authors.
 
-Takes a YAML file with the library's catalog URL and list of authors as
-input.  Issues the appropriate requests to that library's website for the
+Takes a YAML, JSON or TOML file with the library's catalog URL and list of
+authors as input.  Issues the appropriate requests to that library's website for the
 latest publications for those authors.  Only works for libraries using
 the CARL.X Integrated Library System (ILS).
 
@@ -27,155 +27,245 @@ the current one.  Media with an unknown publication time period will also
 be returned from a search as they are future releases that might be
 available in the current year.
 
-Usage: booklist [-h] [-d] config_file
-    Search a public library's catalog website for this year's publications
-    from authors listed in the given config file.
+Usage: booklist [-d] [-config config_file] command [flags] [args]
 
-    positional arguments:
-      config_file  Config file containing catalog url and list of authors
-    optional arguments:
-      -h, --help   show this help message and exit
-      -d, --debug  Print debug information to stderr
+    Commands:
+      search      Search the catalog for this year's publications
+      serve       Run the searches on a schedule
+      history     List and compare the recorded runs
+      cache       Show or clear the cache directory
+      validate    Validate a config file
+      authors     List or change the authors in a config file
+      import      Add the authors from a reading list export
+      config      Show the effective configuration or upgrade the file
+      facets      List the media types that can be searched
+      completion  Generate a shell completion script
+      help        Show help for a command
+
+    Global flags, accepted before or after the command:
+      -d             Print debug information to stderr
+      -log-level level
+                     Log level:  error, warn, info, debug or trace
+      -log-format format
+                     Log format:  text or json
+      -log-file file Append the logs to the file instead of stderr
+      -config file   Config file containing catalog url and list of authors
+      -config-format format
+                     Config file format:  yaml, json or toml
+      -catalog-url, -media-type, -authors
+                     Override the config file's keys
+
+    Use 'booklist help command' for the flags and arguments of a command.
+    If no config file is given, $BOOKLIST_CONFIG,
+    $XDG_CONFIG_HOME/booklist/config.yml or ~/.booklist.yml is used.
+    For compatibility, 'booklist [-d] config_file' is the same as
+    'booklist search config_file'.
 */
 package main
 
 import (
 	"flag"
-	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/kbalk/gobooklist/booklist"
-	"github.com/op/go-logging"
 )
 
-// initLogging initializes the format and debug level for the stderr logging.
-func initLogging(log *logging.Logger, debug bool) {
-	stderrLog := logging.NewLogBackend(os.Stderr, "", 0)
-
-	format := logging.MustStringFormatter(
-		`%{time:15:04:05} %{level:.5s} %{message}`)
-	logFormatter := logging.NewBackendFormatter(stderrLog, format)
-
-	logLevel := logging.AddModuleLevel(logFormatter)
-	level := logging.ERROR
-	if debug {
-		level = logging.DEBUG
-	}
-	logLevel.SetLevel(level, "")
+// globalFlags adds the flags shared by all commands to the flag set.
+func globalFlags(e *env, fs *flag.FlagSet) {
+	fs.BoolVar(&e.debug, "d", e.debug, "Print debug information to stderr")
+	fs.StringVar(&e.logLevel, "log-level", e.logLevel, logLevelUsage)
+	fs.StringVar(&e.logFormat, "log-format", e.logFormat,
+		"Log `format`, one of "+strings.Join(booklist.LogFormats, ", "))
+	fs.StringVar(&e.logFile, "log-file", e.logFile,
+		"Append the logs to the given `file` instead of writing them "+
+			"to stderr")
+	fs.StringVar(&e.configFile, "config", e.configFile,
+		"YAML, JSON or TOML file containing library's catalog url and "+
+			"list of authors")
+	fs.Var(formatFlag{e}, "config-format",
+		"Config file `format`, one of "+
+			strings.Join(booklist.ConfigFormats, ", ")+
+			" (default is from the file's extension)")
+	fs.Var(overrideFlag{e, "catalog-url"}, "catalog-url",
+		"Library's catalog `url`; overrides the config file and $"+
+			booklist.ConfigEnvVars["catalog-url"])
+	fs.Var(overrideFlag{e, "media-type"}, "media-type",
+		"Default `media` type; overrides the config file and $"+
+			booklist.ConfigEnvVars["media-type"])
+	fs.Var(overrideFlag{e, "authors"}, "authors",
+		"Authors to search for, as 'Lastname, Firstname[: media]' "+
+			"separated by semicolons; overrides the config file and $"+
+			booklist.ConfigEnvVars["authors"])
+}
 
-	log.SetBackend(logLevel)
+// overrideFlag is a flag that overrides a config key.
+type overrideFlag struct {
+	e   *env
+	key string
 }
 
-// Retrieve and print the author publications for current year.
-func printSearchResults(config booklist.Config, log *logging.Logger) error {
-	// The default type is the value specified in the config file or
-	// if not found, the standard default type.
-	defaultMedia := booklist.DefaultMediaType
-	if config.Media == "" {
-		defaultMedia = config.Media
-	}
+func (f overrideFlag) String() string {
+	return ""
+}
 
-	for _, authorInfo := range config.Authors {
-		authorName := fmt.Sprintf("%s, %s",
-			authorInfo.Lastname, authorInfo.Firstname)
-
-		media := defaultMedia
-		if authorInfo.Media != "" {
-			media = authorInfo.Media
-		}
-
-		fmt.Printf("%s -- %ss:\n", authorName, media)
-		c := booklist.CatalogInfo{
-			URL:    config.URL,
-			Author: authorName,
-			Media:  media,
-			Year:   booklist.CurrentYear,
-			Log:    log,
-		}
-		results, err := c.PublicationSearch()
-		if err != nil {
-			return err
-		}
-		if results == nil {
-			continue
-		}
-
-		// Print the search results; each entry in the results list
-		// is a tuple containing the media type and publication name
-		// (e.g., book title).  Since some media types are supersets
-		// of other media types, it seemed useful to provide that
-		// extra information.
-		maxWidth := 0
-		for _, info := range results {
-			l := len(info.Media)
-			if l > maxWidth {
-				maxWidth = l
-			}
-		}
-		for _, pubInfo := range results {
-			fmt.Printf("  [%-*s]  %s\n",
-				maxWidth, pubInfo.Media, pubInfo.Publication)
-		}
-	}
+func (f overrideFlag) Set(value string) error {
+	f.e.override(f.key, value, f.key)
 	return nil
 }
 
-// main processes command line args then retrieve search results from library.
-func main() {
-	flag.Usage = func() {
-		usageText := `Usage: go_booklist: [-h] [-d] config_file
+// formatFlag is the flag giving the config file's format.
+type formatFlag struct {
+	e *env
+}
 
-  Search a public library's catalog website for this year's publications
-  from authors listed in the given config file.
+func (f formatFlag) String() string {
+	return ""
+}
 
-  config_file    YAML-formatted file containing library's catalog url and
-                 list of authors
+func (f formatFlag) Set(value string) error {
+	format, err := booklist.ParseConfigFormat(value)
+	f.e.configFormat = format
+	return err
+}
 
-  Optional arguments:
+// override adds an override of the config key by the named flag.
+func (e *env) override(key, value, flagName string) {
+	e.overrides = append(e.overrides, booklist.Override{
+		Key:   key,
+		Value: value,
+		Origin: booklist.Origin{
+			Source: booklist.SourceFlag,
+			Name:   flagName,
+		},
+	})
+}
 
-  -h    Show this help message and exit`
-		fmt.Fprintln(os.Stderr, usageText)
-		flag.PrintDefaults()
+// configFileName returns the config file named by the first argument or,
+// if there are no arguments, by the -config flag.  Returns an empty string
+// if neither is given, in which case the config file is found in the
+// default locations.
+func (e *env) configFileName(args []string) (string, error) {
+	switch {
+	case len(args) > 1:
+		return "", errUsage("only one config file may be given")
+	case len(args) == 1:
+		return args[0], nil
 	}
-	var debugFlag = flag.Bool("d", false,
-		"Print debug information to stderr")
-	flag.Parse()
-
-	// Verify that only one argument is supplied, that argument being
-	// the configuration file.
-	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr,
-			"ERROR:  config filename is required argument.\n\n")
-		flag.Usage()
-		os.Exit(1)
+	return e.configFile, nil
+}
+
+// format returns the format of the config file:  the one given with
+// -config-format, or else the one detected from the file's name.
+func (e *env) format(path string) string {
+	if e.configFormat != "" {
+		return e.configFormat
 	}
-	configFileName := flag.Arg(0)
+	return booklist.DetectConfigFormat(path)
+}
 
-	// Initialize logging for error and/or debug messages to stderr.
-	var log = logging.MustGetLogger("booklist")
-	initLogging(log, *debugFlag)
+// readConfig reads the config file named by the arguments and returns its
+// contents and path.
+func (e *env) readConfig(args []string) ([]byte, string, error) {
+	configFileName, err := e.configFileName(args)
+	if err != nil {
+		return nil, "", err
+	}
 
 	// Verify the config exists and is readable, then read the contents.
-	configBytes, ok := booklist.ReadConfig(configFileName)
-	if ok != nil {
-		log.Error(ok)
-		os.Exit(1)
+	configBytes, path, err := booklist.ReadConfig(configFileName)
+	if err != nil {
+		return nil, path, err
+	}
+	e.log.Debugf("Using config file %s", path)
+	return configBytes, path, nil
+}
+
+// loadConfig merges the config file named by the arguments with the
+// environment variables and flags that override it.
+func (e *env) loadConfig(args []string) (*booklist.LoadedConfig, error) {
+	configFileName, err := e.configFileName(args)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := append(booklist.EnvOverrides(os.Getenv), e.overrides...)
+	loaded, err := booklist.LoadConfigFormat(configFileName, e.configFormat,
+		overrides)
+	if err != nil {
+		return nil, err
+	}
+	if loaded.Path != "" {
+		e.log.Debugf("Using config file %s", loaded.Path)
+	}
+	return loaded, nil
+}
+
+// config reads and validates the config file named by the arguments and
+// applies the overrides.
+func (e *env) config(args []string) (booklist.Config, error) {
+	loaded, err := e.loadConfig(args)
+	if err != nil {
+		return booklist.Config{}, err
 	}
+	e.log.Debug(loaded.Config)
+	return loaded.Config, nil
+}
+
+// rootCommand returns the top level command containing all the others.
+func rootCommand() *command {
+	root := &command{
+		name:     "booklist",
+		synopsis: "Lists author publications in current year",
+		description: `
+Search a public library's catalog website for this year's publications
+from a configured list of authors.
 
-	// Validate the config file contents and retrieve the parsed results.
-	config, ok := booklist.ValidateConfig(configBytes)
-	if ok != nil {
-		log.Error(ok)
-		os.Exit(1)
+The commands that read a config file take its name as an argument or from
+-config.  Otherwise, the first of the following that is set or exists is
+used:  the file named by $` + booklist.ConfigEnv + `,
+$XDG_CONFIG_HOME/booklist/config.yml and ~/.booklist.yml.
+
+The catalog-url, media-type and authors keys can be overridden by an
+environment variable, e.g., $BOOKLIST_URL for catalog-url, and by a global
+flag, e.g., -catalog-url; the notify key can only be set in the config
+file.  A config file isn't needed if catalog-url and authors are set this
+way.
+Use 'booklist config show' to see the effective configuration.`,
+		subcommands: []*command{
+			searchCommand(),
+			serveCommand(),
+			historyCommand(),
+			cacheCommand(),
+			validateCommand(),
+			authorsCommand(),
+			importCommand(),
+			configCommand(),
+			facetsCommand(),
+			completionCommand(),
+		},
 	}
-	log.Debug(config)
+	root.subcommands = append(root.subcommands, helpCommand(root))
+	return root
+}
 
-	// Retrieve the publications for the authors in the configuration file
-	// and print the results.
-	if err := printSearchResults(config, log); err != nil {
-		log.Error(err)
-		os.Exit(1)
+// newEnv returns the environment of the commands, writing to stdout and
+// stderr, with its root command.
+func newEnv(stdout, stderr io.Writer) *env {
+	e := &env{
+		log:       newLogger(stderr),
+		logLevel:  booklist.LevelWarn.String(),
+		logFormat: booklist.LogText,
+		stdout:    stdout,
+		stderr:    stderr,
 	}
+	e.root = rootCommand().init(nil, e)
+	return e
+}
 
-	os.Exit(0)
+// main processes command line args then runs the requested command.
+func main() {
+	e := newEnv(os.Stdout, os.Stderr)
+	os.Exit(exitStatus(e, e.root.execute(e, os.Args[1:])))
 }
@@ -0,0 +1,98 @@
+// The 'cache' command and its subcommands; show or clear the cache files.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// cacheCommand returns the 'cache' command.
+func cacheCommand() *command {
+	return &command{
+		name:     "cache",
+		synopsis: "Show or clear the cache directory",
+		description: `
+Show or clear booklist's cache directory, $XDG_CACHE_HOME/booklist, where
+XDG_CACHE_HOME defaults to ~/.cache.  It holds the catalog's responses
+cached by 'search -cache'.  The files in it can be deleted at any time;
+unlike the state directory, it holds nothing that's needed to tell which
+titles are new.`,
+		subcommands: []*command{
+			cacheShowCommand(),
+			cacheClearCommand(),
+		},
+	}
+}
+
+// cacheShowCommand returns the 'cache show' command.
+func cacheShowCommand() *command {
+	return &command{
+		name:     "show",
+		synopsis: "Show the cache directory and its size",
+		run: func(e *env, args []string) error {
+			if len(args) != 0 {
+				return errUsage("unexpected arguments")
+			}
+			dir, err := booklist.CacheDir()
+			if err != nil {
+				return err
+			}
+			files, size, err := dirUsage(dir)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "%s:  %d files, %d bytes\n", dir, files,
+				size)
+			return nil
+		},
+	}
+}
+
+// cacheClearCommand returns the 'cache clear' command.
+func cacheClearCommand() *command {
+	return &command{
+		name:     "clear",
+		synopsis: "Delete the files in the cache directory",
+		run: func(e *env, args []string) error {
+			if len(args) != 0 {
+				return errUsage("unexpected arguments")
+			}
+			dir, err := booklist.CacheDir()
+			if err != nil {
+				return err
+			}
+			files, _, err := dirUsage(dir)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("unable to clear the cache:  %s", err)
+			}
+			fmt.Fprintf(e.stdout, "Deleted %d files from %s\n", files, dir)
+			return nil
+		},
+	}
+}
+
+// dirUsage returns the number of files in the directory, including those
+// in its subdirectories, and their total size.  A directory that doesn't
+// exist is empty.
+func dirUsage(dir string) (files int, size int64, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size, err
+}
@@ -0,0 +1,50 @@
+// Unit tests related to the 'cache' command. //
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheCommand(t *testing.T) {
+	t.Log("the cache directory's files are counted and deleted.")
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := filepath.Join(os.Getenv("XDG_CACHE_HOME"), "booklist")
+	responses := filepath.Join(dir, "responses")
+	if err := os.MkdirAll(responses, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.json", "b.json"} {
+		err := ioutil.WriteFile(filepath.Join(responses, name),
+			[]byte("{}\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"cache", "show"}, dir + ":  2 files, 6 bytes\n"},
+		{[]string{"cache", "clear"}, "Deleted 2 files from " + dir + "\n"},
+		{[]string{"cache", "show"}, dir + ":  0 files, 0 bytes\n"},
+		{[]string{"cache", "clear"}, "Deleted 0 files from " + dir + "\n"},
+	} {
+		_, stdout, stderr, status := runCommand(t, tc.args...)
+		if status != 0 || stdout != tc.expected {
+			t.Errorf("Expected %v to print %q; got %q, %q (status %d).",
+				tc.args, tc.expected, stdout, stderr, status)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the cache directory to be deleted; got %v.", err)
+	}
+	if _, _, stderr, status := runCommand(t, "cache", "show", "extra"); status != 1 ||
+		!strings.Contains(stderr, "unexpected arguments") {
+		t.Errorf("Expected unexpected arguments; got %q.", stderr)
+	}
+}
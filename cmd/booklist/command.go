@@ -0,0 +1,314 @@
+// Subcommand handling for booklist.
+//
+// Each command has its own flag set and help text.  A command either runs
+// itself or, like 'authors', dispatches to one of its subcommands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// env is the state shared by all commands; it's set from the global flags.
+type env struct {
+	root       *command
+	log        logger
+	debug      bool
+	configFile string
+
+	// logLevel, logFormat and logFile are the level, format and file of
+	// the logs, from the global flags; the logs are written to stderr if
+	// logFile is empty.
+	logLevel  string
+	logFormat string
+	logFile   string
+
+	// logOutput is the open log file; nil if the logs are written to
+	// stderr.
+	logOutput *logFile
+
+	// configFormat is the format given with -config-format; if empty,
+	// the format is detected from the config file's name.
+	configFormat string
+	overrides    []booklist.Override
+	stdout       io.Writer
+	stderr       io.Writer
+}
+
+// command is a booklist command such as 'search' or 'authors list'.
+type command struct {
+	// name is the name used on the command line.
+	name string
+
+	// args describes the positional arguments, for the usage line.
+	args string
+
+	// synopsis is a one line description shown in command lists.
+	synopsis string
+
+	// description is the longer description shown in the command's help.
+	description string
+
+	// setFlags adds the command's flags to the flag set; may be nil.
+	setFlags func(fs *flag.FlagSet)
+
+	// run executes the command with the positional arguments remaining
+	// after the flags are parsed; nil for commands with subcommands.
+	run func(e *env, args []string) error
+
+	// subcommands are the commands nested within this command.
+	subcommands []*command
+
+	parent *command
+	flags  *flag.FlagSet
+	global map[string]bool
+}
+
+// errUsage is returned by a command when it's given incorrect arguments;
+// the command's usage is printed.
+type errUsage string
+
+func (e errUsage) Error() string {
+	return string(e)
+}
+
+// path returns the full name of the command, e.g., 'booklist authors list'.
+func (c *command) path() string {
+	if c.parent == nil {
+		return c.name
+	}
+	return c.parent.path() + " " + c.name
+}
+
+// init creates the flag sets of the command and its subcommands.  Each
+// flag set includes the global flags, which set the fields of e.
+func (c *command) init(parent *command, e *env) *command {
+	c.parent = parent
+	c.flags = flag.NewFlagSet(c.path(), flag.ContinueOnError)
+	c.flags.SetOutput(io.Discard)
+	if c.setFlags != nil {
+		c.setFlags(c.flags)
+	}
+
+	own := make(map[string]bool)
+	c.flags.VisitAll(func(f *flag.Flag) { own[f.Name] = true })
+	globalFlags(e, c.flags)
+	c.global = make(map[string]bool)
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if !own[f.Name] {
+			c.global[f.Name] = true
+		}
+	})
+
+	for _, sub := range c.subcommands {
+		sub.init(c, e)
+	}
+	return c
+}
+
+// lookup returns the named subcommand or nil if there is no such command.
+func (c *command) lookup(name string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// usage writes the help text for the command.
+func (c *command) usage(w io.Writer) {
+	line := "Usage: " + c.path()
+	if c.parent == nil {
+		line += " [global flags]"
+	}
+	if c.hasFlags() {
+		line += " [flags]"
+	}
+	if len(c.subcommands) != 0 {
+		line += " command"
+	}
+	if c.args != "" {
+		line += " " + c.args
+	}
+	fmt.Fprintf(w, "%s\n\n", line)
+
+	description := c.description
+	if description == "" {
+		description = c.synopsis
+	}
+	fmt.Fprintf(w, "  %s\n", strings.Replace(
+		strings.TrimSpace(description), "\n", "\n  ", -1))
+
+	if len(c.subcommands) != 0 {
+		fmt.Fprintf(w, "\nCommands:\n\n")
+		for _, sub := range c.subcommands {
+			fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.synopsis)
+		}
+	}
+
+	if c.hasFlags() {
+		fmt.Fprintf(w, "\nFlags:\n\n")
+		c.printFlags(w, false)
+	}
+
+	if c.parent == nil {
+		fmt.Fprintf(w, "\nGlobal flags, accepted before or after the "+
+			"command:\n\n")
+		c.printFlags(w, true)
+	} else {
+		fmt.Fprintf(w, "\nUse '%s help' for the global flags.\n",
+			rootPath(c))
+	}
+
+	if len(c.subcommands) != 0 {
+		fmt.Fprintf(w, "\nUse '%s help command' for more information "+
+			"about a command.\n", rootPath(c))
+	}
+}
+
+// printFlags writes the defaults of either the command's own flags or of
+// the global flags.
+func (c *command) printFlags(w io.Writer, global bool) {
+	fs := flag.NewFlagSet(c.path(), flag.ContinueOnError)
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if c.global[f.Name] == global {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// hasFlags returns whether the command has any flags besides the global
+// flags.
+func (c *command) hasFlags() bool {
+	found := false
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if !c.global[f.Name] {
+			found = true
+		}
+	})
+	return found
+}
+
+// flagNames returns the command's flag names, sorted, with a leading dash.
+func (c *command) flagNames() []string {
+	var names []string
+	c.flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+// rootPath returns the name of the top level command.
+func rootPath(c *command) string {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c.name
+}
+
+// execute parses the command's flags and runs it, or the subcommand
+// named by the first argument.
+func (c *command) execute(e *env, args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			c.usage(e.stdout)
+			return nil
+		}
+		return c.usageError(e, err.Error())
+	}
+	args = c.flags.Args()
+
+	if c.run != nil {
+		err := initLogging(e)
+		if err == nil {
+			err = c.run(e, args)
+		}
+		if usageErr, ok := err.(errUsage); ok {
+			return c.usageError(e, string(usageErr))
+		}
+		return err
+	}
+
+	if len(args) == 0 {
+		return c.usageError(e, "a command is required")
+	}
+	sub := c.lookup(args[0])
+	if sub == nil && c.parent == nil {
+		// For compatibility, a config file without a command is a
+		// search.
+		if _, err := os.Stat(args[0]); err == nil {
+			return c.lookup("search").execute(e, args)
+		}
+	}
+	if sub == nil {
+		return c.usageError(e, fmt.Sprintf("unknown command '%s'", args[0]))
+	}
+	return sub.execute(e, args[1:])
+}
+
+// usageError reports the problem with the command line followed by the
+// command's usage, and returns an errUsage.
+func (c *command) usageError(e *env, msg string) error {
+	fmt.Fprintf(e.stderr, "ERROR:  %s\n\n", msg)
+	c.usage(e.stderr)
+	return errUsage(msg)
+}
+
+// helpCommand returns the 'help' command for the given root command.
+func helpCommand(root *command) *command {
+	return &command{
+		name:     "help",
+		args:     "[command ...]",
+		synopsis: "Show help for a command",
+		run: func(e *env, args []string) error {
+			c := root
+			for _, name := range args {
+				sub := c.lookup(name)
+				if sub == nil {
+					return errUsage(fmt.Sprintf("unknown command '%s'",
+						strings.Join(args, " ")))
+				}
+				c = sub
+			}
+			c.usage(e.stdout)
+			return nil
+		},
+	}
+}
+
+// exitCode is returned by a command that has already reported its
+// problem and only needs booklist to exit with the given status.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// exitStatus reports the error returned by a command, unless it has
+// already been reported, and returns the status booklist should exit with.
+func exitStatus(e *env, err error) int {
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case exitCode:
+		return int(err)
+	case errUsage:
+		return 1
+	}
+
+	e.log.Error(err)
+	if hint := searchErrorHint(err); hint != "" {
+		fmt.Fprintf(e.stderr, "Hint:  %s\n", hint)
+	}
+	return 1
+}
@@ -0,0 +1,164 @@
+// Unit tests related to the commands and their flags. //
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+// runCommand runs booklist with the arguments, returning its environment,
+// its output to stdout and stderr and its exit status.
+func runCommand(t *testing.T, args ...string) (*env, string, string, int) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	e := newEnv(&stdout, &stderr)
+	status := exitStatus(e, e.root.execute(e, args))
+	return e, stdout.String(), stderr.String(), status
+}
+
+func TestGlobalFlagsParsedOnce(t *testing.T) {
+	t.Log("a global flag before the command is applied once.")
+	e, _, _, status := runCommand(t, "-authors", "Grafton, Sue",
+		"-catalog-url", "https://catalog.example.org/", "help")
+	if status != 0 || len(e.overrides) != 2 {
+		t.Errorf("Expected 2 overrides; got %+v (status %d).", e.overrides,
+			status)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	t.Log("the command and subcommand named are run.")
+	_, stdout, _, status := runCommand(t, "facets")
+	if status != 0 || !strings.Contains(stdout, "ebook") {
+		t.Errorf("Expected the media types; got %q (status %d).", stdout,
+			status)
+	}
+
+	t.Log("a missing or unknown command is reported with the usage.")
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "ERROR:  a command is required"},
+		{[]string{"nonesuch"}, "ERROR:  unknown command 'nonesuch'"},
+		{[]string{"authors"}, "Usage: booklist authors command"},
+		{[]string{"authors", "nonesuch"}, "unknown command 'nonesuch'"},
+		{[]string{"facets", "-nonesuch"}, "flag provided but not defined"},
+		{[]string{"facets", "extra"}, "facets takes no arguments"},
+	} {
+		_, _, stderr, status := runCommand(t, tc.args...)
+		if status != 1 || !strings.Contains(stderr, tc.expected) {
+			t.Errorf("Expected %v to fail with %q; got %q (status %d).",
+				tc.args, tc.expected, stderr, status)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	t.Log("help shows the commands, or a command's flags and arguments.")
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"help"}, []string{"Usage: booklist [global flags]",
+			"  search       Search the catalog", "-log-level"}},
+		{[]string{"help", "search"}, []string{
+			"Usage: booklist search [flags] [config_file]", "-author",
+			"Use 'booklist help' for the global flags."}},
+		{[]string{"help", "authors", "add"}, []string{
+			"Usage: booklist authors add"}},
+		{[]string{"search", "-h"}, []string{
+			"Usage: booklist search [flags] [config_file]"}},
+	} {
+		_, stdout, _, status := runCommand(t, tc.args...)
+		for _, expected := range tc.expected {
+			if status != 0 || !strings.Contains(stdout, expected) {
+				t.Errorf("Expected %v to show %q; got %q (status %d).",
+					tc.args, expected, stdout, status)
+			}
+		}
+	}
+	if _, _, stderr, status := runCommand(t, "help", "nonesuch"); status != 1 ||
+		!strings.Contains(stderr, "unknown command 'nonesuch'") {
+		t.Errorf("Expected an unknown command; got %q (status %d).", stderr,
+			status)
+	}
+}
+
+func TestGlobalFlags(t *testing.T) {
+	t.Log("global flags are accepted before or after the command.")
+	for _, args := range [][]string{
+		{"-log-level", "debug", "-config", "a.yml", "facets"},
+		{"facets", "-log-level", "debug", "-config", "a.yml"},
+		{"-log-level", "debug", "authors", "-config", "a.yml", "nonesuch"},
+	} {
+		e, _, _, _ := runCommand(t, args...)
+		if e.logLevel != "debug" || e.configFile != "a.yml" {
+			t.Errorf("Expected the global flags from %v; got %s and %s.",
+				args, e.logLevel, e.configFile)
+		}
+	}
+}
+
+func TestLegacySearch(t *testing.T) {
+	t.Log("a config file without a command is searched.")
+	catalog := booklisttest.NewServer(booklisttest.Publication{
+		Author: "Grafton, Sue", Title: "X", Format: "Book",
+		Year: booklist.ThisYear()})
+	defer catalog.Close()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	writeTestConfig(t, configFile, catalog.URL, "Grafton, Sue")
+
+	for _, args := range [][]string{
+		{configFile},
+		{"-d", configFile},
+	} {
+		_, stdout, stderr, status := runCommand(t, args...)
+		if status != 0 || !strings.Contains(stdout, "Grafton, Sue -- Books:\n  [Book]  X") {
+			t.Errorf("Expected %v to search; got %q, %q (status %d).",
+				args, stdout, stderr, status)
+		}
+	}
+	if _, _, stderr, status := runCommand(t, configFile+".missing"); status != 1 ||
+		!strings.Contains(stderr, "unknown command") {
+		t.Errorf("Expected a missing file to be an unknown command; got %q.",
+			stderr)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	t.Log("completion scripts complete the commands and flags.")
+	for _, tc := range []struct {
+		shell    string
+		expected []string
+	}{
+		{"bash", []string{"complete -o filenames -F _booklist booklist",
+			`"authors list") words=`, `"search") words="`, "-author "}},
+		{"zsh", []string{"autoload -U +X bashcompinit && bashcompinit",
+			"complete -o filenames -F _booklist booklist"}},
+		{"fish", []string{
+			"complete -c booklist -f -n '__fish_use_subcommand' -a search",
+			"complete -c booklist -f -n '__fish_seen_subcommand_from " +
+				"authors' -a list",
+			"complete -c booklist -n '__fish_seen_subcommand_from " +
+				"search' -o author",
+			"complete -c booklist -o log-level"}},
+	} {
+		_, stdout, _, status := runCommand(t, "completion", tc.shell)
+		for _, expected := range tc.expected {
+			if status != 0 || !strings.Contains(stdout, expected) {
+				t.Errorf("Expected the %s script to contain %q; got:\n%s",
+					tc.shell, expected, stdout)
+			}
+		}
+	}
+	if _, _, stderr, status := runCommand(t, "completion", "tcsh"); status != 1 ||
+		!strings.Contains(stderr, "unsupported shell 'tcsh'") {
+		t.Errorf("Expected an unsupported shell; got %q.", stderr)
+	}
+}
@@ -0,0 +1,145 @@
+// The 'completion' command; generates shell completion scripts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// completionCommand returns the 'completion' command.
+func completionCommand() *command {
+	return &command{
+		name:     "completion",
+		args:     "bash|zsh|fish",
+		synopsis: "Generate a shell completion script",
+		description: `
+Write a script to stdout that completes booklist's commands and flags in
+the given shell.  For example, add one of the following to the shell's
+startup file:
+
+    source <(booklist completion bash)
+    source <(booklist completion zsh)
+    booklist completion fish | source`,
+		run: func(e *env, args []string) error {
+			if len(args) != 1 {
+				return errUsage("a shell name is required")
+			}
+
+			root := e.root
+			switch args[0] {
+			case "bash":
+				writeBashCompletion(e.stdout, root)
+			case "zsh":
+				fmt.Fprintln(e.stdout, "autoload -U +X bashcompinit && bashcompinit")
+				writeBashCompletion(e.stdout, root)
+			case "fish":
+				writeFishCompletion(e.stdout, root)
+			default:
+				return errUsage(fmt.Sprintf("unsupported shell '%s'", args[0]))
+			}
+			return nil
+		},
+	}
+}
+
+// commandPaths returns the commands nested within c keyed by their path
+// relative to c, e.g., 'authors list'; c itself has an empty path.
+func commandPaths(c *command) map[string]*command {
+	paths := map[string]*command{"": c}
+	var walk func(prefix string, c *command)
+	walk = func(prefix string, c *command) {
+		for _, sub := range c.subcommands {
+			path := strings.TrimSpace(prefix + " " + sub.name)
+			paths[path] = sub
+			walk(path, sub)
+		}
+	}
+	walk("", c)
+	return paths
+}
+
+// sortedPaths returns the keys of the map returned by commandPaths, sorted.
+func sortedPaths(paths map[string]*command) []string {
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// writeBashCompletion writes a bash completion script for the command.
+func writeBashCompletion(w io.Writer, root *command) {
+	paths := commandPaths(root)
+	sorted := sortedPaths(paths)
+
+	var quoted []string
+	for _, path := range sorted[1:] {
+		quoted = append(quoted, fmt.Sprintf("%q", path))
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s\n", root.name)
+	fmt.Fprintf(w, "_%s() {\n", root.name)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" path=\"\" word i\n")
+	fmt.Fprintf(w, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(w, "        word=\"${path:+$path }${COMP_WORDS[i]}\"\n")
+	fmt.Fprintf(w, "        case \"$word\" in\n")
+	fmt.Fprintf(w, "            %s) path=\"$word\" ;;\n", strings.Join(quoted, "|"))
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    done\n\n")
+	fmt.Fprintf(w, "    local words\n")
+	fmt.Fprintf(w, "    case \"$path\" in\n")
+	for _, path := range sorted {
+		c := paths[path]
+		var words []string
+		for _, sub := range c.subcommands {
+			words = append(words, sub.name)
+		}
+		words = append(words, c.flagNames()...)
+		fmt.Fprintf(w, "        %q) words=%q ;;\n", path, strings.Join(words, " "))
+	}
+	fmt.Fprintf(w, "    esac\n\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    if [[ ${#COMPREPLY[@]} -eq 0 && $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _%s %s\n", root.name, root.name)
+}
+
+// writeFishCompletion writes a fish completion script for the command.
+func writeFishCompletion(w io.Writer, root *command) {
+	paths := commandPaths(root)
+
+	fmt.Fprintf(w, "# fish completion for %s\n", root.name)
+	for _, path := range sortedPaths(paths) {
+		c := paths[path]
+
+		// The condition under which the command's own subcommands and
+		// flags are completed.
+		condition := "__fish_use_subcommand"
+		if path != "" {
+			condition = "__fish_seen_subcommand_from " + c.name
+		}
+
+		for _, sub := range c.subcommands {
+			fmt.Fprintf(w, "complete -c %s -f -n '%s' -a %s -d %q\n",
+				root.name, condition, sub.name, sub.synopsis)
+		}
+		if path == "" {
+			condition = ""
+		} else {
+			condition = " -n '" + condition + "'"
+		}
+		c.flags.VisitAll(func(f *flag.Flag) {
+			if path != "" && c.global[f.Name] {
+				return
+			}
+			fmt.Fprintf(w, "complete -c %s%s -o %s -d %q\n",
+				root.name, condition, f.Name, f.Usage)
+		})
+	}
+}
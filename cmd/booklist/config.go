@@ -0,0 +1,178 @@
+// The 'config' command and its subcommands; inspect the configuration.
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"gopkg.in/yaml.v3"
+)
+
+// configCommand returns the 'config' command.
+func configCommand() *command {
+	return &command{
+		name:     "config",
+		synopsis: "Show the effective configuration or upgrade the file",
+		subcommands: []*command{
+			configShowCommand(),
+			configMigrateCommand(),
+		},
+	}
+}
+
+// configShowCommand returns the 'config show' command.
+func configShowCommand() *command {
+	return &command{
+		name:     "show",
+		args:     "[config_file]",
+		synopsis: "Show the configuration and where each value came from",
+		description: `
+Show the configuration used by the other commands, after the config file
+is merged with the defaults, environment variables and flags.  The output
+is YAML; the comment following each key tells where its value came from:
+'default', the config file and line, an environment variable such as
+$BOOKLIST_URL or a flag such as -catalog-url.
+
+Only catalog-url, media-type and authors can be set by an environment
+variable or flag.  The notify key can only be set in the config file, so
+its origin is always a file; the version key only describes the file's
+format and isn't shown.`,
+		run: func(e *env, args []string) error {
+			loaded, err := e.loadConfig(args)
+			if err != nil {
+				return err
+			}
+
+			if loaded.Path != "" {
+				fmt.Fprintf(e.stdout, "# Config file: %s\n", loaded.Path)
+			} else {
+				fmt.Fprintf(e.stdout, "# No config file\n")
+			}
+			out, err := yaml.Marshal(originNodes(loaded))
+			if err != nil {
+				return err
+			}
+			_, err = e.stdout.Write(out)
+			return err
+		},
+	}
+}
+
+// originNodes returns the YAML for the configuration with the origin of
+// each key as a comment.
+func originNodes(loaded *booklist.LoadedConfig) *yaml.Node {
+	scalar := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+
+	top := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range booklist.ConfigKeys {
+		origin, ok := loaded.Origins[key]
+		if !ok {
+			continue
+		}
+
+		var value *yaml.Node
+		switch key {
+		case "catalog-url":
+			value = scalar(loaded.URL)
+		case "media-type":
+			value = scalar(loaded.Media)
+		case "authors":
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for i, author := range loaded.Authors {
+				entry := &yaml.Node{Kind: yaml.MappingNode}
+				firstname := scalar("firstname")
+
+				// Authors from included files are marked with their file.
+				authorOrigin := loaded.AuthorOrigin(i)
+				if authorOrigin.Name != origin.Name {
+					firstname.LineComment = authorOrigin.String()
+				}
+				entry.Content = append(entry.Content,
+					firstname, scalar(author.Firstname),
+					scalar("lastname"), scalar(author.Lastname))
+				if author.Media != "" {
+					entry.Content = append(entry.Content,
+						scalar("media-type"), scalar(author.Media))
+				}
+				value.Content = append(value.Content, entry)
+			}
+		}
+
+		keyNode := scalar(key)
+		keyNode.LineComment = origin.String()
+		top.Content = append(top.Content, keyNode, value)
+	}
+
+	if origin, ok := loaded.Origins["notify"]; ok && loaded.Notify != nil {
+		value := new(yaml.Node)
+		if err := value.Encode(loaded.Notify); err == nil {
+			keyNode := scalar("notify")
+			keyNode.LineComment = origin.String()
+			top.Content = append(top.Content, keyNode, value)
+		}
+	}
+	return top
+}
+
+// configMigrateCommand returns the 'config migrate' command.
+func configMigrateCommand() *command {
+	var dryRun bool
+	return &command{
+		name:     "migrate",
+		args:     "[config_file]",
+		synopsis: "Upgrade the config file to the current version",
+		description: fmt.Sprintf(`
+Upgrade the config file, in place, to version %d of the config file format.
+A file without a 'version' key is version 1.  The changes are shown as a
+diff before the file is written; the comments in the file are kept, but
+the file is reformatted.  The previous contents are kept in a copy of the
+file with '%s' appended to its name.  Only YAML files can be upgraded.
+
+The files included by the config file aren't upgraded; upgrade each one
+separately.`, booklist.ConfigVersion, booklist.BackupSuffix),
+		setFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&dryRun, "dry-run", false,
+				"Show the changes without writing the config file")
+		},
+		run: func(e *env, args []string) error {
+			configBytes, configFileName, err := e.readConfig(args)
+			if err != nil {
+				return err
+			}
+			if err := e.requireYAML(configFileName); err != nil {
+				return err
+			}
+
+			out, from, err := booklist.MigrateConfig(configBytes)
+			if err != nil {
+				return fmt.Errorf("%s: %w", configFileName, err)
+			}
+			if from == booklist.ConfigVersion {
+				fmt.Fprintf(e.stdout, "%s is already at version %d\n",
+					configFileName, from)
+				return nil
+			}
+
+			err = writeDiff(e.stdout, configFileName,
+				configFileName+" (version "+fmt.Sprint(booklist.ConfigVersion)+")",
+				configBytes, out)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintf(e.stdout, "Would upgrade %s from version %d "+
+					"to %d\n", configFileName, from, booklist.ConfigVersion)
+				return nil
+			}
+			if err := booklist.WriteConfig(configFileName, out); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "Upgraded %s from version %d to %d\n",
+				configFileName, from, booklist.ConfigVersion)
+			return nil
+		},
+	}
+}
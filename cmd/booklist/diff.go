@@ -0,0 +1,132 @@
+// A unified diff of two files, e.g., to preview a change to a config file.
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffLine is a line of a diff:  an unchanged line (' '), or a line removed
+// from the old file ('-') or added by the new file ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// writeDiff writes a unified diff of the old and new contents.  Nothing is
+// written if they're the same.
+func writeDiff(w io.Writer, oldName, newName string, oldBytes, newBytes []byte) error {
+	lines := diffLines(splitLines(oldBytes), splitLines(newBytes))
+
+	// Find the changed lines; a hunk spans changes separated by no more
+	// than twice the context.
+	var hunks [][2]int
+	for i, line := range lines {
+		if line.op == ' ' {
+			continue
+		}
+		start, end := i-diffContext, i+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range hunks {
+		// Line numbers in each file of the hunk's first line.
+		oldLine, newLine := 1, 1
+		for _, line := range lines[:hunk[0]] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range lines[hunk[0]:hunk[1]] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount,
+			newLine, newCount)
+		for _, line := range lines[hunk[0]:hunk[1]] {
+			fmt.Fprintf(&out, "%c%s\n", line.op, line.text)
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// splitLines splits the contents into lines, without the line endings.
+func splitLines(contents []byte) []string {
+	text := strings.TrimSuffix(string(contents), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns the lines of the diff between the old and new lines,
+// found from their longest common subsequence.  Config files are small
+// enough that the quadratic table isn't a concern.
+func diffLines(oldLines, newLines []string) []diffLine {
+	// common[i][j] is the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:].
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			switch {
+			case oldLines[i] == newLines[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) &&
+			oldLines[i] == newLines[j]:
+			lines = append(lines, diffLine{' ', oldLines[i]})
+			i++
+			j++
+		case j == len(newLines) ||
+			(i < len(oldLines) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{'-', oldLines[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', newLines[j]})
+			j++
+		}
+	}
+	return lines
+}
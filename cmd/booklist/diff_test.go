@@ -0,0 +1,43 @@
+// Unit tests related to the diff of two files. //
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDiff(t *testing.T) {
+	t.Log("the added, removed and changed lines are shown with context.")
+	numbered := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	for _, tc := range []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", ""},
+		{"added", "a\nb\n", "a\nb\nc\n",
+			"@@ -1,2 +1,3 @@\n a\n b\n+c\n"},
+		{"removed", "a\nb\nc\n", "a\nc\n",
+			"@@ -1,3 +1,2 @@\n a\n-b\n c\n"},
+		{"changed", "a\nb\nc\n", "a\nB\nc\n",
+			"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"separate hunks", numbered,
+			strings.Replace(strings.Replace(numbered, "1\n", "one\n", 1),
+				"10\n", "ten\n", 1),
+			"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n"},
+	} {
+		var out strings.Builder
+		err := writeDiff(&out, "old.yml", "new.yml", []byte(tc.old),
+			[]byte(tc.new))
+		expected := tc.expected
+		if expected != "" {
+			expected = "--- old.yml\n+++ new.yml\n" + expected
+		}
+		if err != nil || out.String() != expected {
+			t.Errorf("Expected the %s diff:\n%s\ngot:\n%s(%v)", tc.name,
+				expected, out.String(), err)
+		}
+	}
+}
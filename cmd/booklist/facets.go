@@ -0,0 +1,39 @@
+// The 'facets' command; lists the values of the search filters.
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// facetsCommand returns the 'facets' command.
+func facetsCommand() *command {
+	return &command{
+		name:     "facets",
+		synopsis: "List the media types that can be searched",
+		description: `
+List the media types allowed in a config file along with the value of the
+'Format' facet filter each is translated to in a search request.  The
+'Year' facet filter is always the current year and 'unknown'.`,
+		run: func(e *env, args []string) error {
+			if len(args) != 0 {
+				return errUsage("facets takes no arguments")
+			}
+
+			var names []string
+			for name := range booklist.MediaTypes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			fmt.Fprintf(e.stdout, "%-20s  %s\n", "media-type", "Format facet")
+			for _, name := range names {
+				fmt.Fprintf(e.stdout, "%-20s  %s\n", name,
+					booklist.MediaTypes[name])
+			}
+			return nil
+		},
+	}
+}
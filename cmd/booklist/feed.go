@@ -0,0 +1,51 @@
+// Writing the titles found by a search to a feed or calendar.
+package main
+
+import (
+	"net/url"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// writeFeeds adds the titles found by the run to the feed kept in the
+// state directory, then writes the feed to the files given for each feed
+// format.
+func writeFeeds(e *env, catalogURL string, run *booklist.RunResults, keep int, files map[string]string) error {
+	feedPath, err := booklist.FeedPath()
+	if err != nil {
+		return err
+	}
+	feed, err := booklist.LoadFeed(feedPath)
+	if err != nil {
+		return err
+	}
+	added := feed.Add(run, catalogURL, keep)
+	e.log.Debugf("Added %d titles to the feed of %d", added,
+		len(feed.Entries))
+	if err := booklist.SaveFeed(feedPath, feed); err != nil {
+		return err
+	}
+
+	title := "New titles from booklist"
+	if u, err := url.Parse(catalogURL); err == nil && u.Host != "" {
+		title += " at " + u.Host
+	}
+	for _, format := range []string{booklist.FeedAtom, booklist.FeedRSS} {
+		if files[format] == "" {
+			continue
+		}
+		err := feed.WriteFile(files[format], format, title, catalogURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeICS writes the titles expected to be released in the future to an
+// iCalendar file.
+func writeICS(e *env, fileName, catalogURL string, run *booklist.RunResults) error {
+	releases := booklist.ExpectedReleases(run, run.Time)
+	e.log.Debugf("Found %d expected releases", len(releases))
+	return booklist.WriteICSFile(fileName, releases, catalogURL, run.Time)
+}
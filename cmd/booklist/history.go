@@ -0,0 +1,305 @@
+// The 'history' command and its subcommands; list and compare the runs.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// historyTimeFormat is the format of the times of the runs.
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+// historyCommand returns the 'history' command.
+func historyCommand() *command {
+	return &command{
+		name:     "history",
+		synopsis: "List and compare the recorded runs",
+		description: fmt.Sprintf(`
+List and compare the runs recorded in the history, e.g., to tell when a
+title disappeared from the catalog or when the library's website started
+failing.  Each search for the authors in the config file by 'search' or
+'serve' is recorded with its start and end times, a hash of the
+configuration used, the number of titles found for each author, its error,
+if it failed, and its results.
+
+The history is kept in $XDG_STATE_HOME/booklist, where XDG_STATE_HOME
+defaults to ~/.local/state.  Only the last %d runs are kept; older runs
+are dropped as new ones are recorded.  Runs are given by the numbers listed
+by 'history list'.`, booklist.DefaultHistoryRuns),
+		subcommands: []*command{
+			historyListCommand(),
+			historyShowCommand(),
+			historyDiffCommand(),
+		},
+	}
+}
+
+// recordRun records the run, started at the given time with the
+// configuration, in the history.  A failure to record it is logged rather
+// than failing the run.
+func recordRun(e *env, config booklist.Config, start time.Time, run *booklist.RunResults, err error) {
+	historyPath, pathErr := booklist.HistoryPath()
+	if pathErr != nil {
+		e.log.Warningf("Unable to record the run:  %s", pathErr)
+		return
+	}
+	history, openErr := booklist.OpenHistory(historyPath, false)
+	if openErr != nil {
+		e.log.Warningf("Unable to record the run:  %s", openErr)
+		return
+	}
+	defer history.Close()
+
+	entry := booklist.NewHistoryRun(config, start, run, err)
+	if recordErr := history.Record(entry); recordErr != nil {
+		e.log.Warningf("Unable to record the run:  %s", recordErr)
+		return
+	}
+	e.log.Debugf("Recorded run %d in %s", entry.ID, historyPath)
+}
+
+// openHistory opens the history to read it; it's nil if no runs have been
+// recorded.
+func openHistory() (*booklist.History, error) {
+	historyPath, err := booklist.HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	return booklist.OpenHistory(historyPath, true)
+}
+
+// parseRunIDs parses the runs given as arguments.
+func parseRunIDs(args []string) ([]uint64, error) {
+	var ids []uint64
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil || id == 0 {
+			return nil, errUsage(fmt.Sprintf("invalid run '%s'", arg))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// historyListCommand returns the 'history list' command.
+func historyListCommand() *command {
+	var count int
+	return &command{
+		name:     "list",
+		synopsis: "List the runs, newest first",
+		description: `
+List the runs, newest first, with when each started, how long it took, the
+hash of the configuration used, the number of titles found and the error,
+if it failed.  A change of the configuration's hash explains a change in
+the titles found.`,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.IntVar(&count, "n", 20, "Number of runs to list; 0 for all")
+		},
+		run: func(e *env, args []string) error {
+			if len(args) != 0 {
+				return errUsage("unexpected arguments")
+			}
+			history, err := openHistory()
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+			runs, err := history.Runs()
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				fmt.Fprintln(e.stdout, "No runs have been recorded.")
+				return nil
+			}
+
+			if count > 0 && len(runs) > count {
+				runs = runs[:count]
+			}
+			fmt.Fprintf(e.stdout, "%5s  %-19s  %8s  %-12s  %6s  %s\n", "RUN",
+				"START", "DURATION", "CONFIG", "TITLES", "ERROR")
+			for _, run := range runs {
+				fmt.Fprintf(e.stdout, "%5d  %-19s  %8s  %-12s  %6d  %s\n",
+					run.ID, run.Start.Local().Format(historyTimeFormat),
+					run.End.Sub(run.Start).Round(time.Second),
+					run.ConfigHash, run.Titles(), run.Error)
+			}
+			return nil
+		},
+	}
+}
+
+// historyShowCommand returns the 'history show' command.
+func historyShowCommand() *command {
+	return &command{
+		name:     "show",
+		args:     "[run]",
+		synopsis: "Show the results of a run",
+		description: `
+Show the titles found by the given run, or by the last run, for each
+author, as printed by 'search'.`,
+		run: func(e *env, args []string) error {
+			if len(args) > 1 {
+				return errUsage("at most one run can be given")
+			}
+			ids, err := parseRunIDs(args)
+			if err != nil {
+				return err
+			}
+			history, err := openHistory()
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+			if len(ids) == 0 {
+				if ids, err = lastRunIDs(history, 1); err != nil {
+					return err
+				}
+			}
+			run, err := history.Run(ids[0])
+			if err != nil {
+				return err
+			}
+
+			printRunHeader(e.stdout, "Run", run)
+			if run.Error != "" {
+				fmt.Fprintf(e.stdout, "Failed:  %s\n", run.Error)
+			}
+			for _, result := range run.Results {
+				fmt.Fprintf(e.stdout, "%s -- %ss:\n", result.Author,
+					result.Media)
+				printResult(e.stdout, result)
+			}
+			return nil
+		},
+	}
+}
+
+// historyDiffCommand returns the 'history diff' command.
+func historyDiffCommand() *command {
+	return &command{
+		name:     "diff",
+		args:     "[older_run [newer_run]]",
+		synopsis: "Show the titles added or removed between two runs",
+		description: `
+Show the titles found by only one of two runs:  those removed since the
+older run, marked '-', and those added by the newer run, marked '+'.  With
+one run, it's compared with the run before it; with none, the last two
+runs are compared.
+
+Only the authors and media types searched by both runs are compared, so
+that a run that failed part way, or a change to the config file, doesn't
+make titles seem to disappear.`,
+		run: func(e *env, args []string) error {
+			if len(args) > 2 {
+				return errUsage("at most two runs can be given")
+			}
+			ids, err := parseRunIDs(args)
+			if err != nil {
+				return err
+			}
+			history, err := openHistory()
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+			switch len(ids) {
+			case 0:
+				if ids, err = lastRunIDs(history, 2); err != nil {
+					return err
+				}
+				ids[0], ids[1] = ids[1], ids[0]
+			case 1:
+				if ids[0] == 1 {
+					return errors.New("run 1 is the first run; there's " +
+						"no run before it")
+				}
+				ids = []uint64{ids[0] - 1, ids[0]}
+			}
+
+			var runs []*booklist.HistoryRun
+			for _, id := range ids {
+				run, err := history.Run(id)
+				if err != nil {
+					return err
+				}
+				if run.Error != "" {
+					e.log.Warningf("Run %d failed; only the authors it "+
+						"searched are compared:  %s", run.ID, run.Error)
+				}
+				runs = append(runs, run)
+			}
+			printRunHeader(e.stdout, "--- run", runs[0])
+			printRunHeader(e.stdout, "+++ run", runs[1])
+			printRunDiff(e.stdout, booklist.DiffRuns(runs[0], runs[1]))
+			return nil
+		},
+	}
+}
+
+// lastRunIDs returns the IDs of the last n runs, newest first.
+func lastRunIDs(history *booklist.History, n int) ([]uint64, error) {
+	runs, err := history.Runs()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(runs) == 0:
+		return nil, errors.New("no runs have been recorded")
+	case len(runs) < n:
+		return nil, fmt.Errorf("only %d run has been recorded", len(runs))
+	}
+	var ids []uint64
+	for _, run := range runs[:n] {
+		ids = append(ids, run.ID)
+	}
+	return ids, nil
+}
+
+// printRunHeader prints a line identifying the run, after the prefix.
+func printRunHeader(w io.Writer, prefix string, run *booklist.HistoryRun) {
+	fmt.Fprintf(w, "%s %d, %s to %s, config %s\n", prefix, run.ID,
+		run.Start.Local().Format(historyTimeFormat),
+		run.End.Local().Format(historyTimeFormat), run.ConfigHash)
+}
+
+// printRunDiff prints the titles removed and added for each author.
+func printRunDiff(w io.Writer, diff booklist.RunDiff) {
+	type change struct {
+		op  byte
+		pub booklist.PublicationInfo
+	}
+	var keys []string
+	changes := make(map[string][]change)
+	add := func(results []booklist.SearchResult, op byte) {
+		for _, result := range results {
+			key := fmt.Sprintf("%s -- %ss:", result.Author, result.Media)
+			if _, ok := changes[key]; !ok {
+				keys = append(keys, key)
+			}
+			for _, pub := range result.Publications {
+				changes[key] = append(changes[key], change{op, pub})
+			}
+		}
+	}
+	add(diff.Removed, '-')
+	add(diff.Added, '+')
+
+	if len(keys) == 0 {
+		fmt.Fprintln(w, "No titles were added or removed.")
+		return
+	}
+	for _, key := range keys {
+		fmt.Fprintln(w, key)
+		for _, c := range changes[key] {
+			fmt.Fprintf(w, "%c [%s]  %s\n", c.op, c.pub.Media,
+				c.pub.Publication)
+		}
+	}
+}
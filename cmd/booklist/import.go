@@ -0,0 +1,104 @@
+// The 'import' command; adds authors from another service's export.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// importCommand returns the 'import' command.
+func importCommand() *command {
+	var format, media string
+	var dryRun bool
+	return &command{
+		name:     "import",
+		args:     "import_file [config_file]",
+		synopsis: "Add the authors from a reading list export",
+		description: `
+Add the authors found in import_file to the end of the config file's list
+of authors; authors already listed are skipped.  The import file may be a
+Goodreads library export, a StoryGraph export, an OPML file or a text file
+with one name per line.  The format is detected from the file unless given
+with -format.
+
+Names are split into a first and last name; a surname of more than one
+word, such as 'McCall Smith' or 'Le Guin', is recognized in most cases.
+Names given as 'Lastname, Firstname' are never ambiguous.  Names of a
+single word can't be searched for and are reported as skipped.
+
+As with the 'authors' commands, the config file's comments are preserved
+and its previous contents are saved to a file with '` + booklist.BackupSuffix + `' appended.`,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&format, "format", "",
+				"Format of the import file: "+
+					strings.Join(booklist.ImportFormats, ", "))
+			fs.StringVar(&media, "media", "",
+				"Media type for the imported authors; by default, the "+
+					"config file's media type is used")
+			fs.BoolVar(&dryRun, "dry-run", false,
+				"List the authors that would be added without changing "+
+					"the config file")
+		},
+		run: func(e *env, args []string) error {
+			if len(args) == 0 {
+				return errUsage("an import file is required")
+			}
+			importFileName := args[0]
+			contents, err := ioutil.ReadFile(importFileName)
+			if err != nil {
+				return err
+			}
+			if format == "" {
+				format = booklist.DetectImportFormat(importFileName, contents)
+				e.log.Debugf("Importing %s as %s", importFileName, format)
+			}
+
+			authors, skipped, err := booklist.ImportAuthors(
+				bytes.NewReader(contents), format)
+			if err != nil {
+				return err
+			}
+			for _, name := range skipped {
+				e.log.Warningf("Skipped '%s'; a first and last name are "+
+					"required", name)
+			}
+			for i := range authors {
+				authors[i].Media = media
+			}
+
+			var added []booklist.AuthorInfo
+			merge := func(ed *booklist.ConfigEditor) error {
+				var mergeErr error
+				added, mergeErr = ed.MergeAuthors(authors)
+				return mergeErr
+			}
+
+			var configFileName string
+			if dryRun {
+				_, configFileName, err = applyEdit(e, args[1:], merge)
+			} else {
+				configFileName, err = editAuthors(e, args[1:], merge)
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, author := range added {
+				fmt.Fprintf(e.stdout, "%s, %s\n",
+					author.Lastname, author.Firstname)
+			}
+			verb := "Added"
+			if dryRun {
+				verb = "Would add"
+			}
+			fmt.Fprintf(e.stdout, "%s %d of %d authors to %s\n", verb,
+				len(added), len(authors), configFileName)
+			return nil
+		},
+	}
+}
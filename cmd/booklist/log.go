@@ -0,0 +1,133 @@
+// Logging for booklist; the messages of the commands and of the searches
+// are written to stderr or to a file, as text or JSON, at the level chosen
+// with the global flags.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// logger logs the messages of the commands to a booklist.Logger, which
+// also logs the searches.
+type logger struct {
+	booklist.Logger
+}
+
+// Error logs the arguments, formatted as by fmt.Sprint, as an error.
+func (l logger) Error(args ...interface{}) {
+	l.Log(booklist.LevelError, fmt.Sprint(args...), nil)
+}
+
+// Errorf logs the message, formatted as by fmt.Sprintf, as an error.
+func (l logger) Errorf(format string, args ...interface{}) {
+	l.Log(booklist.LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+// Warning logs the arguments, formatted as by fmt.Sprint, as a warning.
+func (l logger) Warning(args ...interface{}) {
+	l.Log(booklist.LevelWarn, fmt.Sprint(args...), nil)
+}
+
+// Warningf logs the message, formatted as by fmt.Sprintf, as a warning.
+func (l logger) Warningf(format string, args ...interface{}) {
+	l.Log(booklist.LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+// Infof logs the message, formatted as by fmt.Sprintf, for information.
+func (l logger) Infof(format string, args ...interface{}) {
+	l.Log(booklist.LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// Debug logs the arguments, formatted as by fmt.Sprint, for debugging.
+func (l logger) Debug(args ...interface{}) {
+	l.Log(booklist.LevelDebug, fmt.Sprint(args...), nil)
+}
+
+// Debugf logs the message, formatted as by fmt.Sprintf, for debugging.
+func (l logger) Debugf(format string, args ...interface{}) {
+	l.Log(booklist.LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+// newLogger returns the logger used until the global flags are parsed:
+// warnings and errors, as text, to w.
+func newLogger(w io.Writer) logger {
+	log, err := booklist.NewWriterLogger(w, booklist.LevelWarn,
+		booklist.LogText)
+	if err != nil {
+		panic(err)
+	}
+	return logger{log}
+}
+
+// initLogging sets the level, format and destination of the logs from the
+// global flags.  -d is the same as '-log-level debug', unless a more
+// detailed level is given.
+func initLogging(e *env) error {
+	level, err := booklist.ParseLevel(e.logLevel)
+	if err != nil {
+		return errUsage(err.Error())
+	}
+	if e.debug && level < booklist.LevelDebug {
+		level = booklist.LevelDebug
+	}
+
+	var w io.Writer = e.stderr
+	if e.logFile != "" {
+		file := &logFile{name: e.logFile}
+		if err := file.Reopen(); err != nil {
+			return err
+		}
+		e.logOutput = file
+		w = file
+	}
+
+	log, err := booklist.NewWriterLogger(w, level, e.logFormat)
+	if err != nil {
+		return errUsage(err.Error())
+	}
+	e.log.Logger = log
+	return nil
+}
+
+// logFile is the file given with -log-file.  It can be reopened, e.g., by
+// 'serve' on SIGHUP once logrotate has moved it, without losing a message.
+type logFile struct {
+	mu   sync.Mutex
+	name string
+	file *os.File
+}
+
+// Write appends p to the file.
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens the file again, creating it if it's been moved or deleted,
+// and closes the old one.  The old one is kept if the file can't be opened.
+func (f *logFile) Reopen() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file:  %s", err)
+	}
+	f.mu.Lock()
+	old := f.file
+	f.file = file
+	f.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// logLevelUsage describes the -log-level flag.
+var logLevelUsage = "Log `level`, one of " +
+	strings.Join(booklist.LevelNames(), ", ")
@@ -0,0 +1,48 @@
+// Unit tests related to the logs' destination. //
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogFileReopen(t *testing.T) {
+	t.Log("a moved log file is recreated when reopened.")
+	name := filepath.Join(t.TempDir(), "booklist.log")
+	file := &logFile{name: name}
+	if err := file.Reopen(); err != nil {
+		t.Fatalf("Unable to open the log file: %s.", err)
+	}
+	defer file.file.Close()
+	file.Write([]byte("before\n"))
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatalf("Unable to move the log file: %s.", err)
+	}
+	file.Write([]byte("moved\n"))
+	if err := file.Reopen(); err != nil {
+		t.Fatalf("Unable to reopen the log file: %s.", err)
+	}
+	file.Write([]byte("after\n"))
+
+	for fileName, expected := range map[string]string{
+		name + ".1": "before\nmoved\n",
+		name:        "after\n",
+	} {
+		contents, err := ioutil.ReadFile(fileName)
+		if err != nil || string(contents) != expected {
+			t.Errorf("Expected %s to contain %q; got %q, %v.", fileName,
+				expected, contents, err)
+		}
+	}
+
+	t.Log("the old file is kept if the file can't be reopened.")
+	file.name = filepath.Join(name, "missing", "booklist.log")
+	if err := file.Reopen(); err == nil {
+		t.Errorf("Expected an error reopening %s.", file.name)
+	}
+	if _, err := file.Write([]byte("kept\n")); err != nil {
+		t.Errorf("Expected the old file to be kept; got %s.", err)
+	}
+}
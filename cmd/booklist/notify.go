@@ -0,0 +1,93 @@
+// Sending the results of a search to the notifiers, e.g., by email.
+package main
+
+import (
+	"fmt"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// notifyResults sends the digest of the run to the notifiers configured in
+// the config file, each getting the results of the authors routed to it.
+// If useState is set, the titles new since the previous run are found from
+// the saved results, which are then replaced by this run's.  The saved
+// results are only replaced if every notifier succeeds, so that new titles
+// aren't missed by a notifier that failed.  With dryRun, what would be sent
+// is printed instead, and the saved results are left alone.  The retries
+// are recorded by metrics, which may be nil.
+func notifyResults(e *env, config *booklist.NotifyConfig, run *booklist.RunResults, metrics *booklist.Metrics, useState, dryRun bool) error {
+	notifiers, err := booklist.NewNotifiers(config)
+	if err != nil {
+		return err
+	}
+	for _, notifier := range notifiers {
+		if webhook, ok := notifier.(*booklist.WebhookNotifier); ok {
+			webhook.Metrics = metrics
+			webhook.Log = e.log
+		}
+	}
+	if len(notifiers) == 0 {
+		e.log.Warning("-notify was given, but the config file has no " +
+			"notifiers; add them with the notify key")
+		return nil
+	}
+
+	var resultsPath string
+	var previous *booklist.RunResults
+	if useState {
+		if resultsPath, err = booklist.ResultsPath(); err != nil {
+			return err
+		}
+		if previous, err = booklist.LoadResults(resultsPath); err != nil {
+			return err
+		}
+	}
+
+	digest := booklist.NewDigest(run, previous)
+	e.log.Debugf("Notifying of %d results, %d with new titles",
+		len(digest.Results), len(digest.New))
+	if dryRun {
+		return printPayloads(e, notifiers, digest)
+	}
+	failed := false
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(digest.Route(notifier.Name())); err != nil {
+			e.log.Error(err)
+			failed = true
+		}
+	}
+	if failed {
+		return exitCode(1)
+	}
+
+	if useState {
+		return booklist.SaveResults(resultsPath, run)
+	}
+	return nil
+}
+
+// printPayloads prints what each notifier would send for the digest.
+func printPayloads(e *env, notifiers []booklist.Notifier, digest booklist.Digest) error {
+	for _, notifier := range notifiers {
+		payload, err := notifier.Payload(digest.Route(notifier.Name()))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "\n==> %s\n", notifier.Name())
+		if payload == nil {
+			fmt.Fprintln(e.stdout, "(nothing would be sent)")
+			continue
+		}
+		fmt.Fprintf(e.stdout, "%s\n", payload)
+	}
+	return nil
+}
+
+// saveResults replaces the saved results of the last run with the run's.
+func saveResults(run *booklist.RunResults) error {
+	resultsPath, err := booklist.ResultsPath()
+	if err != nil {
+		return err
+	}
+	return booklist.SaveResults(resultsPath, run)
+}
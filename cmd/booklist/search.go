@@ -0,0 +1,410 @@
+// The 'search' command; searches the catalog for the configured authors.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// searchOptions are the flags of the 'search' command.
+type searchOptions struct {
+	record         string
+	trace          string
+	cache          time.Duration
+	strict         bool
+	driftThreshold float64
+	url            string
+	author         string
+	media          string
+	year           string
+	notify         bool
+	notifyDryRun   bool
+	atom           string
+	rss            string
+	feedEntries    int
+	ics            string
+	metricsFile    string
+}
+
+// yearPattern matches a valid value for the -year flag.
+var yearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// searchCommand returns the 'search' command.
+func searchCommand() *command {
+	opts := new(searchOptions)
+	return &command{
+		name:     "search",
+		args:     "[config_file]",
+		synopsis: "Search the catalog for this year's publications",
+		description: `
+Search a public library's catalog website for this year's publications
+from authors listed in the given config file.
+
+config_file    YAML-formatted file containing library's catalog url and
+               list of authors; may instead be given with -config or
+               found in the default locations (see 'booklist help')
+
+With -author, search for that one author instead of the authors in the
+config file, e.g.:
+
+    booklist search -url URL -author "Grafton, Sue" -media ebook -year 2015
+
+The config file is then optional.  If -url or -media isn't given, the
+value is taken from the global flags, environment variables or config file
+as usual; see 'booklist help'.
+
+With -notify, the results are also sent to the notifiers configured by the
+config file's notify key, e.g., as an email digest.  The results of each
+run with -notify are kept so that the next one can tell which titles are
+new.  With -notify-dry-run, what would be sent to each notifier is printed
+instead, and the results aren't kept.
+
+With -atom or -rss, the titles found are added to a feed, which is written
+to the given file as an Atom or RSS 2.0 feed for a feed reader.  The feed
+keeps the last -feed-entries titles across runs, each with the date it was
+first found.
+
+With -ics, the titles expected to be released in the future, i.e., those
+for which the catalog gives a publication date still to come, are written
+to the given file as iCalendar events, for a calendar app.
+
+With -cache, the catalog's responses are cached in $XDG_CACHE_HOME/booklist
+and reused by a search repeated within the given time, e.g., 1h, while
+trying out a config file; see 'booklist help cache'.  Traced and recorded
+responses may then come from the cache.
+
+With -metrics-file, the Prometheus metrics of the run, e.g., the requests
+to the catalog and their latencies, the titles found for each author and
+the time of the last successful run, are written to the given file, for
+the node exporter's textfile collector; the file's name should end with
+'.prom'.
+
+Each search for the authors in the config file, for this year, is recorded
+in the history of the runs; see 'booklist help history'.`,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&opts.record, "record", "",
+				"Save the exchanges with the library's website to the "+
+					"given fixture file")
+			fs.StringVar(&opts.trace, "trace", "",
+				"Write each request and response to the given directory, "+
+					"or to an HTTP Archive file if the name ends with '.har'")
+			fs.DurationVar(&opts.cache, "cache", 0,
+				"Reuse the catalog's responses cached within the given "+
+					"`duration`, e.g., 1h; 0 to always ask the catalog")
+			fs.BoolVar(&opts.strict, "strict", false,
+				"Exit with an error if the responses are missing "+
+					"expected fields")
+			fs.Float64Var(&opts.driftThreshold, "drift-threshold",
+				booklist.DefaultDriftThreshold,
+				"Fraction of responses missing expected fields that "+
+					"triggers a warning")
+			fs.StringVar(&opts.author, "author", "",
+				"Search for the given author, as 'Lastname, Firstname', "+
+					"instead of the authors in the config file")
+			fs.StringVar(&opts.url, "url", "",
+				"Library's catalog url; the same as -catalog-url")
+			fs.StringVar(&opts.media, "media", "",
+				"Media type; the same as -media-type")
+			fs.StringVar(&opts.year, "year", booklist.CurrentYear,
+				"Publication year to search for")
+			fs.BoolVar(&opts.notify, "notify", false,
+				"Send the results to the notifiers configured in the "+
+					"config file, e.g., by email")
+			fs.BoolVar(&opts.notifyDryRun, "notify-dry-run", false,
+				"Print what -notify would send to each notifier, "+
+					"without sending it")
+			fs.StringVar(&opts.atom, "atom", "",
+				"Add the titles found to a feed and write it to the "+
+					"given file as an Atom feed")
+			fs.StringVar(&opts.rss, "rss", "",
+				"Add the titles found to a feed and write it to the "+
+					"given file as an RSS 2.0 feed")
+			fs.StringVar(&opts.ics, "ics", "",
+				"Write the titles expected to be released in the "+
+					"future to the given iCalendar file")
+			fs.IntVar(&opts.feedEntries, "feed-entries",
+				booklist.DefaultFeedEntries,
+				"Number of titles kept in the feed")
+			fs.StringVar(&opts.metricsFile, "metrics-file", "",
+				"Write the Prometheus metrics of the run to the given "+
+					"file, for the node exporter's textfile collector")
+		},
+		run: func(e *env, args []string) error {
+			return runSearch(e, opts, args)
+		},
+	}
+}
+
+// runSearch reads the config file then retrieves and prints the search
+// results for its authors.
+func runSearch(e *env, opts *searchOptions, args []string) error {
+	if !yearPattern.MatchString(opts.year) {
+		return errUsage(fmt.Sprintf("invalid year '%s'", opts.year))
+	}
+	adHoc := opts.author != "" || opts.year != booklist.CurrentYear
+	if adHoc && (opts.atom != "" || opts.rss != "") {
+		return errUsage("-atom and -rss can't be used with -author or " +
+			"-year; the feed is of this year's titles by the authors " +
+			"in the config file")
+	}
+
+	// An ad-hoc search overrides the authors in the config file, along
+	// with its catalog url and media type if given.
+	if opts.url != "" {
+		e.override("catalog-url", opts.url, "url")
+	}
+	if opts.media != "" {
+		e.override("media-type", opts.media, "media")
+	}
+	if opts.author != "" {
+		e.override("authors", opts.author, "author")
+	}
+	config, err := e.config(args)
+	if err != nil {
+		return err
+	}
+
+	// If requested, reuse the library's recent responses rather than ask
+	// its website again.
+	var transport http.RoundTripper = http.DefaultTransport
+	var cache *booklist.ResponseCache
+	if opts.cache > 0 {
+		cacheDir, err := booklist.ResponseCacheDir()
+		if err != nil {
+			return err
+		}
+		cache = booklist.NewResponseCache(transport, cacheDir, opts.cache)
+		transport = cache
+	}
+
+	// If requested, trace the exchanges with the library's website to
+	// help diagnose changes in its configuration.
+	var tracer *booklist.Tracer
+	if opts.trace != "" {
+		traceDir := opts.trace
+		if strings.HasSuffix(traceDir, ".har") {
+			traceDir = ""
+		}
+		tracer, err = booklist.NewTracer(transport, traceDir)
+		if err != nil {
+			return err
+		}
+		transport = tracer
+	}
+
+	// If requested, record the exchanges with the library's website so
+	// they can be attached to a bug report and replayed.
+	var recorder *booklist.Recorder
+	if opts.record != "" {
+		recorder = booklist.NewRecorder(transport)
+		transport = recorder
+	}
+
+	var client *http.Client
+	if transport != http.DefaultTransport {
+		client = &http.Client{
+			Timeout:   time.Second * 10,
+			Transport: transport,
+		}
+	}
+
+	// If requested, write the metrics of the run once it's done, whether
+	// or not it succeeded, so that a failure can be alerted on.
+	var metrics *booklist.Metrics
+	if opts.metricsFile != "" {
+		metrics = booklist.NewMetrics()
+		defer func() {
+			if err := metrics.WriteTextfile(opts.metricsFile); err != nil {
+				e.log.Errorf("Unable to write the metrics:  %s", err)
+			}
+		}()
+	}
+
+	// Retrieve the publications for the authors in the configuration file
+	// and print the results.
+	start := time.Now()
+	drift := new(booklist.DriftStats)
+	run, err := searchAuthors(e, config, opts.year, client, drift, metrics,
+		e.stdout)
+	metrics.ObserveRun(start, run, drift, err)
+	if !adHoc {
+		recordRun(e, config, start, run, err)
+	}
+	if recorder != nil {
+		if saveErr := recorder.Save(opts.record); saveErr != nil {
+			e.log.Error(saveErr)
+		}
+	}
+	if tracer != nil && tracer.Dir == "" {
+		if saveErr := tracer.WriteHAR(opts.trace); saveErr != nil {
+			e.log.Error(saveErr)
+		}
+	}
+	if tracer != nil && tracer.Err() != nil {
+		e.log.Error(tracer.Err())
+	}
+	if cache != nil && cache.Err() != nil {
+		e.log.Warning(cache.Err())
+	}
+	if err != nil {
+		return err
+	}
+
+	// Warn if the responses are missing the fields the search relies
+	// on, as the results are then probably incomplete.
+	e.log.Debug(drift)
+	if drift.Exceeds(opts.driftThreshold) {
+		e.log.Warningf("%s; the library's catalog may have changed "+
+			"and the results may be incomplete", drift)
+		if opts.strict {
+			return exitCode(1)
+		}
+	}
+
+	if opts.atom != "" || opts.rss != "" {
+		err := writeFeeds(e, config.URL, run, opts.feedEntries, map[string]string{
+			booklist.FeedAtom: opts.atom,
+			booklist.FeedRSS:  opts.rss,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.ics != "" {
+		if err := writeICS(e, opts.ics, config.URL, run); err != nil {
+			return err
+		}
+	}
+
+	if opts.notify || opts.notifyDryRun {
+		// Only the results for the authors in the config file, for
+		// this year, are compared with the previous run's.
+		return notifyResults(e, config.Notify, run, metrics, !adHoc,
+			opts.notifyDryRun)
+	}
+	return nil
+}
+
+// searchAuthors searches the catalog for the authors in the config file,
+// printing the results to w, and returns the results of the run.  Each
+// author's results are routed to the notifiers named for the author.
+func searchAuthors(e *env, config booklist.Config, year string, client *http.Client, drift *booklist.DriftStats, metrics *booklist.Metrics, w io.Writer) (*booklist.RunResults, error) {
+	run := &booklist.RunResults{Time: time.Now()}
+	var err error
+	run.Results, err = printSearchResults(w, configSearches(config, year),
+		client, drift, metrics, e.log)
+	for i := range run.Results {
+		run.Results[i].Notify = config.Authors[i].Notify
+	}
+	return run, err
+}
+
+// configSearches returns the searches for the authors in the config file.
+func configSearches(config booklist.Config, year string) []booklist.CatalogInfo {
+	// The default type is the value specified in the config file or
+	// if not found, the standard default type.
+	defaultMedia := booklist.DefaultMediaType
+	if config.Media != "" {
+		defaultMedia = config.Media
+	}
+
+	var searches []booklist.CatalogInfo
+	for _, authorInfo := range config.Authors {
+		media := defaultMedia
+		if authorInfo.Media != "" {
+			media = authorInfo.Media
+		}
+
+		searches = append(searches, booklist.CatalogInfo{
+			URL: config.URL,
+			Author: fmt.Sprintf("%s, %s",
+				authorInfo.Lastname, authorInfo.Firstname),
+			Media: media,
+			Year:  year,
+		})
+	}
+	return searches
+}
+
+// Retrieve and print the author publications for each search, and return
+// the results.
+func printSearchResults(w io.Writer, searches []booklist.CatalogInfo, client *http.Client, drift *booklist.DriftStats, metrics *booklist.Metrics, log booklist.Logger) ([]booklist.SearchResult, error) {
+	var searchResults []booklist.SearchResult
+	for _, c := range searches {
+		fmt.Fprintf(w, "%s -- %ss:\n", c.Author, c.Media)
+		c.Log = log
+		c.Client = client
+		c.Drift = drift
+		c.Metrics = metrics
+		results, err := c.PublicationSearch()
+		if err != nil {
+			return searchResults, err
+		}
+		searchResults = append(searchResults, booklist.SearchResult{
+			Author:       c.Author,
+			Media:        c.Media,
+			Library:      c.URL,
+			Publications: results,
+		})
+		printResult(w, searchResults[len(searchResults)-1])
+	}
+	return searchResults, nil
+}
+
+// printResult prints the titles found by a search.
+func printResult(w io.Writer, result booklist.SearchResult) {
+	// Each entry in the results list is a tuple containing the media
+	// type and publication name (e.g., book title).  Since some media
+	// types are supersets of other media types, it seemed useful to
+	// provide that extra information.
+	maxWidth := 0
+	for _, info := range result.Publications {
+		l := len(info.Media)
+		if l > maxWidth {
+			maxWidth = l
+		}
+	}
+	for _, pubInfo := range result.Publications {
+		fmt.Fprintf(w, "  [%-*s]  %s\n",
+			maxWidth, pubInfo.Media, pubInfo.Publication)
+	}
+}
+
+// searchErrorHint returns advice for a failed catalog search, or an empty
+// string if there's nothing more useful to say than the error itself.
+func searchErrorHint(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var httpErr *booklist.HTTPError
+	var decodeErr *booklist.DecodeError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return "check that the host name in catalog-url is spelled correctly"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "the library's website is slow to respond; try again later"
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound:
+		return "catalog-url may not be the catalog search page of a " +
+			"CARL.X library"
+	case errors.As(err, &httpErr) && httpErr.StatusCode >= 500:
+		return "the library's website is having problems; try again later"
+	case errors.As(err, &decodeErr):
+		return "the response wasn't JSON; catalog-url may not be the " +
+			"catalog search page of a CARL.X library"
+	case errors.Is(err, booklist.ErrSearchRejected):
+		return "the library may not support the media type being searched"
+	case errors.Is(err, booklist.ErrCountMismatch):
+		return "the catalog changed during the search; try again"
+	}
+	return ""
+}
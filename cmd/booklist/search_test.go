@@ -0,0 +1,76 @@
+// Unit tests related to the 'search' command. //
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+// withoutConfig makes sure that no config file or environment variable
+// sets the configuration for the duration of the test.
+func withoutConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("XDG_STATE_HOME", home)
+	t.Setenv(booklist.ConfigEnv, "")
+	for _, name := range booklist.ConfigEnvVars {
+		t.Setenv(name, "")
+	}
+}
+
+func TestAdHocSearch(t *testing.T) {
+	t.Log("an ad-hoc search needs no config file.")
+	withoutConfig(t)
+	catalog := booklisttest.NewServer(
+		booklisttest.Publication{Author: "Grafton, Sue", Title: "X",
+			Format: "eBook", Year: "2015"},
+		booklisttest.Publication{Author: "Grafton, Sue", Title: "Y",
+			Format: "eBook", Year: "2016"},
+		booklisttest.Publication{Author: "King, Stephen", Title: "Z",
+			Format: "eBook", Year: "2015"},
+	)
+	defer catalog.Close()
+
+	_, stdout, stderr, status := runCommand(t, "search", "-url", catalog.URL,
+		"-author", "Grafton, Sue", "-media", "ebook", "-year", "2015")
+	expected := "Grafton, Sue -- eBooks:\n  [eBook]  X\n"
+	if status != 0 || stdout != expected {
+		t.Errorf("Expected %q; got %q, %q (status %d).", expected, stdout,
+			stderr, status)
+	}
+	if runs := historyRuns(t); len(runs) != 0 {
+		t.Errorf("Expected the ad-hoc search not to be recorded; got %d "+
+			"runs.", len(runs))
+	}
+
+	t.Log("a missing url, bad media type or bad year is reported.")
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-author", "Grafton, Sue"}, "catalog-url is not set"},
+		{[]string{"-url", catalog.URL, "-author", "Grafton, Sue",
+			"-media", "vinyl"}, "Does not match format 'media'"},
+		{[]string{"-url", catalog.URL, "-author", "Grafton, Sue",
+			"-year", "15"}, "invalid year '15'"},
+		{[]string{"-url", catalog.URL, "-author", "Grafton"},
+			"must be given as 'Lastname, Firstname'"},
+	} {
+		catalog.Reset()
+		args := append([]string{"search"}, tc.args...)
+		_, _, stderr, status := runCommand(t, args...)
+		if status != 1 || !strings.Contains(stderr, tc.expected) {
+			t.Errorf("Expected %v to fail with %q; got %q (status %d).",
+				tc.args, tc.expected, stderr, status)
+		}
+		if requests := catalog.Requests(); len(requests) != 0 {
+			t.Errorf("Expected no requests for %v; got %d.", tc.args,
+				len(requests))
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// The 'serve' command; runs the searches on a schedule until stopped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"github.com/robfig/cron/v3"
+)
+
+// defaultSchedule is the default schedule of the searches:  every day at
+// 7 AM.
+const defaultSchedule = "0 7 * * *"
+
+// maxRuns is the number of runs listed by the API.
+const maxRuns = 100
+
+// serveOptions are the flags of the 'serve' command.
+type serveOptions struct {
+	schedule string
+	runNow   bool
+	watch    time.Duration
+	listen   string
+}
+
+// serveCommand returns the 'serve' command.
+func serveCommand() *command {
+	opts := new(serveOptions)
+	return &command{
+		name:     "serve",
+		args:     "[config_file]",
+		synopsis: "Run the searches on a schedule",
+		description: `
+Keep running, searching the catalog for this year's publications from the
+authors in the config file on a schedule, instead of relying on cron.
+
+The schedule is a cron expression in local time:  minute, hour, day of
+month, month and day of week, e.g., "0 7 * * 1-5" for 7 AM on weekdays, or
+a descriptor such as @daily or "@every 6h".
+
+The results of each search are kept in the state directory, as for
+'search -notify', and sent to the notifiers configured by the config file's
+notify key; a search that fails is retried at the next scheduled time.
+Each search is recorded in the history of the runs; see 'booklist help
+history'.
+
+The config file, and the files it includes, are read again when they change
+or when booklist receives SIGHUP; if the new configuration is invalid, the
+old one is kept.  SIGHUP also reopens the -log-file, e.g., once logrotate
+has moved it.  On SIGTERM or an interrupt, booklist waits for a search in
+progress to finish, then exits; a second SIGTERM or interrupt exits at once.
+
+With -listen, booklist also serves a dashboard of the titles found and a
+JSON API at the given address, e.g., localhost:8080:
+
+    GET  /api/authors    the authors in the config file
+    GET  /api/results    the results of the last search; the 'author',
+                         'media' and 'library' parameters filter them and
+                         'new=true' keeps only the new titles
+    GET  /api/runs       the searches made since booklist started
+    POST /api/search     an ad-hoc search, e.g.,
+                         {"author": "Grafton, Sue", "media": "ebook"}
+    GET  /metrics        the metrics of the searches, for Prometheus
+
+The API has no authentication, so -listen should stay on a loopback
+address such as localhost.  Only one ad-hoc search runs at a time; another
+request is refused with 429 Too Many Requests until it's done.`,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&opts.schedule, "schedule", defaultSchedule,
+				"Cron `expression` giving when to search")
+			fs.BoolVar(&opts.runNow, "run-now", false,
+				"Search once at startup, as well as on the schedule")
+			fs.DurationVar(&opts.watch, "watch", 5*time.Second,
+				"How often to check the config file for changes; 0 to "+
+					"only reread it on SIGHUP")
+			fs.StringVar(&opts.listen, "listen", "",
+				"Serve the dashboard and JSON API at the given `address`, "+
+					"e.g., localhost:8080; keep it on loopback, as there's "+
+					"no authentication")
+		},
+		run: func(e *env, args []string) error {
+			return runServe(e, opts, args)
+		},
+	}
+}
+
+// daemon is the state of the 'serve' command.
+type daemon struct {
+	e    *env
+	args []string
+
+	// config is the current configuration; files are the files it was
+	// read from and stamp describes their state when read.
+	config booklist.Config
+	files  []string
+	stamp  string
+
+	// run and previous are the results of the last search and of the
+	// one before; runs are the searches made, newest first.  These and
+	// config are guarded by mu, as the HTTP server reads them.
+	mu       sync.Mutex
+	run      *booklist.RunResults
+	previous *booklist.RunResults
+	runs     []booklist.RunSummary
+
+	metrics *booklist.Metrics
+
+	// searchFunc runs the searches; it's d.search unless replaced by a
+	// test.
+	searchFunc func(config booklist.Config)
+
+	// statusMu serializes the status messages of the searches and of the
+	// loop.
+	statusMu sync.Mutex
+}
+
+// runServe runs the searches on the schedule until a signal to stop.
+func runServe(e *env, opts *serveOptions, args []string) error {
+	schedule, err := cron.ParseStandard(opts.schedule)
+	if err != nil {
+		return errUsage(fmt.Sprintf("invalid schedule '%s':  %s",
+			opts.schedule, err))
+	}
+
+	d := &daemon{e: e, args: args, metrics: booklist.NewMetrics()}
+	if err := d.reload(); err != nil {
+		return err
+	}
+	d.loadResults()
+
+	if opts.listen != "" {
+		server, err := d.listen(opts.listen)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(),
+				5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				e.log.Error(err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var watch <-chan time.Time
+	if opts.watch > 0 {
+		ticker := time.NewTicker(opts.watch)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+	return d.loop(schedule, opts.runNow, signals, watch)
+}
+
+// loop runs the searches on the schedule, and once at the start if runNow
+// is set, until a signal to stop.  The config file is reloaded on SIGHUP
+// and when it's changed, checked each time watch ticks.
+func (d *daemon) loop(schedule cron.Schedule, runNow bool, signals <-chan os.Signal, watch <-chan time.Time) error {
+	search := d.searchFunc
+	if search == nil {
+		search = d.search
+	}
+
+	// Searches run in the background, one at a time, so that signals are
+	// handled while a search is in progress.
+	done := make(chan struct{})
+	running := false
+	start := func() {
+		if running {
+			d.e.log.Warning("The previous search is still running; " +
+				"skipping this one")
+			return
+		}
+		running = true
+		d.mu.Lock()
+		config := d.config
+		d.mu.Unlock()
+		go func() {
+			search(config)
+			done <- struct{}{}
+		}()
+	}
+
+	if runNow {
+		start()
+	}
+	next := schedule.Next(time.Now())
+	d.status("Next search at %s", next.Format("Mon Jan 2 15:04:05 MST"))
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			start()
+			next = schedule.Next(time.Now())
+			timer.Reset(time.Until(next))
+			d.status("Next search at %s", next.Format("Mon Jan 2 15:04:05 MST"))
+		case <-done:
+			running = false
+		case <-watch:
+			if d.changed() {
+				d.status("Config file changed; reloading")
+				d.reloadOrKeep()
+			}
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				d.hangup()
+				continue
+			}
+			if running {
+				d.status("Waiting for the search in progress to finish")
+				if !d.drain(done, signals) {
+					return exitCode(1)
+				}
+			}
+			d.status("Stopped")
+			return nil
+		}
+	}
+}
+
+// drain waits for the search in progress to finish, still reloading the
+// config file on SIGHUP.  Returns false if a second signal to stop is
+// received first.
+func (d *daemon) drain(done <-chan struct{}, signals <-chan os.Signal) bool {
+	for {
+		select {
+		case <-done:
+			return true
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				return false
+			}
+			d.hangup()
+		}
+	}
+}
+
+// hangup handles SIGHUP:  it reopens the log file, if any, then reloads the
+// config file.
+func (d *daemon) hangup() {
+	if d.e.logOutput != nil {
+		if err := d.e.logOutput.Reopen(); err != nil {
+			d.e.log.Error(err)
+		}
+	}
+	d.status("Received SIGHUP; reloading the config file")
+	d.reloadOrKeep()
+}
+
+// reload reads the config file.
+func (d *daemon) reload() error {
+	loaded, err := d.e.loadConfig(d.args)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.config = loaded.Config
+	d.mu.Unlock()
+	d.files = loaded.Files
+	d.stamp = filesStamp(loaded.Files)
+	d.status("Loaded %d authors from %s", len(d.config.Authors),
+		strings.Join(d.files, ", "))
+	return nil
+}
+
+// reloadOrKeep reads the config file, keeping the current configuration if
+// the new one is invalid.
+func (d *daemon) reloadOrKeep() {
+	if err := d.reload(); err != nil {
+		// Don't report the same invalid files again until they change.
+		d.stamp = filesStamp(d.files)
+		d.e.log.Errorf("Keeping the current configuration:  %s", err)
+	}
+}
+
+// changed returns whether the config files have changed since read.
+func (d *daemon) changed() bool {
+	return len(d.files) != 0 && filesStamp(d.files) != d.stamp
+}
+
+// filesStamp describes the size and modification time of the files, to
+// tell when they've changed.
+func filesStamp(files []string) string {
+	var stamp strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&stamp, "%s:missing;", file)
+			continue
+		}
+		fmt.Fprintf(&stamp, "%s:%d:%d;", file, info.Size(),
+			info.ModTime().UnixNano())
+	}
+	return stamp.String()
+}
+
+// search runs the searches for the configuration's authors, then notifies
+// the notifiers and saves the results.
+func (d *daemon) search(config booklist.Config) {
+	summary := booklist.RunSummary{
+		Start:   time.Now(),
+		Authors: len(config.Authors),
+	}
+	run, searched, err := d.searchAndNotify(config)
+	summary.End = time.Now()
+	if run != nil {
+		for _, result := range run.Results {
+			summary.Titles += len(result.Publications)
+		}
+	}
+	if err != nil {
+		if _, ok := err.(exitCode); ok {
+			err = errors.New("unable to notify all of the notifiers")
+		}
+		d.e.log.Error(err)
+		summary.Error = err.Error()
+	} else {
+		d.status("Search finished; found %d titles", summary.Titles)
+	}
+	recordRun(d.e, config, summary.Start, run, err)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.runs = append([]booklist.RunSummary{summary}, d.runs...)
+	if len(d.runs) > maxRuns {
+		d.runs = d.runs[:maxRuns]
+	}
+	if searched {
+		d.previous = d.run
+		if d.previous == nil {
+			// With no earlier results, all the titles are new.
+			d.previous = new(booklist.RunResults)
+		}
+		d.run = run
+	}
+}
+
+// searchAndNotify runs the searches, then notifies the notifiers and saves
+// the results.  Returns the results and whether the searches finished; if
+// they failed, the results are those of the authors searched before the
+// failure, for the history, and aren't notified or saved.
+func (d *daemon) searchAndNotify(config booklist.Config) (*booklist.RunResults, bool, error) {
+	// The current year changes while the daemon runs.
+	year := booklist.ThisYear()
+
+	d.status("Searching for %d authors", len(config.Authors))
+	start := time.Now()
+	drift := new(booklist.DriftStats)
+	run, err := searchAuthors(d.e, config, year, nil, drift,
+		d.metrics, ioutil.Discard)
+	d.metrics.ObserveRun(start, run, drift, err)
+	if err != nil {
+		if hint := searchErrorHint(err); hint != "" {
+			err = fmt.Errorf("search failed:  %s; %s", err, hint)
+		} else {
+			err = fmt.Errorf("search failed:  %s", err)
+		}
+		return run, false, err
+	}
+	if drift.Exceeds(booklist.DefaultDriftThreshold) {
+		d.e.log.Warningf("%s; the library's catalog may have changed "+
+			"and the results may be incomplete", drift)
+	}
+
+	// Without notifiers, the results are still kept, for the next run
+	// and for the other commands that use them.
+	if len(config.Notify.Names()) == 0 {
+		err = saveResults(run)
+	} else {
+		err = notifyResults(d.e, config.Notify, run, d.metrics, true, false)
+	}
+	return run, true, err
+}
+
+// loadResults loads the results saved by the last run, for the dashboard
+// and API to show until the first search.
+func (d *daemon) loadResults() {
+	resultsPath, err := booklist.ResultsPath()
+	if err == nil {
+		d.run, err = booklist.LoadResults(resultsPath)
+	}
+	if err != nil {
+		d.e.log.Warningf("Unable to load the last results:  %s", err)
+	}
+}
+
+// listen starts serving the dashboard and JSON API at the address.
+func (d *daemon) listen(address string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s:  %s", address, err)
+	}
+	handler := (&booklist.Server{
+		Config: func() booklist.Config {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return d.config
+		},
+		Results: func() (*booklist.RunResults, *booklist.RunResults) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return d.run, d.previous
+		},
+		Runs: func() []booklist.RunSummary {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return append([]booklist.RunSummary(nil), d.runs...)
+		},
+		Log:     d.e.log,
+		Metrics: d.metrics,
+	}).Handler()
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			d.e.log.Errorf("The HTTP server failed:  %s", err)
+		}
+	}()
+	d.status("Serving the dashboard at http://%s/", listener.Addr())
+	return server, nil
+}
+
+// status prints a message about the daemon's progress, with the time.
+func (d *daemon) status(format string, args ...interface{}) {
+	d.statusMu.Lock()
+	defer d.statusMu.Unlock()
+	fmt.Fprintf(d.e.stdout, "%s %s\n", time.Now().Format("2006-01-02 15:04:05"),
+		fmt.Sprintf(format, args...))
+}
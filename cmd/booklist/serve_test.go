@@ -0,0 +1,287 @@
+// Unit tests related to the 'serve' command's daemon. //
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kbalk/gobooklist/booklist"
+	"github.com/kbalk/gobooklist/booklist/booklisttest"
+)
+
+// testTimeout is how long a test waits for the daemon to do something.
+const testTimeout = 5 * time.Second
+
+// everySchedule is a schedule of a search every given interval.
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// writeTestConfig writes a config file with the authors, given as
+// 'Lastname, Firstname', and the catalog url.  An empty list of authors
+// makes the file invalid.
+func writeTestConfig(t *testing.T, fileName, catalogURL string, authors ...string) {
+	t.Helper()
+	var contents strings.Builder
+	fmt.Fprintf(&contents, "version: 2\ncatalog-url: %s\nauthors:\n", catalogURL)
+	for _, author := range authors {
+		names := strings.SplitN(author, ", ", 2)
+		fmt.Fprintf(&contents, "    - firstname: %s\n      lastname: %s\n",
+			names[1], names[0])
+	}
+	if err := ioutil.WriteFile(fileName, []byte(contents.String()), 0644); err != nil {
+		t.Fatalf("Unable to write the config file: %s.", err)
+	}
+}
+
+// newTestDaemon returns a daemon with a config file of the authors,
+// searching the catalog with the given url.
+func newTestDaemon(t *testing.T, catalogURL string, authors ...string) (*daemon, string) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	writeTestConfig(t, configFile, catalogURL, authors...)
+	e := &env{
+		log:    logger{booklist.NopLogger},
+		stdout: ioutil.Discard,
+		stderr: ioutil.Discard,
+	}
+	d := &daemon{e: e, args: []string{configFile}}
+	if err := d.reload(); err != nil {
+		t.Fatalf("Unable to load the config file: %s.", err)
+	}
+	return d, configFile
+}
+
+// receive returns the next config searched for, failing the test if there
+// isn't one in time.
+func receive(t *testing.T, searches <-chan booklist.Config) booklist.Config {
+	t.Helper()
+	select {
+	case config := <-searches:
+		return config
+	case <-time.After(testTimeout):
+		t.Fatalf("Expected a search.")
+	}
+	return booklist.Config{}
+}
+
+// send sends a signal to the daemon's loop, failing the test if it isn't
+// received in time.
+func send(t *testing.T, signals chan<- os.Signal, sig os.Signal) {
+	t.Helper()
+	select {
+	case signals <- sig:
+	case <-time.After(testTimeout):
+		t.Fatalf("Expected the loop to receive %s.", sig)
+	}
+}
+
+func TestDaemonReload(t *testing.T) {
+	t.Log("a changed config file is reloaded.")
+	d, configFile := newTestDaemon(t, "https://catalog.example.org/",
+		"Grafton, Sue")
+	if d.changed() {
+		t.Errorf("Expected the config file to be unchanged.")
+	}
+	writeTestConfig(t, configFile, "https://catalog.example.org/",
+		"Grafton, Sue", "King, Stephen")
+	if !d.changed() {
+		t.Fatalf("Expected the config file to have changed.")
+	}
+	d.reloadOrKeep()
+	if len(d.config.Authors) != 2 || d.changed() {
+		t.Errorf("Expected 2 authors once reloaded; got %v.",
+			d.config.Authors)
+	}
+
+	t.Log("an invalid config file is reported once and the old one kept.")
+	writeTestConfig(t, configFile, "https://catalog.example.org/")
+	d.reloadOrKeep()
+	if len(d.config.Authors) != 2 {
+		t.Errorf("Expected the 2 authors to be kept; got %v.",
+			d.config.Authors)
+	}
+	if d.changed() {
+		t.Errorf("Expected the invalid file not to be reloaded again.")
+	}
+}
+
+func TestDaemonLoop(t *testing.T) {
+	t.Log("the searches run on the schedule with the current config.")
+	d, configFile := newTestDaemon(t, "https://catalog.example.org/",
+		"Grafton, Sue")
+	searches := make(chan booklist.Config, 10)
+	release := make(chan struct{})
+	d.searchFunc = func(config booklist.Config) {
+		searches <- config
+		<-release
+	}
+	signals := make(chan os.Signal)
+	watch := make(chan time.Time)
+	result := make(chan error, 1)
+	go func() {
+		result <- d.loop(everySchedule(10*time.Millisecond), false, signals,
+			watch)
+	}()
+
+	if config := receive(t, searches); len(config.Authors) != 1 {
+		t.Errorf("Expected 1 author; got %v.", config.Authors)
+	}
+	writeTestConfig(t, configFile, "https://catalog.example.org/",
+		"Grafton, Sue", "King, Stephen")
+	watch <- time.Now()
+	release <- struct{}{}
+	if config := receive(t, searches); len(config.Authors) != 2 {
+		t.Errorf("Expected the changed file's 2 authors; got %v.",
+			config.Authors)
+	}
+
+	t.Log("SIGHUP reloads the config file, keeping it if invalid.")
+	writeTestConfig(t, configFile, "https://catalog.example.org/")
+	send(t, signals, syscall.SIGHUP)
+	release <- struct{}{}
+	if config := receive(t, searches); len(config.Authors) != 2 {
+		t.Errorf("Expected the 2 authors to be kept; got %v.",
+			config.Authors)
+	}
+
+	t.Log("SIGTERM waits for the search in progress, reloading on SIGHUP.")
+	send(t, signals, syscall.SIGTERM)
+	writeTestConfig(t, configFile, "https://catalog.example.org/",
+		"Grafton, Sue")
+	send(t, signals, syscall.SIGHUP)
+	select {
+	case err := <-result:
+		t.Fatalf("Expected the loop to wait for the search; got %v.", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.mu.Lock()
+	authors := len(d.config.Authors)
+	d.mu.Unlock()
+	if authors != 1 {
+		t.Errorf("Expected SIGHUP to reload the config file while "+
+			"waiting; got %d authors.", authors)
+	}
+	release <- struct{}{}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected the loop to stop cleanly; got %v.", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("Expected the loop to stop.")
+	}
+}
+
+func TestDaemonStop(t *testing.T) {
+	t.Log("a second signal to stop exits without waiting for the search.")
+	for _, sig := range []os.Signal{syscall.SIGTERM, os.Interrupt} {
+		d, _ := newTestDaemon(t, "https://catalog.example.org/",
+			"Grafton, Sue")
+		searches := make(chan booklist.Config, 10)
+		release := make(chan struct{})
+		defer close(release)
+		d.searchFunc = func(config booklist.Config) {
+			searches <- config
+			<-release
+		}
+		signals := make(chan os.Signal)
+		result := make(chan error, 1)
+		go func() {
+			result <- d.loop(everySchedule(time.Hour), true, signals, nil)
+		}()
+
+		receive(t, searches)
+		send(t, signals, syscall.SIGTERM)
+		send(t, signals, sig)
+		select {
+		case err := <-result:
+			if err != exitCode(1) {
+				t.Errorf("Expected exit status 1 after %s; got %v.", sig,
+					err)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("Expected the loop to stop after %s.", sig)
+		}
+	}
+
+	t.Log("without a search in progress, a signal to stop exits at once.")
+	d, _ := newTestDaemon(t, "https://catalog.example.org/", "Grafton, Sue")
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	if err := d.loop(everySchedule(time.Hour), false, signals, nil); err != nil {
+		t.Errorf("Expected the loop to stop cleanly; got %v.", err)
+	}
+}
+
+func TestDaemonSearch(t *testing.T) {
+	t.Log("a search keeps the results and records the run.")
+	catalog := booklisttest.NewServer(booklisttest.Publication{
+		Author: "Grafton, Sue", Title: "X", Format: "Book",
+		Year: booklist.ThisYear()})
+	defer catalog.Close()
+	d, _ := newTestDaemon(t, catalog.URL, "Grafton, Sue", "King, Stephen")
+	d.search(d.config)
+	if d.run == nil || len(d.run.Results) != 2 || len(d.runs) != 1 ||
+		d.runs[0].Titles != 1 || d.runs[0].Error != "" {
+		t.Fatalf("Expected 1 title for 2 authors; got %+v, %+v.", d.run,
+			d.runs)
+	}
+	if saved, err := loadSavedResults(); err != nil || saved == nil ||
+		len(saved.Results) != 2 {
+		t.Errorf("Expected the results to be saved; got %v, %v.", saved, err)
+	}
+
+	t.Log("a failed search is recorded with its error.")
+	catalog.Reset()
+	catalog.Inject(booklisttest.Fault{Endpoint: booklisttest.CountEndpoint,
+		Request: 3, Status: 500})
+	last := d.run
+	d.search(d.config)
+	if len(d.runs) != 2 || d.runs[0].Error == "" || d.run != last {
+		t.Errorf("Expected a failed run that keeps the results; got %+v.",
+			d.runs)
+	}
+	runs := historyRuns(t)
+	if len(runs) != 2 || runs[0].Error == "" || runs[1].Error != "" {
+		t.Fatalf("Expected the failed run in the history; got %+v.", runs)
+	}
+	if len(runs[0].Counts) != 1 || runs[0].Counts[0].Author != "Grafton, Sue" ||
+		runs[0].Counts[0].Titles != 1 {
+		t.Errorf("Expected the counts of the author searched before the "+
+			"failure; got %+v.", runs[0].Counts)
+	}
+}
+
+// loadSavedResults returns the results saved in the state directory.
+func loadSavedResults() (*booklist.RunResults, error) {
+	resultsPath, err := booklist.ResultsPath()
+	if err != nil {
+		return nil, err
+	}
+	return booklist.LoadResults(resultsPath)
+}
+
+// historyRuns returns the runs recorded in the history, newest first.
+func historyRuns(t *testing.T) []*booklist.HistoryRun {
+	t.Helper()
+	history, err := openHistory()
+	if err != nil {
+		t.Fatalf("Unable to open the history: %s.", err)
+	}
+	defer history.Close()
+	runs, err := history.Runs()
+	if err != nil {
+		t.Fatalf("Unable to read the history: %s.", err)
+	}
+	return runs
+}
@@ -0,0 +1,71 @@
+// The 'validate' command; checks a config file for errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kbalk/gobooklist/booklist"
+)
+
+// validateCommand returns the 'validate' command.
+func validateCommand() *command {
+	var strict bool
+	return &command{
+		name:     "validate",
+		args:     "[config_file]",
+		synopsis: "Validate a config file",
+		description: `
+Read the given config file and check it for errors without searching the
+catalog.  Each problem is reported with its line and column in the file.
+
+Besides checking the file against the config file schema, validate reports
+unknown keys, authors listed more than once and values that are allowed
+but are probably a mistake, such as a firstname containing a comma.  The
+latter are warnings.  Exits with an error if the file has any errors, or
+with -strict, any warnings.
+
+If the config file includes other files, the merged configuration is also
+checked and errors in the included files are reported with their names.`,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&strict, "strict", false,
+				"Treat warnings as errors")
+		},
+		run: func(e *env, args []string) error {
+			configBytes, configFileName, err := e.readConfig(args)
+			if err != nil {
+				return err
+			}
+
+			problems := booklist.CheckConfigFormat(configBytes,
+				e.format(configFileName))
+
+			// The files included by the config file are only checked
+			// once merged, as the config file itself has no errors.
+			if !booklist.HasErrors(problems) {
+				if _, err := booklist.LoadConfigFormat(configFileName,
+					e.configFormat, nil); err != nil {
+					problems = append(problems, booklist.Problem{
+						Message: err.Error(),
+					})
+				}
+			}
+
+			for _, problem := range problems {
+				separator := ":"
+				if problem.Line == 0 {
+					separator = ": "
+				}
+				fmt.Fprintf(e.stdout, "%s%s%s\n", configFileName,
+					separator, problem)
+			}
+			if booklist.HasErrors(problems) || (strict && len(problems) != 0) {
+				return exitCode(1)
+			}
+			if len(problems) == 0 {
+				fmt.Fprintf(e.stdout, "%s: OK\n", configFileName)
+			}
+			return nil
+		},
+	}
+}